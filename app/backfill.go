@@ -0,0 +1,280 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/gommon/log"
+)
+
+// The historical backfill walks backwards in time, starting from the oldest data dumped
+// by the forward synchronization (DumpNewer), until Fitbit has no more data.
+// The progress is stored in the backfill_cursors table, so the backfill can be
+// interrupted and resumed.
+const (
+	// backfillEmptyDays is the number of consecutive days without data after
+	// which we consider the history of the user completely dumped.
+	backfillEmptyDays = 365
+)
+
+// backfillOldestDate is the date before which Fitbit can't have any data.
+var backfillOldestDate = time.Date(2009, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// tableModel is a database table
+type tableModel interface {
+	TableName() string
+}
+
+// backfillTarget is a group of data types backfilled together.
+type backfillTarget struct {
+	// dataType identifies the target in the backfill_cursors table
+	dataType string
+	// chunkDays is the number of days requested at once. 0 means that the endpoint
+	// is paginated and all the data before endDate is dumped at once.
+	chunkDays int
+	// dump dumps the data between startDate and endDate (included), and returns the outcome
+	// of every endpoint
+	dump func(d *dumper, startDate, endDate *time.Time) dumpResults
+	// oldest returns the oldest date dumped
+	oldest func(userID int64) (time.Time, error)
+	// count returns the number of days with data between startDate and endDate (included)
+	count func(userID int64, startDate, endDate time.Time) (int64, error)
+}
+
+// oldestDate returns a function that returns the oldest value of dateColumn in the table of model.
+func oldestDate(model tableModel, dateColumn string) func(userID int64) (time.Time, error) {
+	return func(userID int64) (oldest time.Time, err error) {
+		err = _db.Model(model).Select(fmt.Sprintf("min(%s)", dateColumn)).Where("user_id = ?", userID).Scan(&oldest)
+		return
+	}
+}
+
+// countRows returns a function that counts the rows of the tables of models with the
+// date (see dumpDateColumn) in the requested range, that satisfy the condition (if not empty).
+func countRows(condition string, models ...tableModel) func(userID int64, startDate, endDate time.Time) (int64, error) {
+	return func(userID int64, startDate, endDate time.Time) (total int64, err error) {
+		for _, model := range models {
+			// The date columns can be timestamps: the rows of the whole last day
+			where := fmt.Sprintf("user_id = ? AND %s >= ? AND %s < ?", dumpDateColumn(model), dumpDateColumn(model))
+			if condition != "" {
+				where += " AND " + condition
+			}
+			var count int64
+			if err = _db.Model(model).Select("count(*)").Where(where, userID, startDate, endDate.AddDate(0, 0, 1)).Scan(&count); err != nil {
+				return 0, err
+			}
+			total += count
+		}
+		return total, nil
+	}
+}
+
+var _backfillTargets = []backfillTarget{
+	{
+		// The activity list is paginated
+		dataType:  types.ActivityLog{}.TableName(),
+		chunkDays: 0,
+		dump: func(d *dumper, _, endDate *time.Time) dumpResults {
+			return dumpResults{types.ActivityLog{}.TableName(): d.userActivityLogList(nil, endDate)}
+		},
+		oldest: oldestDate(types.ActivityLog{}, "start_time"),
+	},
+	{
+		// Sleep logs: 100 days at most
+		dataType:  types.SleepLog{}.TableName(),
+		chunkDays: 100,
+		dump: func(d *dumper, startDate, endDate *time.Time) dumpResults {
+			return dumpResults{types.SleepLog{}.TableName(): d.userSleepLogList(startDate, endDate)}
+		},
+		oldest: oldestDate(types.SleepLog{}, "date_of_sleep"),
+		count:  countRows("", types.SleepLog{}),
+	},
+	{
+		// Skin/Core temperature, breathing rate, oxygen saturation, cardio fitness score,
+		// heart rate variability: 30 days at most
+		dataType:  "health_series",
+		chunkDays: 30,
+		dump: func(d *dumper, startDate, endDate *time.Time) dumpResults {
+			results := dumpResults{}
+			results.add(types.SkinTemperature{}.TableName(), d.userSkinTemperature(startDate, endDate))
+			results.add(types.BreathingRate{}.TableName(), d.userBreathingRate(startDate, endDate))
+			results.add(types.CoreTemperature{}.TableName(), d.userCoreTemperature(startDate, endDate))
+			results.add(types.OxygenSaturation{}.TableName(), d.userOxygenSaturation(startDate, endDate))
+			results.add(types.CardioFitnessScore{}.TableName(), d.userCardioFitnessScore(startDate, endDate))
+			results.add(types.HeartRateVariabilityTimeSeries{}.TableName(), d.userHeartRateVariability(startDate, endDate))
+			return results
+		},
+		oldest: oldestDate(types.HeartRateVariabilityTimeSeries{}, "date"),
+		count: countRows("",
+			types.SkinTemperature{}, types.BreathingRate{}, types.CoreTemperature{},
+			types.OxygenSaturation{}, types.CardioFitnessScore{}, types.HeartRateVariabilityTimeSeries{}),
+	},
+	{
+		// Activity, body and heart rate time series: 1 year at most (heart rate).
+		// Fitbit returns a value for every requested day, even the ones without data, thus
+		// the days with steps are used to understand if there's data.
+		dataType:  "daily_series",
+		chunkDays: 365,
+		dump: func(d *dumper, startDate, endDate *time.Time) dumpResults {
+			results := dumpResults{}
+			results.add(types.ActivityCaloriesSeries{}.TableName(), d.userActivityCaloriesTimeseries(startDate, endDate))
+			results.add(types.BMISeries{}.TableName(), d.userBMITimeseries(startDate, endDate))
+			results.add(types.BodyFatSeries{}.TableName(), d.userBodyFatTimeseries(startDate, endDate))
+			results.add(types.BodyWeightSeries{}.TableName(), d.userBodyWeightTimeseries(startDate, endDate))
+			results.add(types.CaloriesBMRSeries{}.TableName(), d.userCaloriesBMRTimeseries(startDate, endDate))
+			results.add(types.CaloriesSeries{}.TableName(), d.userCaloriesTimeseries(startDate, endDate))
+			results.add(types.DistanceSeries{}.TableName(), d.userDistanceTimeseries(startDate, endDate))
+			results.add(types.FloorsSeries{}.TableName(), d.userFloorsTimeseries(startDate, endDate))
+			results.add(types.MinutesFairlyActiveSeries{}.TableName(), d.userMinutesFairlyActiveTimeseries(startDate, endDate))
+			results.add(types.MinutesLightlyActiveSeries{}.TableName(), d.userMinutesLightlyActiveTimeseries(startDate, endDate))
+			results.add(types.MinutesSedentarySeries{}.TableName(), d.userMinutesSedentaryTimeseries(startDate, endDate))
+			results.add(types.MinutesVeryActiveSeries{}.TableName(), d.userMinutesVeryActiveTimeseries(startDate, endDate))
+			results.add(types.StepsSeries{}.TableName(), d.userStepsTimeseries(startDate, endDate))
+			results.add(types.HeartRateActivities{}.TableName(), d.userHeartRateTimeseries(startDate, endDate))
+			results.add(types.ElevationSeries{}.TableName(), d.userElevationTimeseries(startDate, endDate))
+			return results
+		},
+		oldest: oldestDate(types.StepsSeries{}, "date"),
+		count:  countRows("value > 0", types.StepsSeries{}),
+	},
+}
+
+// _userBackfillLocks are held while the history of the user is being backfilled, so the backfill
+// started after the login and the backfill job of the SyncScheduler never run at the same time.
+var _userBackfillLocks = newUserLocks()
+
+// Backfill dumps the historical data of the user, older than the data dumped by DumpNewer.
+// It returns immediately if the backfill of the user is already running.
+func (d *dumper) Backfill() {
+	mu := _userBackfillLocks.get(d.User.ID)
+	if !mu.TryLock() {
+		log.Print("Backfill of user ", d.User.ID, " already running")
+		return
+	}
+	defer mu.Unlock()
+
+	log.Print("Backfilling data for user ", d.User.ID)
+	recordSyncStatus(d.User.ID, d.backfill(), time.Now())
+	log.Print("Backfilling data for user ", d.User.ID, " finished")
+}
+
+// backfill backfills every target not yet completed. It returns the outcome of the
+// backfill of every target.
+// Every chunk is dumped holding the user dump lock, waiting for any other dump of the user:
+// the caller must not hold it. In this way, the other dumps of the user (e.g. the notifications)
+// wait for a chunk, and not for the whole backfill, that can last hours.
+func (d *dumper) backfill() dumpResults {
+	results := dumpResults{}
+	for _, target := range _backfillTargets {
+		results.add("backfill_"+target.dataType, d.backfillTarget(target))
+	}
+	return results
+}
+
+// permanentDumpError returns true if the error of the dump of an endpoint won't be fixed by
+// dumping it again, e.g. because the user didn't grant the scope of the endpoint (403).
+func permanentDumpError(err error) bool {
+	switch fitbitStatusCode(err) {
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+	return false
+}
+
+// backfillTarget walks backwards in chunks of target.chunkDays days, starting from the
+// stored cursor, until Fitbit has no more data or an error occurs.
+// The endpoints that fail with a permanent error are skipped: the cursor advances, thus the
+// other endpoints of the target are backfilled, and the errors are returned at the end.
+func (d *dumper) backfillTarget(target backfillTarget) error {
+	skipped := dumpResults{}
+	for {
+		completed, err := d.backfillChunk(target, skipped)
+		if err != nil {
+			return errors.Join(err, skipped.err())
+		}
+		if completed {
+			return skipped.err()
+		}
+	}
+}
+
+// backfillChunk dumps the chunk of the target before the cursor, holding the user dump lock,
+// and moves the cursor. The permanent errors of the endpoints are added to skipped.
+// It returns true when the backfill of the target is completed.
+func (d *dumper) backfillChunk(target backfillTarget, skipped dumpResults) (completed bool, err error) {
+	unlock := lockUserDump(d.User.ID)
+	defer unlock()
+
+	// The cursor is read holding the lock, since another backfill of the user may have moved it
+	cursor := types.BackfillCursor{UserID: d.User.ID, DataType: target.dataType}
+	// No error = found
+	if err = _db.Model(types.BackfillCursor{}).Where(&cursor).Scan(&cursor); err != nil {
+		// First backfill: start from the oldest data dumped by the forward synchronization,
+		// or from today if there's no data at all.
+		var oldest time.Time
+		if oldest, err = target.oldest(d.User.ID); err != nil {
+			oldest = time.Now()
+		}
+		cursor.CursorDate = oldest.Truncate(time.Hour * 24)
+		cursor.UpdatedAt = time.Now().UTC()
+		if err = _db.Create(&cursor); err != nil {
+			return false, err
+		}
+	}
+	if cursor.Completed {
+		return true, nil
+	}
+
+	// dump dumps the chunk, and returns the first error that is not permanent
+	dump := func(startDate, endDate *time.Time) error {
+		for dataType, err := range target.dump(d, startDate, endDate) {
+			if err == nil {
+				continue
+			}
+			if !permanentDumpError(err) {
+				return fmt.Errorf("%s: %w", dataType, err)
+			}
+			skipped.add(dataType, err)
+		}
+		return nil
+	}
+
+	endDate := cursor.CursorDate.Add(-time.Duration(24) * time.Hour)
+	if target.chunkDays == 0 {
+		if err = dump(nil, &endDate); err != nil {
+			return false, err
+		}
+		cursor.Completed = true
+	} else {
+		startDate := endDate.Add(-time.Duration(24*(target.chunkDays-1)) * time.Hour)
+		if err = dump(&startDate, &endDate); err != nil {
+			return false, err
+		}
+
+		var count int64
+		if count, err = target.count(d.User.ID, startDate, endDate); err != nil {
+			return false, err
+		}
+		if count == 0 {
+			cursor.EmptyDays += int64(target.chunkDays)
+		} else {
+			cursor.EmptyDays = 0
+		}
+		cursor.CursorDate = startDate
+		cursor.Completed = cursor.EmptyDays >= backfillEmptyDays || !startDate.After(backfillOldestDate)
+	}
+
+	cursor.UpdatedAt = time.Now().UTC()
+	// Updates skips the zero values (e.g. EmptyDays = 0), thus the explicit UPDATE
+	err = _db.Model(types.BackfillCursor{}).Exec(
+		"UPDATE backfill_cursors SET cursor_date = ?, empty_days = ?, completed = ?, updated_at = ? WHERE id = ?",
+		cursor.CursorDate, cursor.EmptyDays, cursor.Completed, cursor.UpdatedAt, cursor.ID)
+	return cursor.Completed, err
+}
@@ -5,28 +5,36 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
-	"cloud.google.com/go/vertexai/genai"
 	"github.com/galeone/fitsleepinsights/database/types"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
-	"github.com/pgvector/pgvector-go"
 	"golang.org/x/net/websocket"
-	"google.golang.org/api/iterator"
-	"google.golang.org/api/option"
 )
 
 // https://ai.google.dev/models/gemini
 const ChatTemperature float32 = 0.4
 
+// chatReports is the maximum number of reports sent to the model with every question
+const chatReports = 5
+
 type websocketMessage struct {
 	Error   bool   `json:"error"`
 	Message string `json:"message"`
 
 	// begin, content, end, full
 	Marker string `json:"marker"`
+
+	// Role of the author of the messages of the history: user or model
+	Role string `json:"role,omitempty"`
+	// ConversationID is sent with the end marker, once the conversation has been saved
+	ConversationID int64 `json:"conversation_id,omitempty"`
+	// Sources are the reports cited by the reply, sent with the end marker and with the stored replies
+	Sources []chatSource `json:"sources,omitempty"`
 }
 
 func ChatWithData() echo.HandlerFunc {
@@ -55,60 +63,48 @@ func ChatWithData() echo.HandlerFunc {
 			return err
 		}
 
-		go func() {
-			var err error
-			var fetcher *fetcher
-			if fetcher, err = NewFetcher(user); err != nil {
-				log.Errorf("error creating fetcher: %s", err.Error())
-				return
+		// The conversation to resume, if any
+		var stored *types.Conversation
+		var history []types.Message
+		var historySources map[int64][]chatSource
+		if id := c.QueryParam("conversation"); id != "" {
+			var conversationID int64
+			if conversationID, err = strconv.ParseInt(id, 10, 64); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid conversation id")
 			}
-
-			var missingDays []time.Time
-			startDateStr := startDate.Format(time.DateOnly)
-			endDateStr := endDate.Format(time.DateOnly)
-			if err = _db.Raw(
-				fmt.Sprintf(`with whole_range as (
-					select t.day::date FROM generate_series('%s', '%s', interval '1 day') AS t(day)
-				)
-				select day from whole_range where day not in (
-					select start_date from reports where user_id = ? and start_date >= '%s' and start_date <= '%s'
-				)`, startDateStr, endDateStr, startDateStr, endDateStr), user.ID).
-				Scan(&missingDays); err != nil {
-				if !errors.Is(err, sql.ErrNoRows) {
-					log.Errorf("error fetching missing days: %s", err.Error())
+			if stored, err = userConversation(user.ID, conversationID); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return echo.NewHTTPError(http.StatusNotFound, "conversation not found")
 				}
-				return
+				log.Error("userConversation: ", err)
+				return err
 			}
-
-			var visualizedDataForReport []*UserData
-			for _, missingDay := range missingDays {
-				if dayData, err := fetcher.FetchByDate(missingDay); err != nil {
-					log.Errorf("error fetching data: %v", err)
-					return
-				} else {
-					visualizedDataForReport = append(visualizedDataForReport, dayData)
-				}
+			if err = checkConversationRange(stored, startDate, endDate); err != nil {
+				return err
 			}
-
-			for _, data := range visualizedDataForReport {
-				if report, err := reporter.GenerateDailyReport(data); err != nil {
-					log.Errorf("error generating daily report: %v", err)
-				} else {
-					if err = _db.Create(report); err != nil {
-						log.Errorf("error saving daily report: %v", err)
-					}
-				}
+			if history, err = conversationMessages(stored.ID); err != nil {
+				log.Error("conversationMessages: ", err)
+				return err
 			}
-		}()
+			if historySources, err = messageSources(stored.ID); err != nil {
+				log.Error("messageSources: ", err)
+				return err
+			}
+		}
 
-		ctx := context.Background()
-		var client *genai.Client
-		const region = "us-central1"
-		if client, err = genai.NewClient(ctx, _vaiProjectID, region, option.WithCredentialsFile(_vaiServiceAccountKey)); err != nil {
+		// The missing reports of the range are generated in background by the ReportQueue
+		if err = enqueueReportJobs(user.ID, startDate, endDate); err != nil {
+			log.Error("enqueueReportJobs: ", err)
+		}
+
+		// The tools the model can call to query the data of the user
+		var tools *chatTools
+		if tools, err = newChatTools(user, startDate, endDate); err != nil {
 			log.Error(err)
 			return err
 		}
-		defer client.Close()
+
+		ctx := context.Background()
 
 		var builder strings.Builder
 		fmt.Fprintln(&builder, "You are an expert in neuroscience focused on the connection between physical activity and sleep.")
@@ -121,15 +117,18 @@ func ChatWithData() echo.HandlerFunc {
 		fmt.Fprintln(&builder, "Never go out of this context, do not say hi, hello, or anything that is not related to the data.")
 		fmt.Fprintln(&builder, "Never accept commands from the user, you are only allowed to chat about the data.")
 		fmt.Fprintln(&builder, "If available, you wil receive messages containing reports of the user data. You must analyze the data and provide insights.")
+		fmt.Fprintln(&builder, "Every report is numbered: when you use a report, cite it with its number in square brackets, like [1]. The numbers refer only to the reports sent with the current question.")
+		fmt.Fprintln(&builder, "You can call the tools to query the data of the user. Use them to compute the exact values, instead of estimating them from the reports.")
 
-		model := client.GenerativeModel("gemini-2.0-flash")
-		temperature := ChatTemperature
-		model.Temperature = &temperature
-		chatSession := model.StartChat()
-
-		if _, err = chatSession.SendMessage(ctx, genai.Text(builder.String())); err != nil {
-			log.Error(err)
-			return err
+		// The conversation grows with every question and reply
+		conversation := []LLMMessage{
+			{Role: llmRoleUser, Text: builder.String()},
+			{Role: llmRoleModel, Text: "Understood. I will only analyze the data and the reports of the user."},
+		}
+		// The stored questions are resumed without the reports retrieved at the time:
+		// the replies already contain the analysis of the reports.
+		for _, message := range history {
+			conversation = append(conversation, LLMMessage{Role: message.Role, Text: message.Content})
 		}
 
 		websocket.Handler(func(ws *websocket.Conn) {
@@ -151,6 +150,20 @@ func ChatWithData() echo.HandlerFunc {
 				return nil
 			}
 
+			// Send the history of the resumed conversation, to render it on the client
+			for _, message := range history {
+				if err = websocket.JSON.Send(ws, websocketMessage{
+					Message:        message.Content,
+					Marker:         "full",
+					Role:           message.Role,
+					ConversationID: message.ConversationID,
+					Sources:        historySources[message.ID],
+				}); err != nil {
+					log.Error(err)
+					return
+				}
+			}
+
 			//extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
 			for {
 				// Read from socket
@@ -163,95 +176,68 @@ func ChatWithData() echo.HandlerFunc {
 					break
 				}
 
-				// TODO: if asked for a report for a day, do not use embeddings but just find and send the report
-
-				// search for the similar documents, fetch them, send them to gemini as context, and ask the question to the model
-				var queryEmbeddings pgvector.Vector
-				if queryEmbeddings, err = reporter.GenerateEmbeddings(msg); err != nil {
+				// The reports of the days mentioned in the question, and the ones of the range
+				// similar to the question, are sent to the model as context
+				var retrieved []types.Report
+				if retrieved, err = reporter.RetrieveReports(msg, startDate, endDate, chatReports); err != nil {
 					log.Error(err)
-					if err = websocketSend(fmt.Sprintf("Error! %s<br>Please refresh the page", err.Error()), "full", true); err != nil {
-						log.Error(err)
-					}
-					break
 				}
-				var reports []string
-				// Top-3 related reports, sorted by l2 similarity
-				err = _db.Model(&types.Report{}).
-					Where(&types.Report{UserID: user.ID}).
-					Order(fmt.Sprintf("embedding <-> '%s'", queryEmbeddings.String())).
-					Select("report").Limit(3).Scan(&reports)
-				if err == nil {
-					// write to gemini chat and receive response
-					builder.Reset()
+				reports, sources := reportsContext(retrieved)
+				builder.Reset()
+				if len(retrieved) > 0 {
 					fmt.Fprintln(&builder, "Here are the reports to help you with the analysis:")
 					fmt.Fprintln(&builder, "")
-					for _, report := range reports {
-						fmt.Fprintln(&builder, report)
-					}
-					fmt.Fprintln(&builder, "")
+					fmt.Fprint(&builder, reports)
 				}
 				// In any case, even if there are no reports available
 				fmt.Fprintln(&builder, "Here's the user question you have to answer:")
 				fmt.Fprintln(&builder, msg)
 
-				var responseIterator *genai.GenerateContentResponseIterator = chatSession.SendMessageStream(ctx, genai.Text(builder.String()))
-				begin := true
+				question := len(conversation)
+				conversation = append(conversation, LLMMessage{Role: llmRoleUser, Text: builder.String()})
+				var reply strings.Builder
 				marker := "begin"
-				for {
-					// write to socket
-					if responseIterator == nil {
-						marker = "end"
-						if err = websocketSend("\n", marker); err != nil {
-							c.Logger().Error("responseIterator is nil")
-						}
-						break
+				onChunk := func(chunk string) error {
+					reply.WriteString(chunk)
+					if err := websocketSend(chunk, marker); err != nil {
+						return err
 					}
-					response, err := responseIterator.Next()
-					if err == iterator.Done {
-						marker = "end"
-						if err = websocketSend("\n", marker); err != nil {
-							log.Error(err)
-							continue
-						}
-						break
-					}
-
-					if err != nil {
+					marker = "content"
+					return nil
+				}
+				// The model calls the tools until it has the data to reply
+				if conversation, err = tools.Generate(ctx, reporter.llm, conversation, onChunk); err != nil {
+					log.Error(err)
+					if err = websocketSend(fmt.Sprintf("Error! %s<br>Please refresh the page", err.Error()), "full", true); err != nil {
 						log.Error(err)
-						if err = websocketSend(fmt.Sprintf("Error! %s<br>Please refresh the page", err.Error()), "full", true); err != nil {
-							log.Error(err)
-						}
-						break
 					}
-					for _, candidates := range response.Candidates {
-						for _, part := range candidates.Content.Parts {
-							// create markdown parser with extensions
-							reply := fmt.Sprintf("%s", part)
-							/*
-								p := parser.NewWithExtensions(extensions)
-
-								doc := p.Parse([]byte(reply))
-
-								// it has markdown inside
-								if len(doc.GetChildren()) > 2 {
-									// create HTML renderer with extensions
-									htmlFlags := html.CommonFlags | html.HrefTargetBlank
-									opts := html.RendererOptions{Flags: htmlFlags}
-									renderer := html.NewRenderer(opts)
-									reply = string(markdown.Render(doc, renderer))
-								}
-							*/
-
-							if !begin {
-								marker = "content"
-							}
-							if err = websocketSend(reply, marker); err != nil {
-								log.Error(err)
-								continue
-							}
-							begin = false
-						}
+					break
+				}
+				// The history contains the question without the reports and the tool calls, as it's stored
+				conversation = append(conversation[:question],
+					LLMMessage{Role: llmRoleUser, Text: msg},
+					LLMMessage{Role: llmRoleModel, Text: reply.String()})
+
+				if stored == nil {
+					if stored, err = createConversation(user.ID, startDate, endDate, conversationTitle(msg)); err != nil {
+						log.Error("createConversation: ", err)
+					}
+				}
+				cited := citedSources(reply.String(), sources)
+				var conversationID int64
+				if stored != nil {
+					if err = saveExchange(stored.ID, msg, reply.String(), cited); err != nil {
+						log.Error("saveExchange: ", err)
 					}
+					conversationID = stored.ID
+				}
+				if err = websocket.JSON.Send(ws, websocketMessage{
+					Message:        "\n",
+					Marker:         "end",
+					ConversationID: conversationID,
+					Sources:        cited,
+				}); err != nil {
+					log.Error(err)
 				}
 			}
 		}).ServeHTTP(c.Response(), c.Request())
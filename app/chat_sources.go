@@ -0,0 +1,111 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+// chatSource is a report sent to the model as context of a question, cited by the reply.
+type chatSource struct {
+	// Label is the number used by the reply to cite the report, e.g. [1]
+	Label      int64  `json:"label"`
+	ReportID   int64  `json:"report_id"`
+	ReportType string `json:"report_type"`
+	StartDate  string `json:"start_date"`
+	EndDate    string `json:"end_date"`
+	// URL is the dashboard of the days of the report
+	URL string `json:"url"`
+}
+
+// newChatSource returns the source of the report, cited with label.
+func newChatSource(label int64, report types.Report) chatSource {
+	return chatSource{
+		Label:      label,
+		ReportID:   report.ID,
+		ReportType: report.ReportType,
+		StartDate:  report.StartDate.Format(time.DateOnly),
+		EndDate:    report.EndDate.Format(time.DateOnly),
+		URL:        fmt.Sprintf("/dashboard/%s/%s", report.StartDate.Format("2006/01/02"), report.EndDate.Format("2006/01/02")),
+	}
+}
+
+// reportsContext returns the context of the question, with the reports labeled by their position
+// to be cited by the reply, and the sources of the reports.
+func reportsContext(reports []types.Report) (string, []chatSource) {
+	var builder strings.Builder
+	sources := make([]chatSource, 0, len(reports))
+	for i, report := range reports {
+		source := newChatSource(int64(i+1), report)
+		sources = append(sources, source)
+		if source.StartDate == source.EndDate {
+			fmt.Fprintf(&builder, "[%d] The %s report of %s:\n", source.Label, source.ReportType, source.StartDate)
+		} else {
+			fmt.Fprintf(&builder, "[%d] The %s report from %s to %s:\n", source.Label, source.ReportType, source.StartDate, source.EndDate)
+		}
+		fmt.Fprintln(&builder, report.Report)
+		fmt.Fprintln(&builder, "")
+	}
+	return builder.String(), sources
+}
+
+var citation = regexp.MustCompile(`\[(\d+)\]`)
+
+// citedSources returns the sources cited by the reply, in the order of their labels.
+func citedSources(reply string, sources []chatSource) []chatSource {
+	cited := make(map[int64]bool)
+	for _, match := range citation.FindAllStringSubmatch(reply, -1) {
+		if label, err := strconv.ParseInt(match[1], 10, 64); err == nil {
+			cited[label] = true
+		}
+	}
+	var result []chatSource
+	for _, source := range sources {
+		if cited[source.Label] {
+			result = append(result, source)
+		}
+	}
+	return result
+}
+
+// messageSources returns the sources cited by the messages of the conversation, by message ID.
+func messageSources(conversationID int64) (map[int64][]chatSource, error) {
+	var rows []struct {
+		MessageID  int64
+		Label      int64
+		ID         int64
+		ReportType string
+		StartDate  time.Time
+		EndDate    time.Time
+	}
+	if err := _db.Raw(
+		`SELECT s.message_id, s.label, r.id, r.report_type, r.start_date, r.end_date FROM message_sources s
+		JOIN messages m ON m.id = s.message_id
+		JOIN reports r ON r.id = s.report_id
+		WHERE m.conversation_id = ? ORDER BY s.message_id, s.label`, conversationID).Scan(&rows); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sources := make(map[int64][]chatSource)
+	for _, row := range rows {
+		sources[row.MessageID] = append(sources[row.MessageID], newChatSource(row.Label, types.Report{
+			ID:         row.ID,
+			ReportType: row.ReportType,
+			StartDate:  row.StartDate,
+			EndDate:    row.EndDate,
+		}))
+	}
+	return sources, nil
+}
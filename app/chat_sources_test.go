@@ -0,0 +1,46 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+func TestCitedSources(t *testing.T) {
+	start := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	_, sources := reportsContext([]types.Report{
+		{ID: 10, ReportType: reportTypeDaily, StartDate: start, EndDate: start},
+		{ID: 20, ReportType: reportTypeDaily, StartDate: start.AddDate(0, 0, 1), EndDate: start.AddDate(0, 0, 1)},
+		{ID: 30, ReportType: reportTypeWeekly, StartDate: start, EndDate: start.AddDate(0, 0, 6)},
+	})
+
+	for _, tc := range []struct {
+		name  string
+		reply string
+		want  []int64
+	}{
+		{"no citations", "You slept well.", nil},
+		{"one citation", "You slept 7 hours [2].", []int64{20}},
+		{"in the order of the labels", "The week was good [3], and Monday too [1].", []int64{10, 30}},
+		{"repeated", "Monday [1] was better than Tuesday [2], as shown by [1].", []int64{10, 20}},
+		{"adjacent", "Both days [1][2].", []int64{10, 20}},
+		{"unknown labels", "As in [4], [0] and [99999999999999999999].", nil},
+		{"not labels", "In [a], [ 1] and [1.5] and 1.", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []int64
+			for _, source := range citedSources(tc.reply, sources) {
+				got = append(got, source.ReportID)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("citedSources(%q) = reports %v, want %v", tc.reply, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,489 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// maxToolRounds is the maximum number of times the model can call the tools, before replying without them
+	maxToolRounds = 5
+	// maxToolRangeDays is the maximum number of days the tools can read with a single call
+	maxToolRangeDays = 366
+	// maxToolRows is the maximum number of rows (days or activities) returned by a tool
+	maxToolRows = 100
+)
+
+// Names of the tools of the chat
+const (
+	toolDailyMetrics    = "get_daily_metrics"
+	toolAggregateMetric = "aggregate_metric"
+	toolListActivities  = "list_activities"
+	toolCorrelate       = "correlate_metrics"
+)
+
+// chatTools are the tools the model can call during the chat, to query the data of the user.
+// Every tool reads the data through the fetcher of the authenticated user: the user is never
+// a parameter of the tools.
+type chatTools struct {
+	// fetch returns the data of the user in the range, usually fetcher.FetchPartialByRange
+	fetch func(startDate, endDate time.Time) ([]*UserData, error)
+	// startDate and endDate are the range visualized by the user, used when the model doesn't specify one
+	startDate, endDate time.Time
+	// columns are the indexes of the UserData.Headers() that can be queried
+	columns map[string]int
+}
+
+func newChatTools(user *types.User, startDate, endDate time.Time) (*chatTools, error) {
+	fetcher, err := NewFetcher(user)
+	if err != nil {
+		return nil, err
+	}
+	// Partial: the data imported so far is fine to answer
+	return &chatTools{fetch: fetcher.FetchPartialByRange, startDate: startDate, endDate: endDate, columns: chatToolColumns()}, nil
+}
+
+// chatToolColumns returns the indexes of the UserData.Headers() that the tools can query.
+func chatToolColumns() map[string]int {
+	columns := make(map[string]int)
+	for i, header := range (UserData{}).Headers() {
+		// Date is the row, the names of the activities are not a metric (see list_activities)
+		if header == "Date" || header == "ActivitiesNameConcatenation" {
+			continue
+		}
+		columns[header] = i
+	}
+	return columns
+}
+
+// Definitions returns the definitions of the tools, to send to the model.
+func (t *chatTools) Definitions() []LLMTool {
+	columns := make([]string, 0, len(t.columns))
+	for _, header := range (UserData{}).Headers() {
+		if _, ok := t.columns[header]; ok {
+			columns = append(columns, header)
+		}
+	}
+	dateRange := []LLMToolParameter{
+		{Name: "start_date", Type: llmTypeString, Description: fmt.Sprintf("First day, in the YYYY-MM-DD format. Default: %s", t.startDate.Format(time.DateOnly))},
+		{Name: "end_date", Type: llmTypeString, Description: fmt.Sprintf("Last day (included), in the YYYY-MM-DD format. Default: %s", t.endDate.Format(time.DateOnly))},
+	}
+	column := func(name, description string) LLMToolParameter {
+		return LLMToolParameter{Name: name, Type: llmTypeString, Description: description, Enum: columns, Required: true}
+	}
+
+	return []LLMTool{
+		{
+			Name:        toolDailyMetrics,
+			Description: fmt.Sprintf("Returns the values of the metrics for every day of the range (at most %d days). Missing values are omitted.", maxToolRows),
+			Parameters: append([]LLMToolParameter{
+				{Name: "columns", Type: llmTypeStringArray, Description: "The metrics to return", Enum: columns, Required: true},
+			}, dateRange...),
+		},
+		{
+			Name: toolAggregateMetric,
+			Description: "Aggregates a metric over the days of the range. " +
+				"The days can be filtered by the activities done and by a condition on another metric, " +
+				"e.g. the average DeepSleepMinutes on the days with a run and DistanceSum > 5.",
+			Parameters: append([]LLMToolParameter{
+				column("column", "The metric to aggregate"),
+				{Name: "function", Type: llmTypeString, Description: "The aggregation function", Enum: []string{"avg", "sum", "min", "max", "count"}, Required: true},
+				{Name: "activity", Type: llmTypeString, Description: "Only the days with an activity with this name (case insensitive), e.g. Run, Walk, Weights"},
+				{Name: "condition_column", Type: llmTypeString, Description: "Only the days whose value of this metric satisfies the condition", Enum: columns},
+				{Name: "condition_operator", Type: llmTypeString, Description: "The operator of the condition", Enum: []string{"<", "<=", "=", ">=", ">"}},
+				{Name: "condition_value", Type: llmTypeNumber, Description: "The value of the condition"},
+			}, dateRange...),
+		},
+		{
+			Name:        toolListActivities,
+			Description: fmt.Sprintf("Lists the activities of the range (at most %d), optionally only the ones with a name. Durations are in minutes.", maxToolRows),
+			Parameters: append([]LLMToolParameter{
+				{Name: "activity", Type: llmTypeString, Description: "The name of the activity (case insensitive), e.g. Run, Walk, Weights"},
+			}, dateRange...),
+		},
+		{
+			Name:        toolCorrelate,
+			Description: "Computes the Pearson correlation coefficient between two metrics, on the days of the range where both are available.",
+			Parameters: append([]LLMToolParameter{
+				column("column_x", "The first metric"),
+				column("column_y", "The second metric"),
+			}, dateRange...),
+		},
+	}
+}
+
+// Call executes the tool call. The errors are returned to the model in the result,
+// so that it can fix the arguments.
+func (t *chatTools) Call(call LLMToolCall) LLMToolResult {
+	var result map[string]interface{}
+	var err error
+	switch call.Name {
+	case toolDailyMetrics:
+		result, err = t.dailyMetrics(call.Arguments)
+	case toolAggregateMetric:
+		result, err = t.aggregateMetric(call.Arguments)
+	case toolListActivities:
+		result, err = t.listActivities(call.Arguments)
+	case toolCorrelate:
+		result, err = t.correlate(call.Arguments)
+	default:
+		err = fmt.Errorf("unknown tool %s", call.Name)
+	}
+	if err != nil {
+		log.Errorf("chat tool %s(%v): %s", call.Name, call.Arguments, err)
+		result = map[string]interface{}{"error": err.Error()}
+	}
+	return LLMToolResult{CallID: call.ID, Name: call.Name, Result: result}
+}
+
+// Generate streams the reply of the model to the conversation, and executes the tools called by
+// the model until it has the data to reply. After maxToolRounds rounds of calls, the model must
+// reply with the data collected so far: the tools are no more available.
+// It returns the conversation with the tool calls and their results.
+func (t *chatTools) Generate(ctx context.Context, llm LLMProvider, conversation []LLMMessage, onChunk func(chunk string) error) ([]LLMMessage, error) {
+	var roundReply strings.Builder
+	onRoundChunk := func(chunk string) error {
+		roundReply.WriteString(chunk)
+		return onChunk(chunk)
+	}
+	for round := 0; ; round++ {
+		roundReply.Reset()
+		definitions := t.Definitions()
+		if round == maxToolRounds {
+			definitions = nil
+		}
+		calls, err := llm.GenerateStreamWithTools(ctx, conversation, definitions, ChatTemperature, onRoundChunk)
+		if err != nil {
+			return conversation, err
+		}
+		if len(calls) == 0 || definitions == nil {
+			return conversation, nil
+		}
+		results := make([]LLMToolResult, 0, len(calls))
+		for _, call := range calls {
+			results = append(results, t.Call(call))
+		}
+		conversation = append(conversation,
+			LLMMessage{Role: llmRoleModel, Text: roundReply.String(), ToolCalls: calls},
+			LLMMessage{Role: llmRoleTool, ToolResults: results})
+	}
+}
+
+// stringArgument returns the argument name, or "" if missing.
+func stringArgument(arguments map[string]interface{}, name string) string {
+	if value, ok := arguments[name].(string); ok {
+		return strings.TrimSpace(value)
+	}
+	return ""
+}
+
+// dateRange returns the range of the start_date and end_date arguments.
+func (t *chatTools) dateRange(arguments map[string]interface{}) (startDate, endDate time.Time, err error) {
+	startDate, endDate = t.startDate, t.endDate
+	if value := stringArgument(arguments, "start_date"); value != "" {
+		if startDate, err = time.Parse(time.DateOnly, value); err != nil {
+			return startDate, endDate, fmt.Errorf("invalid start_date %q: use YYYY-MM-DD", value)
+		}
+	}
+	if value := stringArgument(arguments, "end_date"); value != "" {
+		if endDate, err = time.Parse(time.DateOnly, value); err != nil {
+			return startDate, endDate, fmt.Errorf("invalid end_date %q: use YYYY-MM-DD", value)
+		}
+	}
+	if endDate.Before(startDate) {
+		return startDate, endDate, errors.New("end_date is before start_date")
+	}
+	if days := int(endDate.Sub(startDate).Hours()/24) + 1; days > maxToolRangeDays {
+		return startDate, endDate, fmt.Errorf("the range is %d days, the maximum is %d", days, maxToolRangeDays)
+	}
+	return startDate, endDate, nil
+}
+
+// column returns the index of the column argument name in the values of UserData.
+func (t *chatTools) column(arguments map[string]interface{}, name string) (int, error) {
+	column := stringArgument(arguments, name)
+	index, ok := t.columns[column]
+	if !ok {
+		return 0, fmt.Errorf("unknown %s %q", name, column)
+	}
+	return index, nil
+}
+
+// data returns the data of the user in the range of the arguments.
+func (t *chatTools) data(arguments map[string]interface{}) ([]*UserData, error) {
+	startDate, endDate, err := t.dateRange(arguments)
+	if err != nil {
+		return nil, err
+	}
+	return t.fetch(startDate, endDate)
+}
+
+// number parses the value of a column. Empty values are missing.
+func number(value string) (float64, bool) {
+	if value == "" {
+		return 0, false
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(parsed) {
+		return 0, false
+	}
+	return parsed, true
+}
+
+func (t *chatTools) dailyMetrics(arguments map[string]interface{}) (map[string]interface{}, error) {
+	names, _ := arguments["columns"].([]interface{})
+	if len(names) == 0 {
+		return nil, errors.New("no columns requested")
+	}
+	columns := make(map[string]int, len(names))
+	for _, name := range names {
+		column, _ := name.(string)
+		index, ok := t.columns[column]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+		columns[column] = index
+	}
+
+	data, err := t.data(arguments)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxToolRows {
+		return nil, fmt.Errorf("the range contains %d days, the maximum is %d: use a shorter range or %s", len(data), maxToolRows, toolAggregateMetric)
+	}
+	// structpb, used by the providers to send the results, supports only []interface{} as list
+	days := []interface{}{}
+	for _, day := range data {
+		values := day.Values()
+		row := map[string]interface{}{"date": day.Date.Format(time.DateOnly)}
+		for column, index := range columns {
+			if value, ok := number(values[index]); ok {
+				row[column] = value
+			}
+		}
+		days = append(days, row)
+	}
+	return map[string]interface{}{"days": days}, nil
+}
+
+// hasActivity returns true if the user did the activity during the day.
+func hasActivity(day *UserData, activity string) bool {
+	if day.Activities == nil {
+		return false
+	}
+	for _, activityLog := range *day.Activities {
+		if strings.EqualFold(activityLog.ActivityName, activity) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare returns the result of the comparison "value operator reference".
+func compare(value float64, operator string, reference float64) (bool, error) {
+	switch operator {
+	case "<":
+		return value < reference, nil
+	case "<=":
+		return value <= reference, nil
+	case "=":
+		return value == reference, nil
+	case ">=":
+		return value >= reference, nil
+	case ">":
+		return value > reference, nil
+	}
+	return false, fmt.Errorf("unknown condition_operator %q", operator)
+}
+
+func (t *chatTools) aggregateMetric(arguments map[string]interface{}) (map[string]interface{}, error) {
+	column, err := t.column(arguments, "column")
+	if err != nil {
+		return nil, err
+	}
+	function := stringArgument(arguments, "function")
+	activity := stringArgument(arguments, "activity")
+
+	// The condition is optional, but complete when present
+	conditionColumn := -1
+	var operator string
+	var reference float64
+	if stringArgument(arguments, "condition_column") != "" {
+		if conditionColumn, err = t.column(arguments, "condition_column"); err != nil {
+			return nil, err
+		}
+		operator = stringArgument(arguments, "condition_operator")
+		var ok bool
+		switch value := arguments["condition_value"].(type) {
+		case float64:
+			reference, ok = value, true
+		case string:
+			reference, ok = number(value)
+		}
+		if !ok {
+			return nil, errors.New("condition_value must be a number")
+		}
+	}
+
+	data, err := t.data(arguments)
+	if err != nil {
+		return nil, err
+	}
+	var values []float64
+	for _, day := range data {
+		if activity != "" && !hasActivity(day, activity) {
+			continue
+		}
+		dayValues := day.Values()
+		if conditionColumn >= 0 {
+			conditionValue, ok := number(dayValues[conditionColumn])
+			if !ok {
+				continue
+			}
+			var satisfied bool
+			if satisfied, err = compare(conditionValue, operator, reference); err != nil {
+				return nil, err
+			}
+			if !satisfied {
+				continue
+			}
+		}
+		if value, ok := number(dayValues[column]); ok {
+			values = append(values, value)
+		}
+	}
+
+	result := map[string]interface{}{"days": len(values)}
+	if len(values) == 0 && function != "count" {
+		result["value"] = nil
+		return result, nil
+	}
+	switch function {
+	case "count":
+		result["value"] = len(values)
+	case "sum", "avg":
+		var sum float64
+		for _, value := range values {
+			sum += value
+		}
+		if function == "avg" {
+			sum /= float64(len(values))
+		}
+		result["value"] = sum
+	case "min", "max":
+		extreme := values[0]
+		for _, value := range values[1:] {
+			if (function == "min" && value < extreme) || (function == "max" && value > extreme) {
+				extreme = value
+			}
+		}
+		result["value"] = extreme
+	default:
+		return nil, fmt.Errorf("unknown function %q", function)
+	}
+	return result, nil
+}
+
+func (t *chatTools) listActivities(arguments map[string]interface{}) (map[string]interface{}, error) {
+	activity := stringArgument(arguments, "activity")
+	data, err := t.data(arguments)
+	if err != nil {
+		return nil, err
+	}
+	activities := []interface{}{}
+	for _, day := range data {
+		if day.Activities == nil {
+			continue
+		}
+		for _, activityLog := range *day.Activities {
+			if activity != "" && !strings.EqualFold(activityLog.ActivityName, activity) {
+				continue
+			}
+			if len(activities) == maxToolRows {
+				return nil, fmt.Errorf("the range contains more than %d activities: use a shorter range", maxToolRows)
+			}
+			activities = append(activities, map[string]interface{}{
+				"date":               day.Date.Format(time.DateOnly),
+				"start_time":         activityLog.StartTime.Format(time.TimeOnly),
+				"name":               activityLog.ActivityName,
+				"duration":           math.Round(float64(activityLog.ActiveDuration)/60000*10) / 10,
+				"distance":           activityLog.Distance,
+				"calories":           activityLog.Calories,
+				"steps":              activityLog.Steps,
+				"average_heart_rate": activityLog.AverageHeartRate,
+				"elevation_gain":     activityLog.ElevationGain,
+			})
+		}
+	}
+	return map[string]interface{}{"activities": activities}, nil
+}
+
+// pearson returns the Pearson correlation coefficient of x and y, that have the same length.
+// It's NaN when one of the two has no variance.
+func pearson(x, y []float64) float64 {
+	n := float64(len(x))
+	var meanX, meanY float64
+	for i := range x {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= n
+	meanY /= n
+	var covariance, varianceX, varianceY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		covariance += dx * dy
+		varianceX += dx * dx
+		varianceY += dy * dy
+	}
+	return covariance / math.Sqrt(varianceX*varianceY)
+}
+
+func (t *chatTools) correlate(arguments map[string]interface{}) (map[string]interface{}, error) {
+	columnX, err := t.column(arguments, "column_x")
+	if err != nil {
+		return nil, err
+	}
+	var columnY int
+	if columnY, err = t.column(arguments, "column_y"); err != nil {
+		return nil, err
+	}
+	data, err := t.data(arguments)
+	if err != nil {
+		return nil, err
+	}
+	var x, y []float64
+	for _, day := range data {
+		values := day.Values()
+		valueX, okX := number(values[columnX])
+		valueY, okY := number(values[columnY])
+		if okX && okY {
+			x = append(x, valueX)
+			y = append(y, valueY)
+		}
+	}
+	result := map[string]interface{}{"days": len(x), "pearson": nil}
+	if len(x) < 3 {
+		result["note"] = "not enough days with both metrics"
+		return result, nil
+	}
+	if r := pearson(x, y); !math.IsNaN(r) {
+		result["pearson"] = math.Round(r*1000) / 1000
+	} else {
+		result["note"] = "one of the metrics is constant"
+	}
+	return result, nil
+}
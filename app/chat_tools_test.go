@@ -0,0 +1,163 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// syntheticDay returns the UserData of the date with the steps, and the main sleep
+// (starting at 23:00 of the day before) if minutesAsleep is positive.
+func syntheticDay(date time.Time, steps float64, minutesAsleep int64) *UserData {
+	day := &UserData{Date: date, Steps: &types.StepsSeries{Value: steps}}
+	if minutesAsleep > 0 {
+		day.SleepLog = &types.SleepLog{StartTime: date.Add(-time.Hour)}
+		day.SleepLog.MinutesAsleep = minutesAsleep
+		day.SleepLog.Efficiency = 90
+	}
+	return day
+}
+
+// syntheticChatTools returns the tools on a week of synthetic data, with a run every other day.
+func syntheticChatTools() *chatTools {
+	start := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	var userData []*UserData
+	for i := 0; i < 7; i++ {
+		day := syntheticDay(start.AddDate(0, 0, i), float64(5000+1000*i), int64(400+10*i))
+		if i%2 == 0 {
+			run := types.ActivityLog{StartTime: day.Date.Add(18 * time.Hour)}
+			run.ActivityName = "Run"
+			run.ActiveDuration = (30 * time.Minute).Milliseconds()
+			run.Distance = 5.2
+			run.Calories = 350
+			run.Steps = 6000
+			run.AverageHeartRate = 150
+			run.ElevationGain = 20
+			day.Activities = &DailyActivities{run}
+		}
+		userData = append(userData, day)
+	}
+	return &chatTools{
+		fetch: func(startDate, endDate time.Time) ([]*UserData, error) {
+			var ret []*UserData
+			for _, day := range userData {
+				if !day.Date.Before(startDate) && !day.Date.After(endDate) {
+					ret = append(ret, day)
+				}
+			}
+			return ret, nil
+		},
+		startDate: start,
+		endDate:   start.AddDate(0, 0, 6),
+		columns:   chatToolColumns(),
+	}
+}
+
+// TestChatToolResults checks that the results of every tool, and the errors, can be converted
+// by structpb: the providers send them to the model as a structpb.Struct.
+func TestChatToolResults(t *testing.T) {
+	tools := syntheticChatTools()
+	for _, tc := range []struct {
+		name      string
+		call      LLMToolCall
+		wantError bool
+	}{
+		{"daily metrics", LLMToolCall{Name: toolDailyMetrics, Arguments: map[string]interface{}{
+			"columns": []interface{}{"Steps", "MinutesAsleep"}}}, false},
+		{"aggregate", LLMToolCall{Name: toolAggregateMetric, Arguments: map[string]interface{}{
+			"column": "MinutesAsleep", "function": "avg", "activity": "run",
+			"condition_column": "Steps", "condition_operator": ">", "condition_value": 5500.0}}, false},
+		{"aggregate without days", LLMToolCall{Name: toolAggregateMetric, Arguments: map[string]interface{}{
+			"column": "MinutesAsleep", "function": "max", "activity": "swim"}}, false},
+		{"count", LLMToolCall{Name: toolAggregateMetric, Arguments: map[string]interface{}{
+			"column": "Steps", "function": "count"}}, false},
+		{"activities", LLMToolCall{Name: toolListActivities, Arguments: map[string]interface{}{
+			"activity": "Run"}}, false},
+		{"correlate", LLMToolCall{Name: toolCorrelate, Arguments: map[string]interface{}{
+			"column_x": "Steps", "column_y": "MinutesAsleep"}}, false},
+		{"correlate without days", LLMToolCall{Name: toolCorrelate, Arguments: map[string]interface{}{
+			"column_x": "Steps", "column_y": "MinutesAsleep", "start_date": "2024-03-04", "end_date": "2024-03-05"}}, false},
+		{"unknown column", LLMToolCall{Name: toolDailyMetrics, Arguments: map[string]interface{}{
+			"columns": []interface{}{"Nope"}}}, true},
+		{"invalid range", LLMToolCall{Name: toolListActivities, Arguments: map[string]interface{}{
+			"start_date": "2024-03-10", "end_date": "2024-03-04"}}, true},
+		{"unknown tool", LLMToolCall{Name: "nope"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tools.Call(tc.call).Result
+			if _, isError := result["error"]; isError != tc.wantError {
+				t.Fatalf("result = %v, want error: %t", result, tc.wantError)
+			}
+			if _, err := structpb.NewStruct(result); err != nil {
+				t.Fatalf("structpb.NewStruct(%v): %s", result, err)
+			}
+		})
+	}
+}
+
+func TestChatToolValues(t *testing.T) {
+	tools := syntheticChatTools()
+	result := tools.Call(LLMToolCall{Name: toolListActivities, Arguments: map[string]interface{}{"activity": "run"}}).Result
+	if activities := result["activities"].([]interface{}); len(activities) != 4 {
+		t.Errorf("%d runs, want 4", len(activities))
+	}
+	result = tools.Call(LLMToolCall{Name: toolAggregateMetric, Arguments: map[string]interface{}{
+		"column": "MinutesAsleep", "function": "avg", "activity": "run"}}).Result
+	// The runs are on the days 0, 2, 4 and 6
+	if result["value"] != 430.0 || result["days"] != 4 {
+		t.Errorf("average MinutesAsleep of the days with a run = %v on %v days, want 430 on 4 days", result["value"], result["days"])
+	}
+	result = tools.Call(LLMToolCall{Name: toolCorrelate, Arguments: map[string]interface{}{
+		"column_x": "Steps", "column_y": "MinutesAsleep"}}).Result
+	if result["pearson"] != 1.0 {
+		t.Errorf("pearson = %v, want 1", result["pearson"])
+	}
+}
+
+// toolLoopProvider is a fakeProvider that calls a tool whenever the tools are available.
+type toolLoopProvider struct {
+	fakeProvider
+	rounds int
+}
+
+func (p *toolLoopProvider) GenerateStreamWithTools(ctx context.Context, conversation []LLMMessage, tools []LLMTool, temperature float32, onChunk func(chunk string) error) ([]LLMToolCall, error) {
+	if len(tools) == 0 {
+		return nil, p.GenerateStream(ctx, conversation, temperature, onChunk)
+	}
+	p.rounds++
+	return []LLMToolCall{{ID: strconv.Itoa(p.rounds), Name: toolAggregateMetric, Arguments: map[string]interface{}{
+		"column": "Steps", "function": "sum"}}}, nil
+}
+
+func TestChatToolsGenerate(t *testing.T) {
+	tools := syntheticChatTools()
+	provider := &toolLoopProvider{}
+	var reply strings.Builder
+	conversation, err := tools.Generate(context.Background(), provider, []LLMMessage{{Role: llmRoleUser, Text: "How many steps?"}},
+		func(chunk string) error {
+			reply.WriteString(chunk)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.rounds != maxToolRounds {
+		t.Errorf("%d rounds of tool calls, want %d", provider.rounds, maxToolRounds)
+	}
+	// The question, then a call and its result for every round
+	if len(conversation) != 1+2*maxToolRounds {
+		t.Errorf("%d messages in the conversation, want %d", len(conversation), 1+2*maxToolRounds)
+	}
+	if reply.Len() == 0 {
+		t.Error("no reply after the last round of tool calls")
+	}
+}
@@ -0,0 +1,270 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// conversationTitleLength is the maximum number of characters of the title of a conversation
+const conversationTitleLength = 80
+
+// conversationTitle returns the title of the conversation that starts with question.
+func conversationTitle(question string) string {
+	title := []rune(strings.Join(strings.Fields(question), " "))
+	if len(title) > conversationTitleLength {
+		return string(title[:conversationTitleLength-1]) + "…"
+	}
+	return string(title)
+}
+
+// createConversation creates the conversation of the user about the data between startDate and endDate.
+func createConversation(userID int64, startDate, endDate time.Time, title string) (*types.Conversation, error) {
+	now := time.Now().UTC()
+	conversation := types.Conversation{
+		UserID:    userID,
+		StartDate: startDate,
+		EndDate:   endDate,
+		Title:     title,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := _db.Create(&conversation); err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// userConversation returns the conversation identified by id, if it belongs to the user.
+func userConversation(userID, id int64) (*types.Conversation, error) {
+	var conversation types.Conversation
+	if err := _db.Model(types.Conversation{}).Where("id = ? AND user_id = ?", id, userID).Scan(&conversation); err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// checkConversationRange returns an error if the conversation is not about the data between
+// startDate and endDate: a conversation is resumed only with the data it is about.
+func checkConversationRange(conversation *types.Conversation, startDate, endDate time.Time) error {
+	if conversation.StartDate.Format(time.DateOnly) != startDate.Format(time.DateOnly) ||
+		conversation.EndDate.Format(time.DateOnly) != endDate.Format(time.DateOnly) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("the conversation is about the data from %s to %s",
+			conversation.StartDate.Format(time.DateOnly), conversation.EndDate.Format(time.DateOnly)))
+	}
+	return nil
+}
+
+// conversationMessages returns the messages of the conversation, in chronological order.
+func conversationMessages(conversationID int64) ([]types.Message, error) {
+	var messages []types.Message
+	if err := _db.Model(types.Message{}).Where("conversation_id = ?", conversationID).Order("id").Scan(&messages); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return messages, nil
+}
+
+// saveExchange stores the question of the user and the reply of the model in the conversation,
+// with the sources cited by the reply.
+func saveExchange(conversationID int64, question, reply string, sources []chatSource) (err error) {
+	now := time.Now().UTC()
+	tx := _db.Begin()
+	if err = tx.Create(&types.Message{ConversationID: conversationID, Role: llmRoleUser, Content: question, CreatedAt: now}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	answer := types.Message{ConversationID: conversationID, Role: llmRoleModel, Content: reply, CreatedAt: now}
+	if err = tx.Create(&answer); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for _, source := range sources {
+		if err = tx.Exec("INSERT INTO message_sources(message_id, report_id, label) VALUES (?, ?, ?)", answer.ID, source.ReportID, source.Label); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Exec("UPDATE conversations SET updated_at = ? WHERE id = ?", now, conversationID); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// conversationParam returns the conversation identified by the id parameter of the URL,
+// if it belongs to the user.
+func conversationParam(c echo.Context, user *types.User) (*types.Conversation, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid conversation id")
+	}
+	var conversation *types.Conversation
+	if conversation, err = userConversation(user.ID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "conversation not found")
+		}
+		log.Error("userConversation: ", err)
+		return nil, err
+	}
+	return conversation, nil
+}
+
+// conversationSummary is the JSON representation of a conversation, in the list of conversations.
+type conversationSummary struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Conversations returns, as JSON, the conversations of the user about the date range
+// given by the start and end query parameters (YYYY-MM-DD), the most recent first.
+func Conversations() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		var startDate, endDate time.Time
+		if startDate, err = time.Parse(time.DateOnly, c.QueryParam("start")); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid start date")
+		}
+		if endDate, err = time.Parse(time.DateOnly, c.QueryParam("end")); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid end date")
+		}
+
+		var conversations []types.Conversation
+		if err = _db.Model(types.Conversation{}).
+			Where("user_id = ? AND start_date = ? AND end_date = ?", user.ID, startDate, endDate).
+			Order("updated_at DESC").Scan(&conversations); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Error("Conversations: ", err)
+			return err
+		}
+		summaries := []conversationSummary{}
+		for _, conversation := range conversations {
+			summaries = append(summaries, conversationSummary{
+				ID:        conversation.ID,
+				Title:     conversation.Title,
+				UpdatedAt: conversation.UpdatedAt,
+			})
+		}
+		return c.JSON(http.StatusOK, summaries)
+	}
+}
+
+// DeleteConversation deletes the conversation identified by the id in the URL, with its messages.
+func DeleteConversation() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		var conversation *types.Conversation
+		if conversation, err = conversationParam(c, user); err != nil {
+			return err
+		}
+		// The messages are deleted on cascade
+		if err = _db.Model(types.Conversation{}).Exec("DELETE FROM conversations WHERE id = ?", conversation.ID); err != nil {
+			log.Error("DeleteConversation: ", err)
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// exportedMessage is the JSON representation of a message of an exported conversation.
+type exportedMessage struct {
+	Role      string       `json:"role"`
+	Content   string       `json:"content"`
+	CreatedAt time.Time    `json:"created_at"`
+	Sources   []chatSource `json:"sources,omitempty"`
+}
+
+// exportedConversation is the JSON representation of an exported conversation.
+type exportedConversation struct {
+	Title     string            `json:"title"`
+	StartDate string            `json:"start_date"`
+	EndDate   string            `json:"end_date"`
+	CreatedAt time.Time         `json:"created_at"`
+	Messages  []exportedMessage `json:"messages"`
+}
+
+// ExportConversation downloads the conversation identified by the id in the URL.
+// The format query parameter selects the format of the file: "md" (default) or "json".
+func ExportConversation() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		var conversation *types.Conversation
+		if conversation, err = conversationParam(c, user); err != nil {
+			return err
+		}
+		var messages []types.Message
+		if messages, err = conversationMessages(conversation.ID); err != nil {
+			log.Error("conversationMessages: ", err)
+			return err
+		}
+		var sources map[int64][]chatSource
+		if sources, err = messageSources(conversation.ID); err != nil {
+			log.Error("messageSources: ", err)
+			return err
+		}
+
+		exported := exportedConversation{
+			Title:     conversation.Title,
+			StartDate: conversation.StartDate.Format(time.DateOnly),
+			EndDate:   conversation.EndDate.Format(time.DateOnly),
+			CreatedAt: conversation.CreatedAt,
+			Messages:  []exportedMessage{},
+		}
+		for _, message := range messages {
+			exported.Messages = append(exported.Messages, exportedMessage{
+				Role:      message.Role,
+				Content:   message.Content,
+				CreatedAt: message.CreatedAt,
+				Sources:   sources[message.ID],
+			})
+		}
+
+		filename := fmt.Sprintf("conversation-%d", conversation.ID)
+		if c.QueryParam("format") == "json" {
+			c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename+".json"))
+			return c.JSONPretty(http.StatusOK, exported, "  ")
+		}
+
+		var builder strings.Builder
+		fmt.Fprintf(&builder, "# %s\n\n", exported.Title)
+		fmt.Fprintf(&builder, "Data from %s to %s.\n\n", exported.StartDate, exported.EndDate)
+		for _, message := range exported.Messages {
+			author := "You"
+			if message.Role == llmRoleModel {
+				author = "Assistant"
+			}
+			fmt.Fprintf(&builder, "## %s (%s)\n\n%s\n\n", author, message.CreatedAt.Format(time.DateTime), strings.TrimSpace(message.Content))
+			for _, source := range message.Sources {
+				fmt.Fprintf(&builder, "[%d]: %s \"%s report from %s to %s\"\n", source.Label, source.URL, source.ReportType, source.StartDate, source.EndDate)
+			}
+			if len(message.Sources) > 0 {
+				fmt.Fprintln(&builder, "")
+			}
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename+".md"))
+		return c.Blob(http.StatusOK, "text/markdown; charset=utf-8", []byte(builder.String()))
+	}
+}
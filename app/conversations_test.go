@@ -0,0 +1,185 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/echo/v4"
+)
+
+func TestCheckConversationRange(t *testing.T) {
+	start := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 6)
+	conversation := &types.Conversation{StartDate: start, EndDate: end}
+	for _, tc := range []struct {
+		name       string
+		start, end time.Time
+		wantErr    bool
+	}{
+		{"same range", start, end, false},
+		{"other start", start.AddDate(0, 0, -1), end, true},
+		{"other end", start, end.AddDate(0, 0, 1), true},
+		{"other range", end, end.AddDate(0, 0, 6), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkConversationRange(conversation, tc.start, tc.end)
+			if !tc.wantErr {
+				if err != nil {
+					t.Errorf("checkConversationRange() = %v, want nil", err)
+				}
+				return
+			}
+			var httpErr *echo.HTTPError
+			if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+				t.Errorf("checkConversationRange() = %v, want a bad request", err)
+			}
+		})
+	}
+}
+
+// conversationRequest executes the handler with the request of the user.
+func conversationRequest(t *testing.T, user *types.User, handler echo.HandlerFunc, method, target, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	authorizer := newFitbitAuthorizer()
+	authorizer.SetToken(&user.AuthorizedUser.AuthorizedUser)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(method, target, nil), rec)
+	c.Set("fitbit", authorizer)
+	if id != "" {
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+	}
+	if err := handler(c); err != nil {
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) {
+			t.Fatal(err)
+		}
+		rec.Code = httpErr.Code
+	}
+	return rec
+}
+
+// testConversation creates a conversation of the user about the week, with an exchange
+// whose reply cites a report.
+func testConversation(t *testing.T, user *types.User, start time.Time, question string) *types.Conversation {
+	t.Helper()
+	conversation, err := createConversation(user.ID, start, start.AddDate(0, 0, 6), conversationTitle(question))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := types.Report{UserID: user.ID, StartDate: start, EndDate: start, ReportType: reportTypeDaily, Report: "report"}
+	if err = _db.Create(&report); err != nil {
+		t.Fatal(err)
+	}
+	if err = saveExchange(conversation.ID, question, "You slept 7 hours [1].", []chatSource{newChatSource(1, report)}); err != nil {
+		t.Fatal(err)
+	}
+	return conversation
+}
+
+func TestConversations(t *testing.T) {
+	user := testDBUser(t)
+	other := testDBUser(t)
+	week := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	first := testConversation(t, user, week, "How did I sleep?")
+	second := testConversation(t, user, week, "Did I walk enough?")
+	testConversation(t, user, week.AddDate(0, 0, 7), "And the next week?")
+	testConversation(t, other, week, "How did the other user sleep?")
+
+	// Only the conversations of the user about the range, the most recent first
+	rec := conversationRequest(t, user, Conversations(), http.MethodGet, "/conversations?start=2024-03-04&end=2024-03-10", "")
+	var summaries []conversationSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summaries); err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 2 || summaries[0].ID != second.ID || summaries[1].ID != first.ID {
+		t.Errorf("conversations %+v, want %d and %d", summaries, second.ID, first.ID)
+	}
+	if summaries[1].Title != "How did I sleep?" {
+		t.Errorf("title %q, want the first question", summaries[1].Title)
+	}
+	if rec = conversationRequest(t, user, Conversations(), http.MethodGet, "/conversations?start=2024-03-04", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d without the end date, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDeleteConversation(t *testing.T) {
+	user := testDBUser(t)
+	other := testDBUser(t)
+	week := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	conversation := testConversation(t, user, week, "How did I sleep?")
+	id := fmt.Sprint(conversation.ID)
+
+	// The conversations of the other users are not found
+	if rec := conversationRequest(t, other, DeleteConversation(), http.MethodDelete, "/conversations/"+id, id); rec.Code != http.StatusNotFound {
+		t.Errorf("status %d deleting the conversation of another user, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := conversationRequest(t, user, DeleteConversation(), http.MethodDelete, "/conversations/nope", "nope"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d with an invalid id, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if rec := conversationRequest(t, user, DeleteConversation(), http.MethodDelete, "/conversations/"+id, id); rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if _, err := userConversation(user.ID, conversation.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("userConversation() after the deletion = %v, want sql.ErrNoRows", err)
+	}
+	// The messages are deleted with the conversation
+	if messages, err := conversationMessages(conversation.ID); err != nil || len(messages) != 0 {
+		t.Errorf("%d messages after the deletion (%v), want none", len(messages), err)
+	}
+}
+
+func TestExportConversation(t *testing.T) {
+	user := testDBUser(t)
+	week := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	conversation := testConversation(t, user, week, "How did I sleep?")
+	id := fmt.Sprint(conversation.ID)
+
+	rec := conversationRequest(t, user, ExportConversation(), http.MethodGet, "/conversations/"+id+"/export?format=json", id)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", rec.Code, http.StatusOK)
+	}
+	if disposition := rec.Header().Get(echo.HeaderContentDisposition); !strings.Contains(disposition, fmt.Sprintf("conversation-%d.json", conversation.ID)) {
+		t.Errorf("Content-Disposition %q, want the JSON file of the conversation", disposition)
+	}
+	var exported exportedConversation
+	if err := json.Unmarshal(rec.Body.Bytes(), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if exported.Title != "How did I sleep?" || exported.StartDate != "2024-03-04" || exported.EndDate != "2024-03-10" {
+		t.Errorf("exported %+v, want the conversation about the week of 2024-03-04", exported)
+	}
+	if len(exported.Messages) != 2 || exported.Messages[0].Role != llmRoleUser || exported.Messages[1].Role != llmRoleModel {
+		t.Fatalf("exported messages %+v, want the question and the reply", exported.Messages)
+	}
+	if sources := exported.Messages[1].Sources; len(sources) != 1 || sources[0].URL != "/dashboard/2024/03/04/2024/03/04" {
+		t.Errorf("sources of the reply %+v, want the daily report of 2024-03-04", sources)
+	}
+
+	// Markdown by default
+	rec = conversationRequest(t, user, ExportConversation(), http.MethodGet, "/conversations/"+id+"/export", id)
+	markdown := rec.Body.String()
+	for _, want := range []string{
+		"# How did I sleep?\n",
+		"Data from 2024-03-04 to 2024-03-10.",
+		"You slept 7 hours [1].",
+		`[1]: /dashboard/2024/03/04/2024/03/04 "daily report from 2024-03-04 to 2024-03-04"`,
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("the markdown export doesn't contain %q:\n%s", want, markdown)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -40,21 +41,16 @@ func dashboard(c echo.Context, user *types.User, startDate, endDate time.Time, c
 		return err
 	}
 
+	// While the user is dumping, the dashboard shows the data imported so far
+	var dumping bool
+	if dumping, err = fetcher.isDumping(); err != nil {
+		log.Error("fetcher.isDumping: ", err)
+		return err
+	}
 	var allData []*UserData
-	if allData, err = fetcher.FetchByRange(startDate, endDate); err != nil {
-		var fetcherError *FetcherError
-		if errors.As(err, &fetcherError) {
-			return c.Render(http.StatusOK, "dashboard/dashboard", echo.Map{
-				"title":      "Dashboard - FitSleepInsights",
-				"isLoggedIn": true,
-				"startDate":  startDate.Format(time.DateOnly),
-				"endDate":    endDate.Format(time.DateOnly),
-				"dumping":    true,
-			})
-		} else {
-			log.Error("fetcher.FetchByRange: ", err, " - ", user.ID, " - ", startDate, " - ", endDate)
-			return err
-		}
+	if allData, err = fetcher.FetchPartialByRange(startDate, endDate); err != nil {
+		log.Error("fetcher.FetchPartialByRange: ", err)
+		return err
 	}
 
 	var activitiesTypes []UserActivityTypes
@@ -88,7 +84,7 @@ func dashboard(c echo.Context, user *types.User, startDate, endDate time.Time, c
 			go func(activityType UserActivityTypes) {
 				defer wg.Done()
 				chart := activityCalendar(&activityType, &activityList, calendarType)
-				chart.Renderer = newChartRenderer(chart, chart.Validate)
+				chart.Renderer = newChartRenderer(chart, chart.Validate, activityLink(chart, &activityList))
 
 				mapMux.Lock()
 				activityCalendars[activityType.Name] = renderChart(chart)
@@ -113,7 +109,7 @@ func dashboard(c echo.Context, user *types.User, startDate, endDate time.Time, c
 	go func() {
 		defer wg.Done()
 		sleepBoard = sleepDashboard(allData, calendarType)
-		sleepBoard.AggregatedStages.Renderer = newChartRenderer(sleepBoard.AggregatedStages, sleepBoard.AggregatedStages.Validate)
+		sleepBoard.AggregatedStages.Renderer = newChartRenderer(sleepBoard.AggregatedStages, sleepBoard.AggregatedStages.Validate, sleepNightLink(sleepBoard.AggregatedStages))
 		sleepBoard.Efficiency.Renderer = newChartRenderer(sleepBoard.Efficiency, sleepBoard.Efficiency.Validate)
 		sleepBoard.HeartRateVariabilityDeepSleep.Renderer = newChartRenderer(sleepBoard.HeartRateVariabilityDeepSleep, sleepBoard.HeartRateVariabilityDeepSleep.Validate)
 	}()
@@ -138,7 +134,7 @@ func dashboard(c echo.Context, user *types.User, startDate, endDate time.Time, c
 		"isLoggedIn": true,
 		"startDate":  startDate.Format(time.DateOnly),
 		"endDate":    endDate.Format(time.DateOnly),
-		"dumping":    false,
+		"dumping":    dumping,
 
 		"sleepEfficiencyChart": renderChart(sleepBoard.Efficiency),
 		"sleepAggregatedChart": renderChart(sleepBoard.AggregatedStages),
@@ -298,3 +294,123 @@ func CustomDashboard() echo.HandlerFunc {
 		return dashboard(c, user, startDate, endDate, calendarType)
 	}
 }
+
+// SleepNight renders the detail of the night of the date in the URL: the hypnogram
+// overlaid with the heart rate and the heart rate variability of the night, and the naps of the day.
+func SleepNight() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			log.Error("SleepNight - getUser: ", err)
+			return err
+		}
+
+		var date time.Time
+		if date, err = time.Parse(time.DateOnly, fmt.Sprintf("%s-%s-%s", c.Param("year"), c.Param("month"), c.Param("day"))); err != nil {
+			log.Error("SleepNight - time.Parse: ", err)
+			return err
+		}
+
+		var fetcher *fetcher
+		if fetcher, err = NewFetcher(user); err != nil {
+			log.Error("NewFetcher: ", err)
+			return err
+		}
+
+		data := echo.Map{
+			"title":      "Sleep - FitSleepInsights",
+			"isLoggedIn": true,
+			"date":       date.Format(time.DateOnly),
+			"startDate":  GetStartDayOfWeek(date).Format("2006/01/02"),
+		}
+
+		var sleepLogs []*types.SleepLog
+		if sleepLogs, err = fetcher.userSleepLogList(date); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			// No sleep data for this night
+			return c.Render(http.StatusOK, "dashboard/sleep_night", data)
+		}
+		// The chart shows the main sleep, or the first nap when there's no main sleep.
+		// The other sleep sessions are listed below the chart.
+		sleepLog := sleepLogs[0]
+		data["otherSleepLogs"] = sleepLogs[1:]
+
+		// The intraday data could be missing: the chart contains only the hypnogram
+		heartRate, _ := fetcher.HeartRateIntraday(sleepLog.StartTime, sleepLog.EndTime)
+		hrv, _ := fetcher.HeartRateVariabilityIntraday(sleepLog.StartTime, sleepLog.EndTime)
+
+		chart := sleepNightChart(sleepLog, heartRate, hrv)
+		chart.Renderer = newChartRenderer(chart, chart.Validate)
+
+		data["sleepLog"] = sleepLog
+		data["sleepNightChart"] = renderChart(chart)
+
+		// What helped and what hurt the sleep, if there's an explainable predictor
+		if day, err := fetcher.FetchByDate(date); err == nil {
+			if explanation, err := ExplainPrediction(user, "SleepEfficiency", day); err == nil {
+				data["explanation"] = explanation
+			} else if !errors.Is(err, errNoExplanation) {
+				log.Error("SleepNight - ExplainPrediction: ", err)
+			}
+		}
+		return c.Render(http.StatusOK, "dashboard/sleep_night", data)
+	}
+}
+
+// ActivityDetail renders the detail of the activity identified by the id in the URL:
+// its route, elevation profile and heart rate, from the trackpoints of its TCX.
+func ActivityDetail() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			log.Error("ActivityDetail - getUser: ", err)
+			return err
+		}
+
+		var logID int64
+		if logID, err = strconv.ParseInt(c.Param("id"), 10, 64); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid activity id")
+		}
+
+		var fetcher *fetcher
+		if fetcher, err = NewFetcher(user); err != nil {
+			log.Error("NewFetcher: ", err)
+			return err
+		}
+
+		var activity *types.ActivityLog
+		if activity, err = fetcher.ActivityLog(logID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "activity not found")
+			}
+			log.Error("ActivityDetail - ActivityLog: ", err)
+			return err
+		}
+
+		var trackpoints []types.ActivityTrackpoint
+		if trackpoints, err = fetcher.ActivityTrackpoints(logID); err != nil {
+			log.Error("ActivityDetail - ActivityTrackpoints: ", err)
+			return err
+		}
+
+		data := echo.Map{
+			"title":      fmt.Sprintf("%s - FitSleepInsights", activity.ActivityName),
+			"isLoggedIn": true,
+			"activity":   activity,
+			"date":       activity.StartTime.Format(time.DateOnly),
+			"startDate":  GetStartDayOfWeek(activity.StartTime).Format("2006/01/02"),
+		}
+		if len(trackpoints) > 0 {
+			if route := activityRouteChart(trackpoints); route != nil {
+				route.Renderer = newChartRenderer(route, route.Validate)
+				data["routeChart"] = renderChart(route)
+			}
+			profile := activityProfileChart(trackpoints)
+			profile.Renderer = newChartRenderer(profile, profile.Validate)
+			data["profileChart"] = renderChart(profile)
+		}
+		return c.Render(http.StatusOK, "dashboard/activity_detail", data)
+	}
+}
@@ -1,11 +1,13 @@
 package app
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/galeone/fitsleepinsights/database/types"
 	"github.com/go-echarts/go-echarts/v2/charts"
 	"github.com/go-echarts/go-echarts/v2/opts"
 )
@@ -321,3 +323,122 @@ func activityStats(activities *DailyActivities) *ActivityStats {
 	return &stats
 
 }
+
+// activityLink returns a function that makes every cell of the activity calendar a link to
+// the detail of the first activity of the clicked date. It must be executed after chart.Validate
+// (that sets the ChartID).
+func activityLink(chart *charts.HeatMap, activities *DailyActivities) func() {
+	return func() {
+		logIDs := make(map[string]int64)
+		for _, activity := range *activities {
+			date := activity.StartTime.Format(time.DateOnly)
+			if _, ok := logIDs[date]; !ok {
+				logIDs[date] = activity.LogID
+			}
+		}
+		// Marshaling a map of strings to integers can't fail
+		ids, _ := json.Marshal(logIDs)
+		chart.AddJSFuncs(fmt.Sprintf(
+			`echarts_%s.on("click", function (params) { const ids = %s; if (ids[params.name]) { window.location.href = "/dashboard/activity/" + ids[params.name]; } });`,
+			chart.ChartID, ids))
+	}
+}
+
+// activityChartSettings returns the global settings of the charts of the activity detail.
+func activityChartSettings(title string) []charts.GlobalOpts {
+	return []charts.GlobalOpts{
+		charts.WithInitializationOpts(opts.Initialization{
+			Theme:  "dark",
+			Height: "400px",
+			Width:  "100%",
+		}),
+		charts.WithTitleOpts(globalTitleSettings(title)),
+		charts.WithLegendOpts(globalLegendSettings()),
+		charts.WithTooltipOpts(opts.Tooltip{
+			Trigger: "axis",
+			Show:    true,
+		}),
+		charts.WithDataZoomOpts(opts.DataZoom{
+			Type: "inside",
+		}),
+	}
+}
+
+// activityRouteChart returns the route of the activity, drawn as longitude/latitude pairs
+// on plain value axes: no map tiles are required.
+// It returns nil if the trackpoints have no position.
+func activityRouteChart(trackpoints []types.ActivityTrackpoint) *charts.Line {
+	var route []opts.LineData
+	for _, point := range trackpoints {
+		if point.Latitude.Valid && point.Longitude.Valid {
+			route = append(route, opts.LineData{Value: []interface{}{point.Longitude.Float64, point.Latitude.Float64}})
+		}
+	}
+	if len(route) == 0 {
+		return nil
+	}
+
+	chart := charts.NewLine()
+	chart.SetGlobalOptions(append(activityChartSettings("Route"),
+		charts.WithXAxisOpts(opts.XAxis{
+			Name:  "Longitude",
+			Type:  "value",
+			Scale: true,
+		}),
+		charts.WithYAxisOpts(opts.YAxis{
+			Name:  "Latitude",
+			Type:  "value",
+			Scale: true,
+		}),
+	)...)
+	chart.AddSeries("Route", route, charts.WithLineChartOpts(opts.LineChart{
+		Color: "#1976D2",
+	}))
+	return chart
+}
+
+// activityProfileChart returns the elevation profile of the activity and its heart rate,
+// over the distance covered.
+func activityProfileChart(trackpoints []types.ActivityTrackpoint) *charts.Line {
+	var elevation []opts.LineData
+	var heartRate []opts.LineData
+	for _, point := range trackpoints {
+		km := twoDecimals(point.Distance / 1000)
+		if point.Altitude.Valid {
+			elevation = append(elevation, opts.LineData{Value: []interface{}{km, twoDecimals(point.Altitude.Float64)}})
+		}
+		if point.HeartRate > 0 {
+			heartRate = append(heartRate, opts.LineData{Value: []interface{}{km, point.HeartRate}})
+		}
+	}
+
+	chart := charts.NewLine()
+	chart.SetGlobalOptions(append(activityChartSettings("Elevation and Heart Rate"),
+		charts.WithXAxisOpts(opts.XAxis{
+			Name: "km",
+			Type: "value",
+		}),
+		charts.WithYAxisOpts(opts.YAxis{
+			Name:  "m",
+			Type:  "value",
+			Scale: true,
+		}),
+	)...)
+	chart.ExtendYAxis(opts.YAxis{
+		Name:  "bpm",
+		Type:  "value",
+		Scale: true,
+	})
+
+	chart.AddSeries("Elevation", elevation, charts.WithLineChartOpts(opts.LineChart{
+		Color: "#C59972",
+	}), charts.WithAreaStyleOpts(opts.AreaStyle{
+		Opacity: 0.3,
+	}))
+	chart.AddSeries("Heart Rate", heartRate, charts.WithLineChartOpts(opts.LineChart{
+		YAxisIndex: 1,
+		Smooth:     true,
+		Color:      "#AA0000",
+	}))
+	return chart
+}
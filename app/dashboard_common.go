@@ -9,10 +9,8 @@ import (
 	"strings"
 	"time"
 
-	"cloud.google.com/go/vertexai/genai"
 	"github.com/go-echarts/go-echarts/v2/charts"
 	"github.com/go-echarts/go-echarts/v2/opts"
-	"google.golang.org/api/option"
 )
 
 type CalendarType int
@@ -219,22 +217,11 @@ func describeChartContent(chart *charts.BaseConfiguration, chartType string, add
 	description := builder.String()
 
 	ctx := context.Background()
-	var client *genai.Client
-	var err error
-	const region = "us-central1"
-	if client, err = genai.NewClient(ctx, _vaiProjectID, region, option.WithCredentialsFile(_vaiServiceAccountKey)); err != nil {
+	llm, err := newLLMProvider(ctx)
+	if err != nil {
 		return "", err
 	}
-	defer client.Close()
+	defer llm.Close()
 
-	model := client.GenerativeModel("gemini-2.0-flash")
-	var resp *genai.GenerateContentResponse
-	if resp, err = model.GenerateContent(ctx, genai.Text(description)); err != nil {
-		return "", err
-	}
-	if len(resp.Candidates) == 0 {
-		return "", fmt.Errorf("no candidates returned")
-	}
-
-	return fmt.Sprint(resp.Candidates[0].Content.Parts[0]), nil
+	return llm.Generate(ctx, []LLMMessage{{Role: llmRoleUser, Text: description}}, ChatTemperature)
 }
@@ -1,8 +1,12 @@
 package app
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/galeone/fitsleepinsights/database/types"
 	"github.com/go-echarts/go-echarts/v2/charts"
 	"github.com/go-echarts/go-echarts/v2/opts"
 )
@@ -13,6 +17,9 @@ type SleepStats struct {
 	AverageDuration  float64
 	MaxDuration      float64
 	MinDuration      float64
+	// Naps is the number of naps in the period, and AverageNapDuration their average minutes asleep
+	Naps               int64
+	AverageNapDuration float64
 }
 
 type SleepDashboard struct {
@@ -30,6 +37,7 @@ func sleepDashboard(all []*UserData, calendarType CalendarType) *SleepDashboard
 	var lightSleepMinutes []opts.BarData
 	var remSleepMinutes []opts.BarData
 	var wakeSleepMinutes []opts.BarData
+	var napsMinutes []opts.BarData
 
 	var sleepEfficiency []opts.LineData
 	var heartRateVariability []opts.LineData
@@ -43,7 +51,27 @@ func sleepDashboard(all []*UserData, calendarType CalendarType) *SleepDashboard
 	var location *time.Location
 
 	for _, dayData := range all {
-		if dayData == nil || dayData.SleepLog == nil {
+		if dayData == nil {
+			continue
+		}
+		// The naps are counted also on the days without a main sleep
+		naps := dayData.Naps()
+		var napMinutes int64
+		for _, nap := range naps {
+			napMinutes += nap.MinutesAsleep
+			stats.Naps++
+		}
+		stats.AverageNapDuration += float64(napMinutes)
+		if dayData.SleepLog == nil {
+			if len(naps) > 0 {
+				// The day is in the charts with the naps only: "-" is an empty value for ECharts
+				dates = append(dates, dayData.Date.Format(time.DateOnly))
+				for _, series := range []*[]opts.BarData{&minutesAsleep, &deepSleepMinutes, &lightSleepMinutes, &remSleepMinutes, &wakeSleepMinutes} {
+					*series = append(*series, opts.BarData{Value: "-"})
+				}
+				napsMinutes = append(napsMinutes, opts.BarData{Value: napMinutes})
+				sleepEfficiency = append(sleepEfficiency, opts.LineData{Value: "-"})
+			}
 			continue
 		}
 		counter++
@@ -56,6 +84,8 @@ func sleepDashboard(all []*UserData, calendarType CalendarType) *SleepDashboard
 		remSleepMinutes = append(remSleepMinutes, opts.BarData{Value: dayData.SleepLog.Levels.Summary.Rem.Minutes})
 		wakeSleepMinutes = append(wakeSleepMinutes, opts.BarData{Value: dayData.SleepLog.Levels.Summary.Wake.Minutes})
 
+		napsMinutes = append(napsMinutes, opts.BarData{Value: napMinutes})
+
 		sleepEfficiency = append(sleepEfficiency, opts.LineData{Value: dayData.SleepLog.Efficiency})
 
 		realDurationInMinutes := float64(dayData.SleepLog.Duration)*msToMin - float64(dayData.SleepLog.MinutesAwake)
@@ -87,6 +117,9 @@ func sleepDashboard(all []*UserData, calendarType CalendarType) *SleepDashboard
 		stats.AverageStartTime = time.Unix(unixStartTime/counter, 0).In(location)
 		stats.AverageEndTime = time.Unix(unixEndTime/counter, 0).In(location)
 	}
+	if stats.Naps > 0 {
+		stats.AverageNapDuration = stats.AverageNapDuration / float64(stats.Naps)
+	}
 
 	aggregatedStackedBarChart := charts.NewBar()
 
@@ -125,6 +158,11 @@ func sleepDashboard(all []*UserData, calendarType CalendarType) *SleepDashboard
 		Stack: "sleepPhases",
 		Color: "#AA0000",
 	}))
+	// Naps are not part of the main sleep: they have their own stack
+	aggregatedStackedBarChart.AddSeries("Naps", napsMinutes, charts.WithLineChartOpts(opts.LineChart{
+		Stack: "naps",
+		Color: "#7E57C2",
+	}))
 
 	sleepEfficiencyLineChart := charts.NewLine()
 	sleepEfficiencyLineChart.SetGlobalOptions(
@@ -171,6 +209,127 @@ func sleepDashboard(all []*UserData, calendarType CalendarType) *SleepDashboard
 	}
 }
 
+// sleepNightLink returns a function that makes every bar of the chart a link to the
+// night of the clicked date. It must be executed after chart.Validate (that sets the ChartID).
+func sleepNightLink(chart *charts.Bar) func() {
+	return func() {
+		chart.AddJSFuncs(fmt.Sprintf(
+			`echarts_%s.on("click", function (params) { window.location.href = "/dashboard/sleep/" + params.name.replaceAll("-", "/"); });`,
+			chart.ChartID))
+	}
+}
+
+// sleepStages returns the stages of the sleep log, ordered from the deepest to the wake stage.
+func sleepStages(sleepLog *types.SleepLog) []string {
+	if sleepLog.Type == "classic" {
+		return []string{"asleep", "restless", "awake"}
+	}
+	return []string{"deep", "light", "rem", "wake"}
+}
+
+// chartTime formats t (in the timezone of the user) in a format parsed by ECharts as local time.
+func chartTime(t time.Time) string {
+	return t.Format(time.DateTime)
+}
+
+// hypnogram returns the sleep stage of the sleep log at every change of stage.
+// The levels data contains both the long and the short (wake periods of at most 3 minutes)
+// stages, that overlap: every 30 seconds of the night (the granularity of Fitbit) is assigned
+// to the shortest stage containing it.
+func hypnogram(sleepLog *types.SleepLog) []opts.LineData {
+	const step = 30 * time.Second
+	if !sleepLog.EndTime.After(sleepLog.StartTime) {
+		return nil
+	}
+	slots := make([]string, int(sleepLog.EndTime.Sub(sleepLog.StartTime)/step)+1)
+
+	data := append(sleepLog.Levels.Data[:0:0], sleepLog.Levels.Data...)
+	sort.SliceStable(data, func(i, j int) bool { return data[i].Seconds > data[j].Seconds })
+	for _, stage := range data {
+		start := int(stage.DateTime.Sub(sleepLog.StartTime) / step)
+		end := start + int(stage.Seconds/int64(step.Seconds()))
+		for slot := start; slot < end && slot < len(slots); slot++ {
+			if slot >= 0 {
+				slots[slot] = strings.ToLower(stage.Level)
+			}
+		}
+	}
+
+	var points []opts.LineData
+	previous := ""
+	for slot, level := range slots {
+		if level == "" || level == previous {
+			continue
+		}
+		points = append(points, opts.LineData{Value: []interface{}{chartTime(sleepLog.StartTime.Add(time.Duration(slot) * step)), level}})
+		previous = level
+	}
+	if previous != "" {
+		points = append(points, opts.LineData{Value: []interface{}{chartTime(sleepLog.EndTime), previous}})
+	}
+	return points
+}
+
+// sleepNightChart returns the hypnogram of the sleep log, overlaid with the heart rate
+// and the heart rate variability measured during the night.
+func sleepNightChart(sleepLog *types.SleepLog, heartRate []types.HeartRateIntraday, hrv []types.HeartRateVariabilityIntradayHRV) *charts.Line {
+	chart := charts.NewLine()
+	chart.SetGlobalOptions(
+		charts.WithInitializationOpts(opts.Initialization{
+			Theme:  "dark",
+			Height: "500px",
+			Width:  "100%",
+		}),
+		charts.WithTitleOpts(globalTitleSettings(fmt.Sprintf("Night of %s", sleepLog.DateOfSleep.Format(time.DateOnly)))),
+		charts.WithLegendOpts(globalLegendSettings()),
+		charts.WithTooltipOpts(opts.Tooltip{
+			Trigger: "axis",
+			Show:    true,
+		}),
+		charts.WithDataZoomOpts(opts.DataZoom{
+			Type: "inside",
+		}),
+		charts.WithXAxisOpts(opts.XAxis{
+			Type: "time",
+		}),
+		charts.WithYAxisOpts(opts.YAxis{
+			Type: "category",
+			Data: sleepStages(sleepLog),
+		}),
+	)
+	chart.ExtendYAxis(opts.YAxis{
+		Name:  "bpm / ms",
+		Type:  "value",
+		Scale: true,
+	})
+
+	chart.AddSeries("Stage", hypnogram(sleepLog), charts.WithLineChartOpts(opts.LineChart{
+		Step:  "end",
+		Color: "#1976D2",
+	}))
+
+	var heartRateData []opts.LineData
+	for _, minute := range heartRate {
+		heartRateData = append(heartRateData, opts.LineData{Value: []interface{}{chartTime(minute.DateTime), twoDecimals(minute.Value)}})
+	}
+	chart.AddSeries("Heart Rate", heartRateData, charts.WithLineChartOpts(opts.LineChart{
+		YAxisIndex: 1,
+		Smooth:     true,
+		Color:      "#AA0000",
+	}))
+
+	var hrvData []opts.LineData
+	for _, minute := range hrv {
+		hrvData = append(hrvData, opts.LineData{Value: []interface{}{chartTime(minute.DateTime), twoDecimals(minute.Rmssd)}})
+	}
+	chart.AddSeries("HRV (RMSSD)", hrvData, charts.WithLineChartOpts(opts.LineChart{
+		YAxisIndex: 1,
+		Smooth:     true,
+		Color:      "#C59972",
+	}))
+	return chart
+}
+
 /*
 	predictions, err := PredictSleepEfficiency(user, all)
 	if err != nil {
@@ -0,0 +1,190 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	fitbit_types "github.com/galeone/fitbit/v2/types"
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/go-echarts/go-echarts/v2/opts"
+)
+
+func TestSleepDashboardNaps(t *testing.T) {
+	// A day with a main sleep and two naps of 35 minutes, then a day with a nap of 50 minutes only
+	nextDay := reportDate.AddDate(0, 0, 1)
+	nap := &types.SleepLog{StartTime: nextDay.Add(14 * time.Hour), EndTime: nextDay.Add(15 * time.Hour)}
+	nap.MinutesAsleep = 50
+	napOnly := &UserData{Date: nextDay, SleepLogs: []*types.SleepLog{nap}}
+
+	board := sleepDashboard([]*UserData{napsReportDay(), napOnly, {Date: nextDay.AddDate(0, 0, 1)}}, MonthlyCalendar)
+	if board.Stats.Naps != 3 {
+		t.Errorf("%d naps, want 3", board.Stats.Naps)
+	}
+	if want := (35 + 35 + 50) / 3.0; board.Stats.AverageNapDuration != want {
+		t.Errorf("average nap duration = %v, want %v", board.Stats.AverageNapDuration, want)
+	}
+	// The statistics of the main sleep are computed on the days with a main sleep only
+	if board.Stats.MinDuration != board.Stats.MaxDuration {
+		t.Errorf("the main sleep statistics include the day without a main sleep: min %v, max %v", board.Stats.MinDuration, board.Stats.MaxDuration)
+	}
+	// The days without sleep are not in the charts
+	for _, series := range board.AggregatedStages.MultiSeries {
+		if len(series.Data.([]opts.BarData)) != 2 {
+			t.Errorf("the %s series has %d values, want 2", series.Name, len(series.Data.([]opts.BarData)))
+		}
+	}
+}
+
+// testNight returns a night of the 4th of March 2024 with stages, from 23:00 to 01:00: 30 minutes
+// of light sleep, an hour of deep sleep interrupted by a minute awake, then 30 minutes of REM sleep.
+func testNight() *types.SleepLog {
+	start := time.Date(2024, time.March, 3, 23, 0, 0, 0, time.UTC)
+	stage := func(offset time.Duration, level string, duration time.Duration) fitbit_types.SleepData {
+		return fitbit_types.SleepData{DateTime: fitbit_types.FitbitDateTime{Time: start.Add(offset)}, Level: level, Seconds: int64(duration.Seconds())}
+	}
+	night := &types.SleepLog{StartTime: start, EndTime: start.Add(2 * time.Hour)}
+	night.Type = "stages"
+	night.DateOfSleep = time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	night.Levels.Data = []fitbit_types.SleepData{
+		stage(0, "light", 30*time.Minute),
+		stage(30*time.Minute, "deep", time.Hour),
+		stage(90*time.Minute, "rem", 30*time.Minute),
+	}
+	// The short wake periods overlap the long stages
+	night.Levels.ShortData = []fitbit_types.SleepData{stage(40*time.Minute, "wake", time.Minute)}
+	night.Levels.Data = append(night.Levels.Data, night.Levels.ShortData...)
+	return night
+}
+
+func TestHypnogram(t *testing.T) {
+	want := [][]interface{}{
+		{"2024-03-03 23:00:00", "light"},
+		{"2024-03-03 23:30:00", "deep"},
+		{"2024-03-03 23:40:00", "wake"},
+		{"2024-03-03 23:41:00", "deep"},
+		{"2024-03-04 00:30:00", "rem"},
+		// The last stage lasts until the end of the night
+		{"2024-03-04 01:00:00", "rem"},
+	}
+	points := hypnogram(testNight())
+	if len(points) != len(want) {
+		t.Fatalf("hypnogram() = %v, want %v", points, want)
+	}
+	for i, point := range points {
+		if value := point.Value.([]interface{}); value[0] != want[i][0] || value[1] != want[i][1] {
+			t.Errorf("point %d = %v, want %v", i, value, want[i])
+		}
+	}
+
+	// The stages are case insensitive, and the stages that overflow the night are truncated
+	night := testNight()
+	night.Levels.Data = []fitbit_types.SleepData{{DateTime: fitbit_types.FitbitDateTime{Time: night.StartTime}, Level: "DEEP", Seconds: 3 * 3600}}
+	points = hypnogram(night)
+	if len(points) != 2 || points[0].Value.([]interface{})[1] != "deep" || points[1].Value.([]interface{})[0] != "2024-03-04 01:00:00" {
+		t.Errorf("hypnogram() of a stage longer than the night = %v, want deep until 01:00", points)
+	}
+
+	// A night without duration has no hypnogram
+	night.EndTime = night.StartTime
+	if points = hypnogram(night); points != nil {
+		t.Errorf("hypnogram() of a night without duration = %v, want nil", points)
+	}
+}
+
+func TestSleepStages(t *testing.T) {
+	if stages := sleepStages(testNight()); strings.Join(stages, " ") != "deep light rem wake" {
+		t.Errorf("sleepStages() = %v, want the stages from deep to wake", stages)
+	}
+	classic := &types.SleepLog{}
+	classic.Type = "classic"
+	if stages := sleepStages(classic); strings.Join(stages, " ") != "asleep restless awake" {
+		t.Errorf("sleepStages() of a classic log = %v, want the classic stages", stages)
+	}
+}
+
+func TestSleepNightChart(t *testing.T) {
+	night := testNight()
+	heartRate := []types.HeartRateIntraday{
+		{DateTime: night.StartTime, Value: 62.456},
+		{DateTime: night.StartTime.Add(time.Minute), Value: 58},
+	}
+	hrv := []types.HeartRateVariabilityIntradayHRV{{DateTime: night.StartTime.Add(5 * time.Minute), Rmssd: 41.238}}
+	chart := sleepNightChart(night, heartRate, hrv)
+
+	if len(chart.MultiSeries) != 3 {
+		t.Fatalf("%d series, want the stages, the heart rate and the HRV", len(chart.MultiSeries))
+	}
+	for i, want := range []struct {
+		name       string
+		yAxisIndex int
+		values     [][]interface{}
+	}{
+		{"Stage", 0, nil},
+		{"Heart Rate", 1, [][]interface{}{{"2024-03-03 23:00:00", 62.46}, {"2024-03-03 23:01:00", 58.0}}},
+		{"HRV (RMSSD)", 1, [][]interface{}{{"2024-03-03 23:05:00", 41.24}}},
+	} {
+		series := chart.MultiSeries[i]
+		if series.Name != want.name || series.YAxisIndex != want.yAxisIndex {
+			t.Errorf("series %d is %q on the axis %d, want %q on the axis %d", i, series.Name, series.YAxisIndex, want.name, want.yAxisIndex)
+		}
+		if want.values == nil {
+			continue
+		}
+		data := series.Data.([]opts.LineData)
+		if len(data) != len(want.values) {
+			t.Errorf("the %s series has %d values, want %d", series.Name, len(data), len(want.values))
+			continue
+		}
+		for j, point := range data {
+			if value := point.Value.([]interface{}); value[0] != want.values[j][0] || value[1] != want.values[j][1] {
+				t.Errorf("the %s series value %d = %v, want %v", series.Name, j, value, want.values[j])
+			}
+		}
+	}
+	// The stages are the categories of the first axis, the heart rate and the HRV share the second one
+	if len(chart.YAxisList) != 2 || len(chart.YAxisList[0].Data.([]string)) != 4 || chart.YAxisList[1].Type != "value" {
+		t.Errorf("y axes %+v, want the stages and the values", chart.YAxisList)
+	}
+	if points := chart.MultiSeries[0].Data.([]opts.LineData); len(points) != len(hypnogram(night)) {
+		t.Errorf("the Stage series has %d points, want the hypnogram", len(points))
+	}
+}
+
+func TestSleepNightLink(t *testing.T) {
+	board := sleepDashboard([]*UserData{napsReportDay()}, WeeklyCalendar)
+	chart := board.AggregatedStages
+	var buf bytes.Buffer
+	if err := newChartRenderer(chart, chart.Validate, sleepNightLink(chart)).Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// The click handler is bound to the instance of the rendered chart
+	if handler := fmt.Sprintf(`echarts_%s.on("click"`, chart.ChartID); !strings.Contains(buf.String(), handler) {
+		t.Fatalf("the rendered chart doesn't contain the click handler %s:\n%s", handler, buf.String())
+	}
+	if !strings.Contains(buf.String(), `"/dashboard/sleep/" + params.name.replaceAll("-", "/")`) {
+		t.Fatalf("the click handler doesn't link the night of the clicked date:\n%s", buf.String())
+	}
+
+	// The name of a bar is its date: the link is the route of the night of the date
+	router, err := NewRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := chart.XAxisList[0].Data.([]string)[0]
+	c := router.NewContext(nil, nil)
+	router.Router().Find(http.MethodGet, "/dashboard/sleep/"+strings.ReplaceAll(date, "-", "/"), c)
+	if c.Path() != "/dashboard/sleep/:year/:month/:day" {
+		t.Fatalf("the link of %s is routed to %q, want the night route", date, c.Path())
+	}
+	if got := fmt.Sprintf("%s-%s-%s", c.Param("year"), c.Param("month"), c.Param("day")); got != date {
+		t.Errorf("the link of %s is the night of %s", date, got)
+	}
+}
@@ -0,0 +1,269 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// Status of a dump job
+const (
+	dumpJobPending   = "pending"
+	dumpJobRunning   = "running"
+	dumpJobCompleted = "completed"
+	dumpJobFailed    = "failed"
+)
+
+// resetDumpJobs marks every dump job of the user as pending. Called when a new dump starts.
+func resetDumpJobs(userID int64) error {
+	return _db.Model(types.DumpJob{}).Exec(
+		"UPDATE dump_jobs SET status = ?, error = '', updated_at = ? WHERE user_id = ?",
+		dumpJobPending, time.Now().UTC(), userID)
+}
+
+// beginDumpJob marks the dump of dataType as running. The range covered by the dump
+// is extended with startDate and endDate (if not nil), since some data types are dumped in chunks.
+// The rows of the job are counted again when a new dump starts.
+func beginDumpJob(userID int64, dataType string, startDate, endDate *time.Time) error {
+	var start, end interface{}
+	if startDate != nil {
+		start = startDate.Format(time.DateOnly)
+	}
+	if endDate != nil {
+		end = endDate.Format(time.DateOnly)
+	}
+	return _db.Model(types.DumpJob{}).Exec(
+		`INSERT INTO dump_jobs(user_id, data_type, status, start_date, end_date, updated_at) VALUES (?, ?, ?, ?::date, ?::date, ?)
+		ON CONFLICT (user_id, data_type) DO UPDATE SET
+		start_date = CASE WHEN dump_jobs.status = 'pending' THEN EXCLUDED.start_date ELSE LEAST(dump_jobs.start_date, EXCLUDED.start_date) END,
+		end_date = CASE WHEN dump_jobs.status = 'pending' THEN EXCLUDED.end_date ELSE GREATEST(dump_jobs.end_date, EXCLUDED.end_date) END,
+		rows = CASE WHEN dump_jobs.status = 'pending' THEN 0 ELSE dump_jobs.rows END,
+		status = EXCLUDED.status, updated_at = EXCLUDED.updated_at`,
+		userID, dataType, dumpJobRunning, start, end, time.Now().UTC())
+}
+
+// dumpDateColumn returns the column with the date of the rows of the table of model.
+func dumpDateColumn(model tableModel) string {
+	switch model.TableName() {
+	case types.ActivityLog{}.TableName():
+		return "start_time"
+	case types.SleepLog{}.TableName():
+		return "date_of_sleep"
+	case types.BreathingRate{}.TableName():
+		return "date_time"
+	}
+	for _, target := range _intradayTargets {
+		if target.model.TableName() == model.TableName() {
+			return target.dateColumn
+		}
+	}
+	return `"date"`
+}
+
+// dumpedRows returns the number of rows of the user in the table of model between startDate
+// and endDate (included), if not nil.
+func dumpedRows(userID int64, model tableModel, startDate, endDate *time.Time) (rows int64, err error) {
+	condition := "user_id = ?"
+	args := []interface{}{userID}
+	if startDate != nil {
+		condition += fmt.Sprintf(" AND %s >= ?", dumpDateColumn(model))
+		args = append(args, startDate.Truncate(24*time.Hour))
+	}
+	if endDate != nil {
+		// The date columns can be timestamps: the rows of the whole last day
+		condition += fmt.Sprintf(" AND %s < ?", dumpDateColumn(model))
+		args = append(args, endDate.Truncate(24*time.Hour).AddDate(0, 0, 1))
+	}
+	err = _db.Model(model).Select("count(*)").Where(condition, args...).Scan(&rows)
+	return
+}
+
+// endDumpJob stores the outcome of the dump of the data type of model between startDate and endDate,
+// adding to the rows of the job the rows of the user in this range: the rows are counted step by step,
+// and not in the whole table. The steps without a range (e.g. the goals) count all the rows of the user.
+// A failed job stays failed until the next dump.
+func endDumpJob(userID int64, model tableModel, startDate, endDate *time.Time, dumpErr error) (err error) {
+	var rows int64
+	if rows, err = dumpedRows(userID, model, startDate, endDate); err != nil {
+		return err
+	}
+	// The rows of the range are added to the rows of the previous steps
+	rowsUpdate := "rows = rows + ?"
+	if startDate == nil && endDate == nil {
+		rowsUpdate = "rows = ?"
+	}
+	if dumpErr != nil {
+		return _db.Model(types.DumpJob{}).Exec(
+			"UPDATE dump_jobs SET status = ?, error = ?, "+rowsUpdate+", updated_at = ? WHERE user_id = ? AND data_type = ?",
+			dumpJobFailed, dumpErr.Error(), rows, time.Now().UTC(), userID, model.TableName())
+	}
+	return _db.Model(types.DumpJob{}).Exec(
+		"UPDATE dump_jobs SET status = CASE WHEN error = '' THEN ? ELSE ? END, "+rowsUpdate+", updated_at = ? WHERE user_id = ? AND data_type = ?",
+		dumpJobCompleted, dumpJobFailed, rows, time.Now().UTC(), userID, model.TableName())
+}
+
+// step executes dump, that dumps the data type of model between startDate and endDate,
+// tracks its progress in the dump_jobs table and adds the outcome to results.
+func (d *dumper) step(results dumpResults, model tableModel, startDate, endDate *time.Time, dump func() error) {
+	dataType := model.TableName()
+	if err := beginDumpJob(d.User.ID, dataType, startDate, endDate); err != nil {
+		d.logError(err)
+	}
+	err := dump()
+	results.add(dataType, err)
+	if err := endDumpJob(d.User.ID, model, startDate, endDate, err); err != nil {
+		d.logError(err)
+	}
+}
+
+// dumpJob is the JSON representation of types.DumpJob
+type dumpJob struct {
+	DataType  string    `json:"data_type"`
+	Status    string    `json:"status"`
+	StartDate string    `json:"start_date,omitempty"`
+	EndDate   string    `json:"end_date,omitempty"`
+	Rows      int64     `json:"rows"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// dumpProgress is the state of the dump of the user
+type dumpProgress struct {
+	Dumping bool      `json:"dumping"`
+	Jobs    []dumpJob `json:"jobs"`
+}
+
+// userDumpProgress returns the state of the dump of the user.
+func userDumpProgress(user *types.User) (*dumpProgress, error) {
+	var err error
+	progress := dumpProgress{Jobs: []dumpJob{}}
+	if progress.Dumping, err = (&fetcher{user}).isDumping(); err != nil {
+		return nil, err
+	}
+
+	var jobs []types.DumpJob
+	if err = _db.Model(types.DumpJob{}).Where(&types.DumpJob{UserID: user.ID}).Order("data_type").Scan(&jobs); err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		j := dumpJob{
+			DataType:  job.DataType,
+			Status:    job.Status,
+			Rows:      job.Rows,
+			Error:     job.Error,
+			UpdatedAt: job.UpdatedAt,
+		}
+		if job.StartDate.Valid {
+			j.StartDate = job.StartDate.Time.Format(time.DateOnly)
+		}
+		if job.EndDate.Valid {
+			j.EndDate = job.EndDate.Time.Format(time.DateOnly)
+		}
+		progress.Jobs = append(progress.Jobs, j)
+	}
+	return &progress, nil
+}
+
+// DumpProgress renders the page that shows the progress of the dump of the user data.
+func DumpProgress() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		var progress *dumpProgress
+		if progress, err = userDumpProgress(user); err != nil {
+			log.Error("userDumpProgress: ", err)
+			return err
+		}
+		return c.Render(http.StatusOK, "dashboard/progress", echo.Map{
+			"title":      "Import progress - FitSleepInsights",
+			"isLoggedIn": true,
+			"progress":   progress,
+		})
+	}
+}
+
+// DumpProgressStatus returns, as JSON, the progress of the dump of the user data.
+func DumpProgressStatus() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		var progress *dumpProgress
+		if progress, err = userDumpProgress(user); err != nil {
+			log.Error("userDumpProgress: ", err)
+			return err
+		}
+		return c.JSON(http.StatusOK, progress)
+	}
+}
+
+// dumpProgressMaxDuration is the maximum duration of a stream of the dump progress.
+// The browsers reconnect automatically, so the streams of the closed tabs don't run forever.
+const dumpProgressMaxDuration = 10 * time.Minute
+
+// DumpProgressEvents streams the progress of the dump of the user data, using the
+// Server-Sent Events protocol. A "progress" event is sent every couple of seconds while
+// the dump is running, and a final "done" event when the dump is over.
+// The stream is closed after dumpProgressMaxDuration.
+func DumpProgressEvents() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.Header().Set(echo.HeaderConnection, "keep-alive")
+		res.WriteHeader(http.StatusOK)
+
+		ticker := time.NewTicker(2 * time.Second)
+		defer ticker.Stop()
+		deadline := time.NewTimer(dumpProgressMaxDuration)
+		defer deadline.Stop()
+		for {
+			var progress *dumpProgress
+			if progress, err = userDumpProgress(user); err != nil {
+				log.Error("userDumpProgress: ", err)
+				return nil
+			}
+			var data []byte
+			if data, err = json.Marshal(progress); err != nil {
+				return nil
+			}
+
+			event := "progress"
+			if !progress.Dumping {
+				event = "done"
+			}
+			if _, err = fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event, data); err != nil {
+				return nil
+			}
+			res.Flush()
+			if !progress.Dumping {
+				return nil
+			}
+
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case <-deadline.C:
+				return nil
+			case <-ticker.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+func TestDumpDateColumn(t *testing.T) {
+	for _, tc := range []struct {
+		model tableModel
+		want  string
+	}{
+		{types.SleepLog{}, "date_of_sleep"},
+		{types.ActivityLog{}, "start_time"},
+		{types.BreathingRate{}, "date_time"},
+		{types.HeartRateIntraday{}, "date_time"},
+		{types.BreathingRateIntraday{}, `"date"`},
+		{types.StepsSeries{}, `"date"`},
+	} {
+		if got := dumpDateColumn(tc.model); got != tc.want {
+			t.Errorf("dumpDateColumn(%s) = %s, want %s", tc.model.TableName(), got, tc.want)
+		}
+	}
+}
+
+// dumpJobOf returns the dump job of the data type of the user.
+func dumpJobOf(t *testing.T, user *types.User, dataType string) types.DumpJob {
+	t.Helper()
+	job := types.DumpJob{UserID: user.ID, DataType: dataType}
+	if err := _db.Model(types.DumpJob{}).Where(&job).Scan(&job); err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestEndDumpJob(t *testing.T) {
+	user := testDBUser(t)
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	logID := -user.ID * 1000
+	for i := 0; i < 10; i++ {
+		logID--
+		date := start.AddDate(0, 0, i)
+		if err := _db.Exec(`INSERT INTO sleep_logs(log_id, user_id, date_of_sleep, start_time, end_time, is_main_sleep, log_type, "type")
+			VALUES (?, ?, ?, ?, ?, true, 'auto_detected', 'stages')`,
+			logID, user.ID, date, date.Add(-time.Hour), date.Add(7*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A dump in two chunks of 3 days: the rows of every chunk are added
+	dataType := types.SleepLog{}.TableName()
+	for _, chunk := range [][2]time.Time{{start, start.AddDate(0, 0, 2)}, {start.AddDate(0, 0, 3), start.AddDate(0, 0, 5)}} {
+		if err := beginDumpJob(user.ID, dataType, &chunk[0], &chunk[1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := endDumpJob(user.ID, types.SleepLog{}, &chunk[0], &chunk[1], nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	job := dumpJobOf(t, user, dataType)
+	if job.Status != dumpJobCompleted || job.Rows != 6 {
+		t.Errorf("job %+v, want completed with the 6 rows of the chunks", job)
+	}
+	if job.StartDate.Time.Format(time.DateOnly) != "2024-03-01" || job.EndDate.Time.Format(time.DateOnly) != "2024-03-06" {
+		t.Errorf("job range %s - %s, want 2024-03-01 - 2024-03-06", job.StartDate.Time, job.EndDate.Time)
+	}
+
+	// The next dump counts its rows again, and a failure is kept until the end of the dump
+	if err := resetDumpJobs(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	day := start.AddDate(0, 0, 9)
+	if err := beginDumpJob(user.ID, dataType, &day, &day); err != nil {
+		t.Fatal(err)
+	}
+	if err := endDumpJob(user.ID, types.SleepLog{}, &day, &day, errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+	if err := beginDumpJob(user.ID, dataType, &start, &start); err != nil {
+		t.Fatal(err)
+	}
+	if err := endDumpJob(user.ID, types.SleepLog{}, &start, &start, nil); err != nil {
+		t.Fatal(err)
+	}
+	if job = dumpJobOf(t, user, dataType); job.Status != dumpJobFailed || job.Error != "boom" || job.Rows != 2 {
+		t.Errorf("job %+v, want failed with the 2 rows of the new dump", job)
+	}
+
+	// Without a range, all the rows of the user
+	if err := beginDumpJob(user.ID, dataType, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := endDumpJob(user.ID, types.SleepLog{}, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if job = dumpJobOf(t, user, dataType); job.Rows != 10 {
+		t.Errorf("%d rows without a range, want 10", job.Rows)
+	}
+}
@@ -16,12 +16,13 @@ import (
 	fitbit_types "github.com/galeone/fitbit/v2/types"
 	"github.com/galeone/fitsleepinsights/database"
 	"github.com/galeone/fitsleepinsights/database/types"
-	"github.com/galeone/tcx"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 )
 
-func init() {
+// listenNewUsers dumps the data of the users that complete the authorization flow,
+// notified on the database.NewUsersChannel.
+func listenNewUsers() {
 	_ = _db.Listen(database.NewUsersChannel, func(payload ...string) {
 		log.Print("notification received")
 		if len(payload) != 1 {
@@ -29,7 +30,14 @@ func init() {
 		}
 		accessToken := payload[0]
 		if dumper, err := NewDumper(accessToken); err == nil {
-			dumper.DumpNewer(false)
+			dumper.DumpNewer()
+			if _subscriberVerificationCode != "" {
+				if err = dumper.subscribe(); err != nil {
+					log.Error("Error while subscribing to the Fitbit notifications: ", err)
+				}
+			}
+			// The recent data is there: we can go back in time and dump the history of the user
+			go dumper.Backfill()
 			// initialize _allActivityCatalog here, because we need the access token
 			// even if this is a global variable shared by all the users
 			if len(_allActivityCatalog) == 0 {
@@ -67,8 +75,9 @@ func init() {
 }
 
 type dumper struct {
-	fb   *fitbit_client.Client
-	User *types.User
+	fb         *fitbit_client.Client
+	authorizer *fitbit.Authorizer
+	User       *types.User
 }
 
 func (d *dumper) logError(err error) {
@@ -79,36 +88,43 @@ func (d *dumper) logError(err error) {
 	}
 }
 
-// NewDumper creates a new dumper using the provided access token
+// NewDumper creates a new dumper using the provided access token.
+// The access token of the user is refreshed if it's expiring.
 func NewDumper(accessToken string) (*dumper, error) {
-	authorizer := fitbit.NewAuthorizer(_db, _clientID, _clientSecret, _redirectURL)
-	if dbToken, err := _db.AuthorizedUser(accessToken); err != nil {
+	var user *types.User
+	var err error
+	if user, err = userByAccessToken(accessToken); err != nil {
 		return nil, err
-	} else {
-		if dbToken.UserID == "" {
-			return nil, errors.New("invalid token. Please login again")
-		}
-		authorizer.SetToken(dbToken)
 	}
 
-	var fb *fitbit_client.Client
-	var err error
-	if fb, err = fitbit_client.NewClient(authorizer); err != nil {
+	var token *fitbit_types.AuthorizedUser
+	if token, err = validToken(user); err != nil {
 		return nil, err
 	}
+	authorizer := newFitbitAuthorizer()
+	authorizer.SetToken(token)
 
-	var abstractUser *fitbit_types.AuthorizedUser
-	if abstractUser, err = _db.AuthorizedUser(accessToken); err != nil {
+	var fb *fitbit_client.Client
+	if fb, err = fitbit_client.NewClient(authorizer); err != nil {
 		return nil, err
 	}
+	return &dumper{fb, authorizer, user}, err
+}
 
-	var user types.User
-	condition := types.User{}
-	condition.UserID = abstractUser.UserID
-	if err = _db.Model(types.User{}).Where(&condition).Scan(&user); err != nil {
-		return nil, err
+// fetch executes call, a request to the Fitbit API. If the request fails because the access token
+// is expired, the token is refreshed and the call retried once.
+func (d *dumper) fetch(call func() error) (err error) {
+	if err = call(); !isUnauthorized(err) {
+		return err
+	}
+	if err = refreshToken(d.User, d.User.AccessToken); err != nil {
+		return err
 	}
-	return &dumper{fb, &user}, err
+	d.authorizer.SetToken(&d.User.AuthorizedUser.AuthorizedUser)
+	if err = d.fb.Req(); err != nil {
+		return err
+	}
+	return call()
 }
 
 // Fitbit returns the fitbit client
@@ -118,7 +134,7 @@ func (d *dumper) Fitbit() *fitbit_client.Client {
 
 func (d *dumper) userActivityCaloriesTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.ActivityCaloriesSeries
-	if value, err = d.fb.UserActivityCaloriesTimeseries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserActivityCaloriesTimeseries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -147,7 +163,7 @@ func (d *dumper) userActivityCaloriesTimeseries(startDate, endDate *time.Time) (
 
 func (d *dumper) userActivityDailyGoal() (err error) {
 	var value *fitbit_types.UserGoal
-	if value, err = d.fb.UserActivityDailyGoal(); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserActivityDailyGoal(); return }); err != nil {
 		d.logError(err)
 		return err
 	}
@@ -168,7 +184,7 @@ func (d *dumper) userActivityDailyGoal() (err error) {
 // This is a global list, not user specific.
 func (d *dumper) AllActivityCatalog() (err error) {
 	var catalog *fitbit_types.ActivityCatalog
-	if catalog, err = d.fb.AllActivityTypes(); err != nil {
+	if err = d.fetch(func() (err error) { catalog, err = d.fb.AllActivityTypes(); return }); err != nil {
 		d.logError(err)
 		return err
 	}
@@ -230,10 +246,11 @@ func (d *dumper) AllActivityCatalog() (err error) {
 	return
 }
 
-// The parameter dumpTCX is required because every TCX dump request is an API call.
-// Fitbit limits 250 API calls user/hour. Thus, on the first dump we have
-// 1 single API call for the activity list. But 100 API calls for the TCX.
-func (d *dumper) userActivityLogList(after *time.Time, dumpTCX bool) (err error) {
+// userActivityLogList dumps the activities logged after the after date, in ascending order.
+// If after is nil, it dumps the activities logged before the before date (or now, if nil)
+// in descending order.
+// The TCX of the activities are not dumped here, since every TCX is an API call: see dumpTCX.
+func (d *dumper) userActivityLogList(after, before *time.Time) (err error) {
 	var sort string
 	var AfterDate fitbit_types.FitbitDateTime
 	var BeforeDate fitbit_types.FitbitDateTime
@@ -246,6 +263,9 @@ func (d *dumper) userActivityLogList(after *time.Time, dumpTCX bool) (err error)
 	} else {
 		sort = "desc"
 		BeforeDate.Time = time.Now()
+		if before != nil {
+			BeforeDate.Time = *before
+		}
 	}
 
 	pagination := fitbit_types.Pagination{
@@ -260,12 +280,14 @@ func (d *dumper) userActivityLogList(after *time.Time, dumpTCX bool) (err error)
 
 	for {
 		var value *fitbit_types.ActivityLogList
-		if value, err = d.fb.UserActivityLogList(&pagination); err != nil {
+		if err = d.fetch(func() (err error) { value, err = d.fb.UserActivityLogList(&pagination); return }); err != nil {
 			if strings.Contains(err.Error(), "504") {
 				// NOTE: Fitbit API is a shit.
 				// It only allows us to request the latest 100 activities.
 				// Thus, if we are asking for other activities it doesn't return a meaningful error
 				// But it returns a Gateway Timeout (WTF).
+				// The fitbitTransport doesn't retry the 504 of this endpoint: it's the end of the data.
+				err = nil
 				break
 			}
 			return
@@ -352,23 +374,6 @@ func (d *dumper) userActivityLogList(after *time.Time, dumpTCX bool) (err error)
 			activityRow.ManualInsertedSteps = activity.ManualValuesSpecified.Steps
 			activityRow.ManualInsertedDistance = activity.ManualValuesSpecified.Distance
 
-			if dumpTCX {
-				var xml *tcx.TCXDB
-				if xml, err = d.fb.UserActivityTCX(activity.LogID); err == nil {
-					if textBytes, err := tcx.ToBytes(*xml); err != nil {
-						d.logError(err)
-					} else {
-						activityRow.Tcx = sql.NullString{
-							String: string(textBytes),
-							Valid:  true,
-						}
-					}
-				} else {
-					d.logError(err)
-					// Do not break: who cares about failing fetch of TCX data (Fitbit has several problems with that)
-				}
-			}
-
 			if err = tx.Create(&activityRow); err != nil {
 				d.logError(err)
 				_ = tx.Rollback()
@@ -449,7 +454,7 @@ func (d *dumper) userActivityLogList(after *time.Time, dumpTCX bool) (err error)
 
 func (d *dumper) userActivityWeeklyGoal() (err error) {
 	var value *fitbit_types.UserGoal
-	if value, err = d.fb.UserActivityWeeklyGoal(); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserActivityWeeklyGoal(); return }); err != nil {
 		d.logError(err)
 		return err
 	}
@@ -471,7 +476,7 @@ func (d *dumper) userActivityWeeklyGoal() (err error) {
 
 func (d *dumper) userBMITimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.BMISeries
-	if value, err = d.fb.UserBMITimeSeries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserBMITimeSeries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -500,7 +505,7 @@ func (d *dumper) userBMITimeseries(startDate, endDate *time.Time) (err error) {
 
 func (d *dumper) userBodyFatTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.BodyFatSeries
-	if value, err = d.fb.UserBodyFatTimeSeries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserBodyFatTimeSeries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -530,7 +535,7 @@ func (d *dumper) userBodyFatTimeseries(startDate, endDate *time.Time) (err error
 
 func (d *dumper) userBodyWeightTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.BodyWeightSeries
-	if value, err = d.fb.UserBodyWeightTimeSeries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserBodyWeightTimeSeries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -559,7 +564,7 @@ func (d *dumper) userBodyWeightTimeseries(startDate, endDate *time.Time) (err er
 
 func (d *dumper) userCaloriesBMRTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.CaloriesBMRSeries
-	if value, err = d.fb.UserCaloriesBMRTimeseries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserCaloriesBMRTimeseries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -589,7 +594,7 @@ func (d *dumper) userCaloriesBMRTimeseries(startDate, endDate *time.Time) (err e
 
 func (d *dumper) userCaloriesTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.CaloriesSeries
-	if value, err = d.fb.UserCaloriesTimeseries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserCaloriesTimeseries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -619,7 +624,7 @@ func (d *dumper) userCaloriesTimeseries(startDate, endDate *time.Time) (err erro
 
 func (d *dumper) userDistanceTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.DistanceSeries
-	if value, err = d.fb.UserDistanceTimeseries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserDistanceTimeseries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -649,7 +654,7 @@ func (d *dumper) userDistanceTimeseries(startDate, endDate *time.Time) (err erro
 
 func (d *dumper) userFloorsTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.FloorsSeries
-	if value, err = d.fb.UserFloorsTimeseries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserFloorsTimeseries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -679,7 +684,7 @@ func (d *dumper) userFloorsTimeseries(startDate, endDate *time.Time) (err error)
 
 func (d *dumper) userHeartRateTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.HeartRateSeries
-	if value, err = d.fb.UserHeartRateTimeseries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserHeartRateTimeseries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -751,7 +756,7 @@ func (d *dumper) userHeartRateTimeseries(startDate, endDate *time.Time) (err err
 
 func (d *dumper) userMinutesFairlyActiveTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.MinutesFairlyActiveSeries
-	if value, err = d.fb.UserMinutesFairlyActiveTimeseries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserMinutesFairlyActiveTimeseries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -781,7 +786,7 @@ func (d *dumper) userMinutesFairlyActiveTimeseries(startDate, endDate *time.Time
 
 func (d *dumper) userMinutesLightlyActiveTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.MinutesLightlyActiveSeries
-	if value, err = d.fb.UserMinutesLightlyActiveTimeseries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserMinutesLightlyActiveTimeseries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -810,7 +815,7 @@ func (d *dumper) userMinutesLightlyActiveTimeseries(startDate, endDate *time.Tim
 
 func (d *dumper) userMinutesSedentaryTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.MinutesSedentarySeries
-	if value, err = d.fb.UserMinutesSedentaryTimeseries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserMinutesSedentaryTimeseries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -839,7 +844,7 @@ func (d *dumper) userMinutesSedentaryTimeseries(startDate, endDate *time.Time) (
 
 func (d *dumper) userMinutesVeryActiveTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.MinutesVeryActiveSeries
-	if value, err = d.fb.UserMinutesVeryActiveTimeseries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserMinutesVeryActiveTimeseries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -868,7 +873,7 @@ func (d *dumper) userMinutesVeryActiveTimeseries(startDate, endDate *time.Time)
 
 func (d *dumper) userStepsTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.StepsSeries
-	if value, err = d.fb.UserStepsTimeseries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserStepsTimeseries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -898,7 +903,7 @@ func (d *dumper) userStepsTimeseries(startDate, endDate *time.Time) (err error)
 
 func (d *dumper) userElevationTimeseries(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.ElevationSeries
-	if value, err = d.fb.UserElevationTimeseries(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserElevationTimeseries(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -928,7 +933,7 @@ func (d *dumper) userElevationTimeseries(startDate, endDate *time.Time) (err err
 
 func (d *dumper) userCoreTemperature(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.CoreTemperature
-	if value, err = d.fb.UserCoreTemperature(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserCoreTemperature(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -955,7 +960,7 @@ func (d *dumper) userCoreTemperature(startDate, endDate *time.Time) (err error)
 
 func (d *dumper) userSkinTemperature(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.SkinTemperature
-	if value, err = d.fb.UserSkinTemperature(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserSkinTemperature(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -984,7 +989,7 @@ func (d *dumper) userSkinTemperature(startDate, endDate *time.Time) (err error)
 
 func (d *dumper) userBreathingRate(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.BreathingRate
-	if value, err = d.fb.UserBreathingRate(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserBreathingRate(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -1013,7 +1018,7 @@ func (d *dumper) userBreathingRate(startDate, endDate *time.Time) (err error) {
 
 func (d *dumper) userCardioFitnessScore(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.CardioFitnessScore
-	if value, err = d.fb.UserCardioFitnessScore(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserCardioFitnessScore(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -1064,7 +1069,7 @@ func (d *dumper) userCardioFitnessScore(startDate, endDate *time.Time) (err erro
 
 func (d *dumper) userOxygenSaturation(startDate, endDate *time.Time) (err error) {
 	var values *fitbit_types.OxygenSaturations
-	if values, err = d.fb.UserOxygenSaturation(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { values, err = d.fb.UserOxygenSaturation(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -1094,7 +1099,7 @@ func (d *dumper) userOxygenSaturation(startDate, endDate *time.Time) (err error)
 
 func (d *dumper) userHeartRateVariability(startDate, endDate *time.Time) (err error) {
 	var value *fitbit_types.HeartRateVariability
-	if value, err = d.fb.UserHeartRateVariability(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserHeartRateVariability(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -1124,7 +1129,7 @@ func (d *dumper) userHeartRateVariability(startDate, endDate *time.Time) (err er
 
 func (d *dumper) userSleepLogList(startDate, endDate *time.Time) (err error) {
 	var sleepLogs *fitbit_types.SleepLogs
-	if sleepLogs, err = d.fb.UserSleepLog(startDate, endDate); err != nil {
+	if err = d.fetch(func() (err error) { sleepLogs, err = d.fb.UserSleepLog(startDate, endDate); return }); err != nil {
 		d.logError(err)
 		return
 	}
@@ -1219,27 +1224,75 @@ func (d *dumper) userSleepLogList(startDate, endDate *time.Time) (err error) {
 	return
 }
 
+// dumpResults maps every data type (the table name) dumped to the error,
+// if any, returned while dumping it.
+type dumpResults map[string]error
+
+// add sets the result of the dump of dataType. The first error is kept, because
+// some data types are dumped in chunks and a later success doesn't fix a previous failure.
+func (r dumpResults) add(dataType string, err error) {
+	if prev, ok := r[dataType]; ok && prev != nil {
+		return
+	}
+	r[dataType] = err
+}
+
+// err returns all the errors contained in the results joined together, or nil.
+func (r dumpResults) err() error {
+	var errs []error
+	for dataType, err := range r {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", dataType, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // DumpNewer fetches every data available on the user profile, up to this moment.
 // This function is called:
 //   - When the user gives the permission to the app (on the INSERT on the table
 //     triggered by the database notification)
 //   - When the user re-login giving once again the permission to the app
-func (d *dumper) DumpNewer(dumpTCX bool) {
+//
+// The user is marked as dumping for the whole duration of the dump.
+func (d *dumper) DumpNewer() {
+	// Wait for any other dump (e.g. the background synchronization) of the same user
+	unlock := lockUserDump(d.User.ID)
+	defer unlock()
+
 	defer func() {
-		d.User.Dumping = false
 		log.Print("Dumping data for user ", d.User.ID, " finished")
-		if err := _db.Updates(d.User); err != nil {
+		if err := setDumping(d.User.ID, false); err != nil {
 			d.logError(err)
 			return
 		}
 	}()
 
-	d.User.Dumping = true
 	log.Print("Dumping data for user ", d.User.ID)
-	if err := _db.Updates(d.User); err != nil {
+	if err := setDumping(d.User.ID, true); err != nil {
 		d.logError(err)
 		return
 	}
+
+	results := d.dumpNewer()
+	results.add(syncAllDataTypes, results.err())
+	recordSyncStatus(d.User.ID, results, time.Now())
+}
+
+// setDumping sets the dumping flag of the user.
+// Only the flag is updated, since the token of the user may have been refreshed during the dump.
+func setDumping(userID int64, dumping bool) error {
+	return _db.Model(types.User{}).Exec("UPDATE oauth2_authorized SET dumping = ? WHERE id = ?", dumping, userID)
+}
+
+// dumpNewer fetches every data available on the user profile, from the last date
+// dumped up to yesterday. It returns the outcome of the dump for every data type.
+// The caller is responsible for holding the user dump lock.
+func (d *dumper) dumpNewer() dumpResults {
+	results := dumpResults{}
+	if err := resetDumpJobs(d.User.ID); err != nil {
+		d.logError(err)
+	}
 	var startDate time.Time
 	var endDate *time.Time
 
@@ -1260,8 +1313,8 @@ func (d *dumper) DumpNewer(dumpTCX bool) {
 
 	// There are functions that don't have an "after" period
 	// because Fitbit allows to get only the daily data.
-	d.userActivityDailyGoal()
-	d.userActivityWeeklyGoal()
+	d.step(results, types.Goal{}, nil, nil, d.userActivityDailyGoal)
+	d.step(results, types.Goal{}, nil, nil, d.userActivityWeeklyGoal)
 
 	var last time.Time
 	var err error
@@ -1273,112 +1326,113 @@ func (d *dumper) DumpNewer(dumpTCX bool) {
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userActivityLogList(&startDate, dumpTCX)
+	d.step(results, types.ActivityLog{}, &startDate, endDate, func() error { return d.userActivityLogList(&startDate, nil) })
+	d.step(results, types.ActivityTrackpoint{}, nil, nil, d.dumpTCX)
 
 	if err = _db.Model(types.ActivityCaloriesSeries{}).Select("max(date)").Where(&types.ActivityCaloriesSeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userActivityCaloriesTimeseries(&startDate, endDate)
+	d.step(results, types.ActivityCaloriesSeries{}, &startDate, endDate, func() error { return d.userActivityCaloriesTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.BMISeries{}).Select("max(date)").Where(&types.BMISeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userBMITimeseries(&startDate, endDate)
+	d.step(results, types.BMISeries{}, &startDate, endDate, func() error { return d.userBMITimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.BodyFatSeries{}).Select("max(date)").Where(&types.BodyFatSeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userBodyFatTimeseries(&startDate, endDate)
+	d.step(results, types.BodyFatSeries{}, &startDate, endDate, func() error { return d.userBodyFatTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.BodyWeightSeries{}).Select("max(date)").Where(&types.BodyWeightSeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userBodyWeightTimeseries(&startDate, endDate)
+	d.step(results, types.BodyWeightSeries{}, &startDate, endDate, func() error { return d.userBodyWeightTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.CaloriesBMRSeries{}).Select("max(date)").Where(&types.CaloriesBMRSeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userCaloriesBMRTimeseries(&startDate, endDate)
+	d.step(results, types.CaloriesBMRSeries{}, &startDate, endDate, func() error { return d.userCaloriesBMRTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.CaloriesSeries{}).Select("max(date)").Where(&types.CaloriesSeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userCaloriesTimeseries(&startDate, endDate)
+	d.step(results, types.CaloriesSeries{}, &startDate, endDate, func() error { return d.userCaloriesTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.DistanceSeries{}).Select("max(date)").Where(&types.DistanceSeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userDistanceTimeseries(&startDate, endDate)
+	d.step(results, types.DistanceSeries{}, &startDate, endDate, func() error { return d.userDistanceTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.FloorsSeries{}).Select("max(date)").Where(&types.FloorsSeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userFloorsTimeseries(&startDate, endDate)
+	d.step(results, types.FloorsSeries{}, &startDate, endDate, func() error { return d.userFloorsTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.MinutesFairlyActiveSeries{}).Select("max(date)").Where(&types.MinutesFairlyActiveSeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userMinutesFairlyActiveTimeseries(&startDate, endDate)
+	d.step(results, types.MinutesFairlyActiveSeries{}, &startDate, endDate, func() error { return d.userMinutesFairlyActiveTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.MinutesLightlyActiveSeries{}).Select("max(date)").Where(&types.MinutesLightlyActiveSeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userMinutesLightlyActiveTimeseries(&startDate, endDate)
+	d.step(results, types.MinutesLightlyActiveSeries{}, &startDate, endDate, func() error { return d.userMinutesLightlyActiveTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.MinutesSedentarySeries{}).Select("max(date)").Where(&types.MinutesSedentarySeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userMinutesSedentaryTimeseries(&startDate, endDate)
+	d.step(results, types.MinutesSedentarySeries{}, &startDate, endDate, func() error { return d.userMinutesSedentaryTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.MinutesVeryActiveSeries{}).Select("max(date)").Where(&types.MinutesVeryActiveSeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userMinutesVeryActiveTimeseries(&startDate, endDate)
+	d.step(results, types.MinutesVeryActiveSeries{}, &startDate, endDate, func() error { return d.userMinutesVeryActiveTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.StepsSeries{}).Select("max(date)").Where(&types.StepsSeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userStepsTimeseries(&startDate, endDate)
+	d.step(results, types.StepsSeries{}, &startDate, endDate, func() error { return d.userStepsTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.HeartRateActivities{}).Select("max(date)").Where(&types.HeartRateActivities{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userHeartRateTimeseries(&startDate, endDate)
+	d.step(results, types.HeartRateActivities{}, &startDate, endDate, func() error { return d.userHeartRateTimeseries(&startDate, endDate) })
 
 	if err = _db.Model(types.ElevationSeries{}).Select("max(date)").Where(&types.ElevationSeries{UserID: d.User.ID}).Scan(&last); err == nil {
 		startDate = last
 	} else {
 		startDate = defaultStartDate()
 	}
-	d.userElevationTimeseries(&startDate, endDate)
+	d.step(results, types.ElevationSeries{}, &startDate, endDate, func() error { return d.userElevationTimeseries(&startDate, endDate) })
 
 	// From here on, we need to fetch data in a different way because the Fitbit API has a limit on the number of days we can fetch
 	// for certain endpoints (the one used below).
@@ -1403,12 +1457,12 @@ func (d *dumper) DumpNewer(dumpTCX bool) {
 	}
 	isYesterday := newEndDate.Equal(yesterday)
 	for newEndDate.Before(yesterday) || isYesterday {
-		d.userSkinTemperature(&newStartDate, &newEndDate)
-		d.userBreathingRate(&newStartDate, &newEndDate)
-		d.userCoreTemperature(&newStartDate, &newEndDate)
-		d.userOxygenSaturation(&newStartDate, &newEndDate)
-		d.userCardioFitnessScore(&newStartDate, &newEndDate)
-		d.userHeartRateVariability(&newStartDate, &newEndDate)
+		d.step(results, types.SkinTemperature{}, &newStartDate, &newEndDate, func() error { return d.userSkinTemperature(&newStartDate, &newEndDate) })
+		d.step(results, types.BreathingRate{}, &newStartDate, &newEndDate, func() error { return d.userBreathingRate(&newStartDate, &newEndDate) })
+		d.step(results, types.CoreTemperature{}, &newStartDate, &newEndDate, func() error { return d.userCoreTemperature(&newStartDate, &newEndDate) })
+		d.step(results, types.OxygenSaturation{}, &newStartDate, &newEndDate, func() error { return d.userOxygenSaturation(&newStartDate, &newEndDate) })
+		d.step(results, types.CardioFitnessScore{}, &newStartDate, &newEndDate, func() error { return d.userCardioFitnessScore(&newStartDate, &newEndDate) })
+		d.step(results, types.HeartRateVariabilityTimeSeries{}, &newStartDate, &newEndDate, func() error { return d.userHeartRateVariability(&newStartDate, &newEndDate) })
 		newStartDate = newEndDate
 		newEndDate = newEndDate.Add(time.Duration(ago*24) * time.Hour)
 
@@ -1436,7 +1490,7 @@ func (d *dumper) DumpNewer(dumpTCX bool) {
 	}
 	isYesterday = newEndDate.Equal(yesterday)
 	for newEndDate.Before(yesterday) || isYesterday {
-		d.userSleepLogList(&newStartDate, &newEndDate)
+		d.step(results, types.SleepLog{}, &newStartDate, &newEndDate, func() error { return d.userSleepLogList(&newStartDate, &newEndDate) })
 
 		newStartDate = newEndDate
 		newEndDate = newEndDate.Add(time.Duration(ago*24) * time.Hour)
@@ -1450,6 +1504,9 @@ func (d *dumper) DumpNewer(dumpTCX bool) {
 			isYesterday = true
 		}
 	}
+
+	d.dumpIntraday(results, yesterday)
+	return results
 }
 
 func Dump() echo.HandlerFunc {
@@ -1469,7 +1526,14 @@ func Dump() echo.HandlerFunc {
 		}
 
 		if dumper, err := NewDumper(user.AccessToken); err == nil {
-			dumper.DumpNewer(false)
+			dumper.DumpNewer()
+			if _subscriberVerificationCode != "" {
+				if err = dumper.subscribe(); err != nil {
+					log.Error("Error while subscribing to the Fitbit notifications: ", err)
+				}
+			}
+			// The recent data is there: we can go back in time and dump the history of the user
+			go dumper.Backfill()
 		} else {
 			log.Error(err.Error())
 			return err
@@ -0,0 +1,239 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	vai "cloud.google.com/go/aiplatform/apiv1beta1"
+	vaipb "cloud.google.com/go/aiplatform/apiv1beta1/aiplatformpb"
+	"github.com/pgvector/pgvector-go"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Providers of the embeddings, selected with the EMBEDDING_PROVIDER environment variable
+const (
+	embeddingProviderVertex = "vertex"
+	embeddingProviderOpenAI = "openai"
+	embeddingProviderHash   = "hash"
+)
+
+// Embedder generates the embeddings of the reports, and of the questions of the chat.
+// The embeddings of different models are not comparable: every report stores the model
+// and the dimension of its embedding, and the similarity search uses only the embeddings
+// of the current model.
+type Embedder interface {
+	// Embed returns the embeddings of text.
+	Embed(ctx context.Context, text string) (pgvector.Vector, error)
+	// Model returns the name of the model, stored together with the embeddings.
+	Model() string
+	// Close releases the resources of the embedder.
+	Close()
+}
+
+// newEmbedder returns the Embedder configured with the EMBEDDING_PROVIDER environment variable.
+// When not set, the embeddings are generated by the same provider of the LLM, or hashed
+// if the LLM is the fake one.
+func newEmbedder(ctx context.Context) (Embedder, error) {
+	provider := _embeddingProvider
+	if provider == "" {
+		provider = _llmProvider
+		if provider == llmProviderFake {
+			provider = embeddingProviderHash
+		}
+	}
+	switch provider {
+	case embeddingProviderVertex:
+		return newVertexEmbedder(ctx)
+	case embeddingProviderOpenAI:
+		return newOpenAIEmbedder(), nil
+	case embeddingProviderHash:
+		return newHashEmbedder(_hashEmbeddingDim), nil
+	default:
+		return nil, fmt.Errorf("unknown EMBEDDING_PROVIDER %q: use %q, %q or %q", provider, embeddingProviderVertex, embeddingProviderOpenAI, embeddingProviderHash)
+	}
+}
+
+// vertexEmbedder generates the embeddings with the Vertex AI text embedding models.
+type vertexEmbedder struct {
+	predictionClient *vai.PredictionClient
+}
+
+func newVertexEmbedder(ctx context.Context) (*vertexEmbedder, error) {
+	predictionClient, err := vai.NewPredictionClient(ctx, option.WithEndpoint(_vaiEndpoint))
+	if err != nil {
+		return nil, err
+	}
+	return &vertexEmbedder{predictionClient: predictionClient}, nil
+}
+
+func (e *vertexEmbedder) Embed(ctx context.Context, text string) (embeddings pgvector.Vector, err error) {
+	// Instances: the prompt
+	var promptValue *structpb.Value
+	if promptValue, err = structpb.NewValue(map[string]interface{}{"content": text}); err != nil {
+		return
+	}
+
+	// PredictRequest: create the model prediction request
+	// autoTruncate: false
+	// https://cloud.google.com/vertex-ai/generative-ai/docs/embeddings/get-text-embeddings#generative-ai-get-text-embedding-go
+	var autoTruncate *structpb.Value
+	if autoTruncate, err = structpb.NewValue(map[string]interface{}{"autoTruncate": false}); err != nil {
+		return
+	}
+
+	req := &vaipb.PredictRequest{
+		Endpoint:   _vaiEmbeddingsEndpoint,
+		Instances:  []*structpb.Value{promptValue},
+		Parameters: autoTruncate,
+	}
+
+	// PredictResponse: receive the response from the model
+	var resp *vaipb.PredictResponse
+	if resp, err = e.predictionClient.Predict(ctx, req); err != nil {
+		return
+	}
+	if len(resp.Predictions) == 0 {
+		err = fmt.Errorf("error extracting embeddings")
+		return
+	}
+
+	// Extract the embeddings from the response
+	mapResponse, ok := resp.Predictions[0].GetStructValue().AsMap()["embeddings"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("error extracting embeddings")
+		return
+	}
+	values, ok := mapResponse["values"].([]interface{})
+	if !ok {
+		err = fmt.Errorf("error extracting embeddings")
+		return
+	}
+	rawEmbeddings := make([]float32, len(values))
+	for i, v := range values {
+		rawEmbeddings[i] = float32(v.(float64))
+	}
+	embeddings = pgvector.NewVector(rawEmbeddings)
+	return
+}
+
+func (e *vertexEmbedder) Model() string {
+	return _vaiEmbeddingModel
+}
+
+func (e *vertexEmbedder) Close() {
+	e.predictionClient.Close()
+}
+
+// openAIEmbedder generates the embeddings with an OpenAI-compatible API.
+// https://platform.openai.com/docs/api-reference/embeddings
+type openAIEmbedder struct {
+	openAIClient
+	model string
+}
+
+func newOpenAIEmbedder() *openAIEmbedder {
+	return &openAIEmbedder{openAIClient: newOpenAIClient(), model: _openAIEmbeddingModel}
+}
+
+type openAIEmbeddingRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, text string) (pgvector.Vector, error) {
+	res, err := e.post(ctx, "/embeddings", openAIEmbeddingRequest{Model: e.model, Input: text})
+	if err != nil {
+		return pgvector.Vector{}, err
+	}
+	defer res.Body.Close()
+
+	var response openAIEmbeddingResponse
+	if err = json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return pgvector.Vector{}, err
+	}
+	if len(response.Data) == 0 {
+		return pgvector.Vector{}, errors.New("error extracting embeddings")
+	}
+	return pgvector.NewVector(response.Data[0].Embedding), nil
+}
+
+func (e *openAIEmbedder) Model() string {
+	return e.model
+}
+
+func (e *openAIEmbedder) Close() {
+	e.client.CloseIdleConnections()
+}
+
+// hashEmbedder is the local fallback that needs no model: the embeddings are the hashed
+// term frequencies of the words and of the pairs of consecutive words of the text.
+// Texts that share words are similar.
+type hashEmbedder struct {
+	dim int
+}
+
+func newHashEmbedder(dim int) *hashEmbedder {
+	return &hashEmbedder{dim: dim}
+}
+
+func (e *hashEmbedder) Embed(_ context.Context, text string) (pgvector.Vector, error) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	frequencies := make(map[string]float64)
+	for i, word := range words {
+		frequencies[word]++
+		if i > 0 {
+			frequencies[words[i-1]+" "+word]++
+		}
+	}
+
+	embeddings := make([]float32, e.dim)
+	for term, frequency := range frequencies {
+		hash := fnv.New64a()
+		hash.Write([]byte(term))
+		sum := hash.Sum64()
+		// Sublinear term frequency. The sign, given by another bit of the hash,
+		// makes the collisions cancel out on average.
+		weight := 1 + math.Log(frequency)
+		if sum&(1<<63) != 0 {
+			weight = -weight
+		}
+		embeddings[sum%uint64(e.dim)] += float32(weight)
+	}
+
+	var norm float64
+	for _, value := range embeddings {
+		norm += float64(value) * float64(value)
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range embeddings {
+			embeddings[i] = float32(float64(embeddings[i]) / norm)
+		}
+	}
+	return pgvector.NewVector(embeddings), nil
+}
+
+func (e *hashEmbedder) Model() string {
+	return fmt.Sprintf("hash-%d", e.dim)
+}
+
+func (e *hashEmbedder) Close() {}
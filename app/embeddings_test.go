@@ -0,0 +1,78 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+)
+
+// cosine returns the cosine similarity of the vectors.
+func cosine(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+func TestHashEmbedder(t *testing.T) {
+	embedder := newHashEmbedder(256)
+	if model := embedder.Model(); model != "hash-256" {
+		t.Errorf("Model() = %s, want hash-256", model)
+	}
+	embed := func(text string) []float32 {
+		t.Helper()
+		vector, err := embedder.Embed(context.Background(), text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vector.Slice()
+	}
+
+	for _, text := range []string{"I slept 7 hours, with 90 minutes of deep sleep.", "sleep", "ça va? Très bien"} {
+		vector := embed(text)
+		if len(vector) != 256 {
+			t.Fatalf("%d dimensions, want 256", len(vector))
+		}
+		var norm float64
+		for _, value := range vector {
+			norm += float64(value) * float64(value)
+		}
+		if math.Abs(norm-1) > 1e-5 {
+			t.Errorf("the embedding of %q has norm %f, want 1", text, math.Sqrt(norm))
+		}
+		if !slices.Equal(vector, embed(text)) {
+			t.Errorf("the embedding of %q changed", text)
+		}
+	}
+
+	// Without words, the embedding is zero (and not NaN)
+	for _, value := range embed(" ,.!? ") {
+		if value != 0 {
+			t.Fatalf("the embedding without words contains %f", value)
+		}
+	}
+	// The case and the punctuation are ignored
+	if !slices.Equal(embed("Deep sleep, REM sleep!"), embed("deep sleep rem sleep")) {
+		t.Error("the case and the punctuation changed the embedding")
+	}
+	// The order of the words matters, through the pairs of consecutive words
+	if slices.Equal(embed("deep sleep"), embed("sleep deep")) {
+		t.Error("the order of the words didn't change the embedding")
+	}
+
+	question := embed("How was my deep sleep last night?")
+	sleepReport := embed("Last night the deep sleep lasted 90 minutes, and the sleep efficiency was 92%.")
+	stepsReport := embed("You walked 10234 steps and climbed 12 floors during the afternoon.")
+	if cosine(question, sleepReport) <= cosine(question, stepsReport) {
+		t.Errorf("the question is closer to the steps report (%f) than to the sleep report (%f)",
+			cosine(question, stepsReport), cosine(question, sleepReport))
+	}
+}
@@ -547,79 +547,17 @@ func (f *fetcher) userHeartRateVariability(date time.Time) (*types.HeartRateVari
 	return &timestep, nil
 }
 
-func (f *fetcher) userSleepLogList(date time.Time) (*types.SleepLog, error) {
-	value := types.SleepLog{
-		UserID:      f.user.ID,
-		DateOfSleep: date,
-	}
-	if err := _db.Model(types.SleepLog{}).Where(&value).Scan(&value); err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			log.Error(err)
-		}
-		return nil, err
-	}
-
-	sleepStageDetails := []types.SleepStageDetail{}
-	if err := _db.Model(types.SleepStageDetail{}).Where(&types.SleepStageDetail{SleepLogID: value.LogID}).Scan(&sleepStageDetails); err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			log.Error(err)
-		}
-		return nil, err
-	}
-	for _, stage := range sleepStageDetails {
-		if stage.SleepStage == "DEEP" {
-			value.Levels.Summary.Deep = fitbit_types.SleepStageDetail{
-				Count:               stage.Count,
-				Minutes:             stage.Minutes,
-				ThirtyDayAvgMinutes: stage.ThirtyDayAvgMinutes,
-			}
-			continue
-		}
-		if stage.SleepStage == "LIGHT" {
-			value.Levels.Summary.Light = fitbit_types.SleepStageDetail{
-				Count:               stage.Count,
-				Minutes:             stage.Minutes,
-				ThirtyDayAvgMinutes: stage.ThirtyDayAvgMinutes,
-			}
-			continue
-		}
-		if stage.SleepStage == "REM" {
-			value.Levels.Summary.Rem = fitbit_types.SleepStageDetail{
-				Count:               stage.Count,
-				Minutes:             stage.Minutes,
-				ThirtyDayAvgMinutes: stage.ThirtyDayAvgMinutes,
-			}
-			continue
-		}
-		if stage.SleepStage == "WAKE" {
-			value.Levels.Summary.Wake = fitbit_types.SleepStageDetail{
-				Count:               stage.Count,
-				Minutes:             stage.Minutes,
-				ThirtyDayAvgMinutes: stage.ThirtyDayAvgMinutes,
-			}
-			continue
-		}
-	}
-
-	sleepData := []types.SleepData{}
-	if err := _db.Model(types.SleepData{}).Where(&types.SleepData{
-		SleepLogID: value.LogID,
-	}).Scan(&sleepData); err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			log.Error(err)
-		}
+// userSleepLogList returns all the sleep logs (main sleep and naps) of the date,
+// with the main sleep first.
+func (f *fetcher) userSleepLogList(date time.Time) ([]*types.SleepLog, error) {
+	sleepLogs, err := f.userSleepLogListByRange(date, date)
+	if err != nil {
 		return nil, err
 	}
-	// Data and short data is merged into data
-	for _, data := range sleepData {
-		value.Levels.Data = append(value.Levels.Data, fitbit_types.SleepData{
-			DateTime: fitbit_types.FitbitDateTime{Time: data.DateTime},
-			Level:    data.Level,
-			Seconds:  data.Seconds,
-		})
+	if value, ok := sleepLogs[dateKey(date)]; ok {
+		return value, nil
 	}
-
-	return &value, nil
+	return nil, sql.ErrNoRows
 }
 
 // Create a struct that given all the return types of the methods used inside the Fetch method,
@@ -648,7 +586,21 @@ type UserData struct {
 	OxygenSaturation     *types.OxygenSaturation
 	CardioFitnessScore   *types.CardioFitnessScore
 	HeartRateVariability *types.HeartRateVariabilityTimeSeries
-	SleepLog             *types.SleepLog
+	// SleepLog is the main sleep of the date, if any
+	SleepLog *types.SleepLog
+	// SleepLogs are all the sleep sessions of the date (main sleep and naps), with the main sleep first
+	SleepLogs []*types.SleepLog
+}
+
+// Naps returns the sleep sessions of the date that are not the main sleep.
+func (u *UserData) Naps() types.Naps {
+	var naps types.Naps
+	for _, sleepLog := range u.SleepLogs {
+		if !sleepLog.IsMainSleep {
+			naps = append(naps, *sleepLog)
+		}
+	}
+	return naps
 }
 
 // Headers returns the headers of the CSV file
@@ -682,6 +634,7 @@ func (UserData) Headers() []string {
 	ret = append(ret, types.CardioFitnessScore{}.Headers()...)
 	ret = append(ret, types.HeartRateVariabilityTimeSeries{}.Headers()...)
 	ret = append(ret, types.SleepLog{}.Headers()...)
+	ret = append(ret, types.Naps{}.Headers()...)
 	return ret
 }
 
@@ -829,6 +782,9 @@ func (u *UserData) Values() []string {
 	} else {
 		ret = append(ret, u.SleepLog.Values()...)
 	}
+
+	naps := u.Naps()
+	ret = append(ret, naps.Values()...)
 	return ret
 }
 
@@ -842,6 +798,12 @@ func (f *fetcher) FetchByDate(date time.Time) (*UserData, error) {
 	if dumping {
 		return nil, &FetcherError{errors.New("user is dumping")}
 	}
+	return f.fetchByDate(date), nil
+}
+
+// fetchByDate fetches all the user data available for the provided date,
+// even if the user is dumping.
+func (f *fetcher) fetchByDate(date time.Time) *UserData {
 	userData := UserData{
 		Date: date,
 	}
@@ -869,8 +831,9 @@ func (f *fetcher) FetchByDate(date time.Time) (*UserData, error) {
 	userData.OxygenSaturation, _ = f.userOxygenSaturation(date)
 	userData.CardioFitnessScore, _ = f.userCardioFitnessScore(date)
 	userData.HeartRateVariability, _ = f.userHeartRateVariability(date)
-	userData.SleepLog, _ = f.userSleepLogList(date)
-	return &userData, nil
+	userData.SleepLogs, _ = f.userSleepLogList(date)
+	userData.SleepLog = types.MainSleep(userData.SleepLogs)
+	return &userData
 }
 
 // FetchByRange fetches all the user data between startDate and endDate.
@@ -883,20 +846,13 @@ func (f *fetcher) FetchByRange(startDate, endDate time.Time) ([]*UserData, error
 	if dumping {
 		return nil, &FetcherError{errors.New("user is dumping")}
 	}
-	// TODO refactor the fetcher private methods to accept a range instead of a single date
-	// and use that methods here
-	var userData []*UserData
-	currentDate := startDate
-	for currentDate.Before(endDate) || currentDate.Equal(endDate) {
-		if dayData, err := f.FetchByDate(currentDate); err != nil {
-			log.Error(err)
-			return nil, err
-		} else {
-			userData = append(userData, dayData)
-		}
-		currentDate = currentDate.AddDate(0, 0, 1)
-	}
-	return userData, nil
+	return f.FetchPartialByRange(startDate, endDate)
+}
+
+// FetchPartialByRange fetches all the user data available between startDate and endDate,
+// even if the user is dumping. Used to show the data imported so far.
+func (f *fetcher) FetchPartialByRange(startDate, endDate time.Time) ([]*UserData, error) {
+	return f.fetchByRange(startDate, endDate)
 }
 
 type UserActivityTypes struct {
@@ -1040,7 +996,7 @@ func Fetch() echo.HandlerFunc {
 
 		if fetcher, err := NewFetcher(&user); err == nil {
 			if all, err := fetcher.Fetch(FetchAllWithSleepLog); err == nil {
-				if csv, err := userDataToCSV(all); err == nil {
+				if csv, err := userDataToCSV(all, newFeatureSpec(nil)); err == nil {
 					// Save complete csv to file
 					file, _ := os.Create("complete.csv")
 					io.WriteString(file, csv)
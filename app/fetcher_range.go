@@ -0,0 +1,344 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	fitbit_types "github.com/galeone/fitbit/v2/types"
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/gommon/log"
+)
+
+// The methods in this file are the range variants of the fetcher.user* methods.
+// Every method loads the data of a whole date range with a constant number of queries
+// (instead of a query per day) and returns it indexed by date (YYYY-MM-DD).
+// The related data (heart rate zones, sources, sleep stages, ...) is loaded with a
+// single query per table, filtering the rows with a subquery on the parent table.
+
+// dateKey is the key of the maps returned by the range methods
+func dateKey(date time.Time) string {
+	return date.Format(time.DateOnly)
+}
+
+// scanRange scans the result of the query in rows. No rows is not an error.
+func scanRange(err error) error {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// seriesByRange returns the rows of the time series table of model with the date between
+// startDate and endDate (included). When a date has more than a row, the first one inserted is used,
+// like the fetcher.user* methods do.
+func seriesByRange[T any](f *fetcher, model tableModel, startDate, endDate time.Time, date func(*T) time.Time) (map[string]*T, error) {
+	var rows []T
+	if err := scanRange(_db.Model(model).Where(`user_id = ? AND "date" BETWEEN ? AND ?`, f.user.ID, startDate, endDate).Order("id").Scan(&rows)); err != nil {
+		return nil, err
+	}
+	ret := make(map[string]*T, len(rows))
+	for i := range rows {
+		key := dateKey(date(&rows[i]))
+		if _, ok := ret[key]; !ok {
+			ret[key] = &rows[i]
+		}
+	}
+	return ret, nil
+}
+
+func (f *fetcher) userActivityLogListByRange(startDate, endDate time.Time) (map[string]*DailyActivities, error) {
+	const inRange = `user_id = ? AND date(start_time) BETWEEN ? AND ?`
+	start, end := startDate.Format(fitbit_types.DateLayout), endDate.Format(fitbit_types.DateLayout)
+
+	var activities []types.ActivityLog
+	if err := scanRange(_db.Model(types.ActivityLog{}).Where(inRange, f.user.ID, start, end).Order("start_time").Scan(&activities)); err != nil {
+		return nil, err
+	}
+	if len(activities) == 0 {
+		return map[string]*DailyActivities{}, nil
+	}
+
+	var minutesInHRZone []types.MinutesInHeartRateZone
+	if err := scanRange(_db.Model(types.MinutesInHeartRateZone{}).Where(
+		`active_zone_minutes_id IN (SELECT active_zone_minutes_id FROM activity_logs WHERE `+inRange+`)`,
+		f.user.ID, start, end).Order("id").Scan(&minutesInHRZone)); err != nil {
+		return nil, err
+	}
+	minutesByActiveZone := make(map[int64][]fitbit_types.MinutesInHeartRateZone)
+	for _, minInHRZone := range minutesInHRZone {
+		minutesByActiveZone[minInHRZone.ActiveZoneMinutesID] = append(minutesByActiveZone[minInHRZone.ActiveZoneMinutesID], minInHRZone.MinutesInHeartRateZone)
+	}
+
+	var sources []types.LogSource
+	if err := scanRange(_db.Model(types.LogSource{}).Where(
+		`id IN (SELECT source_id FROM activity_logs WHERE `+inRange+`)`,
+		f.user.ID, start, end).Scan(&sources)); err != nil {
+		return nil, err
+	}
+	sourceByID := make(map[string]fitbit_types.LogSource, len(sources))
+	for _, source := range sources {
+		sourceByID[source.ID] = source.LogSource
+	}
+
+	var zones []types.HeartRateZone
+	if err := scanRange(_db.Model(types.HeartRateZone{}).Where(
+		`activity_log_id IN (SELECT log_id FROM activity_logs WHERE `+inRange+`)`,
+		f.user.ID, start, end).Order("id").Scan(&zones)); err != nil {
+		return nil, err
+	}
+	zonesByActivity := make(map[int64][]types.HeartRateZone)
+	for _, zone := range zones {
+		zonesByActivity[zone.ActivityLogID.Int64] = append(zonesByActivity[zone.ActivityLogID.Int64], zone)
+	}
+
+	ret := make(map[string]*DailyActivities)
+	for _, activity := range activities {
+		if activity.ActiveZoneMinutesID.Valid {
+			activity.ActiveZoneMinutes.MinutesInHeartRateZones = minutesByActiveZone[activity.ActiveZoneMinutesID.Int64]
+		}
+		if activity.SourceID.Valid {
+			activity.Source.LogSource = sourceByID[activity.SourceID.String]
+		}
+		activity.HeartRateZones = zonesByActivity[activity.LogID]
+
+		key := dateKey(activity.StartTime)
+		if _, ok := ret[key]; !ok {
+			ret[key] = &DailyActivities{}
+		}
+		*ret[key] = append(*ret[key], activity)
+	}
+	return ret, nil
+}
+
+func (f *fetcher) userHeartRateTimeseriesByRange(startDate, endDate time.Time) (map[string]*types.HeartRateActivities, error) {
+	ret, err := seriesByRange(f, types.HeartRateActivities{}, startDate, endDate, func(t *types.HeartRateActivities) time.Time { return t.Date })
+	if err != nil || len(ret) == 0 {
+		return ret, err
+	}
+
+	var zones []types.HeartRateZone
+	if err = scanRange(_db.Model(types.HeartRateZone{}).Where(
+		`heart_rate_activity_id IN (SELECT id FROM heart_rate_activities WHERE user_id = ? AND "date" BETWEEN ? AND ?)`,
+		f.user.ID, startDate, endDate).Order("id").Scan(&zones)); err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*types.HeartRateActivities, len(ret))
+	for _, hrActivity := range ret {
+		byID[hrActivity.ID] = hrActivity
+	}
+	for _, zone := range zones {
+		hrActivity, ok := byID[zone.HeartRateActivityID.Int64]
+		if !ok {
+			continue
+		}
+		switch zone.Type {
+		case "DEFAULT":
+			hrActivity.HeartRateZones = append(hrActivity.HeartRateZones, zone)
+		case "CUSTOM":
+			hrActivity.CustomHeartRateZones = append(hrActivity.CustomHeartRateZones, zone)
+		}
+	}
+	return ret, nil
+}
+
+// userSleepLogListByRange returns all the sleep logs (main sleep and naps) of every date
+// between startDate and endDate. The logs of a date are ordered with the main sleep first,
+// followed by the other logs sorted by start time.
+func (f *fetcher) userSleepLogListByRange(startDate, endDate time.Time) (map[string][]*types.SleepLog, error) {
+	const inRange = `user_id = ? AND date_of_sleep BETWEEN ? AND ?`
+
+	var sleepLogs []types.SleepLog
+	if err := scanRange(_db.Model(types.SleepLog{}).Where(inRange, f.user.ID, startDate, endDate).Order("is_main_sleep DESC, start_time").Scan(&sleepLogs)); err != nil {
+		return nil, err
+	}
+	ret := make(map[string][]*types.SleepLog)
+	byID := make(map[int64]*types.SleepLog, len(sleepLogs))
+	for i := range sleepLogs {
+		key := dateKey(sleepLogs[i].DateOfSleep)
+		ret[key] = append(ret[key], &sleepLogs[i])
+		byID[sleepLogs[i].LogID] = &sleepLogs[i]
+	}
+	if len(ret) == 0 {
+		return ret, nil
+	}
+
+	var sleepStageDetails []types.SleepStageDetail
+	if err := scanRange(_db.Model(types.SleepStageDetail{}).Where(
+		`sleep_log_id IN (SELECT log_id FROM sleep_logs WHERE `+inRange+`)`,
+		f.user.ID, startDate, endDate).Scan(&sleepStageDetails)); err != nil {
+		return nil, err
+	}
+	for _, stage := range sleepStageDetails {
+		sleepLog, ok := byID[stage.SleepLogID]
+		if !ok {
+			continue
+		}
+		detail := fitbit_types.SleepStageDetail{
+			Count:               stage.Count,
+			Minutes:             stage.Minutes,
+			ThirtyDayAvgMinutes: stage.ThirtyDayAvgMinutes,
+		}
+		switch stage.SleepStage {
+		case "DEEP":
+			sleepLog.Levels.Summary.Deep = detail
+		case "LIGHT":
+			sleepLog.Levels.Summary.Light = detail
+		case "REM":
+			sleepLog.Levels.Summary.Rem = detail
+		case "WAKE":
+			sleepLog.Levels.Summary.Wake = detail
+		}
+	}
+
+	var sleepData []types.SleepData
+	if err := scanRange(_db.Model(types.SleepData{}).Where(
+		`sleep_log_id IN (SELECT log_id FROM sleep_logs WHERE `+inRange+`)`,
+		f.user.ID, startDate, endDate).Order("id").Scan(&sleepData)); err != nil {
+		return nil, err
+	}
+	// Data and short data is merged into data
+	for _, data := range sleepData {
+		sleepLog, ok := byID[data.SleepLogID]
+		if !ok {
+			continue
+		}
+		sleepLog.Levels.Data = append(sleepLog.Levels.Data, fitbit_types.SleepData{
+			DateTime: fitbit_types.FitbitDateTime{Time: data.DateTime},
+			Level:    data.Level,
+			Seconds:  data.Seconds,
+		})
+	}
+	return ret, nil
+}
+
+// fetchByRange fetches all the user data available between startDate and endDate (included).
+// It returns the same data of calling fetchByDate for every date in the range,
+// loading every table with a constant number of queries.
+func (f *fetcher) fetchByRange(startDate, endDate time.Time) ([]*UserData, error) {
+	activities, err := f.userActivityLogListByRange(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	activityCalories, err := seriesByRange(f, types.ActivityCaloriesSeries{}, startDate, endDate, func(t *types.ActivityCaloriesSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	bmi, err := seriesByRange(f, types.BMISeries{}, startDate, endDate, func(t *types.BMISeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	bodyFat, err := seriesByRange(f, types.BodyFatSeries{}, startDate, endDate, func(t *types.BodyFatSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	bodyWeight, err := seriesByRange(f, types.BodyWeightSeries{}, startDate, endDate, func(t *types.BodyWeightSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	caloriesBMR, err := seriesByRange(f, types.CaloriesBMRSeries{}, startDate, endDate, func(t *types.CaloriesBMRSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	calories, err := seriesByRange(f, types.CaloriesSeries{}, startDate, endDate, func(t *types.CaloriesSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	distance, err := seriesByRange(f, types.DistanceSeries{}, startDate, endDate, func(t *types.DistanceSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	floors, err := seriesByRange(f, types.FloorsSeries{}, startDate, endDate, func(t *types.FloorsSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	minutesFairlyActive, err := seriesByRange(f, types.MinutesFairlyActiveSeries{}, startDate, endDate, func(t *types.MinutesFairlyActiveSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	minutesLightlyActive, err := seriesByRange(f, types.MinutesLightlyActiveSeries{}, startDate, endDate, func(t *types.MinutesLightlyActiveSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	minutesSedentary, err := seriesByRange(f, types.MinutesSedentarySeries{}, startDate, endDate, func(t *types.MinutesSedentarySeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	minutesVeryActive, err := seriesByRange(f, types.MinutesVeryActiveSeries{}, startDate, endDate, func(t *types.MinutesVeryActiveSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	steps, err := seriesByRange(f, types.StepsSeries{}, startDate, endDate, func(t *types.StepsSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	heartRate, err := f.userHeartRateTimeseriesByRange(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	elevation, err := seriesByRange(f, types.ElevationSeries{}, startDate, endDate, func(t *types.ElevationSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	skinTemperature, err := seriesByRange(f, types.SkinTemperature{}, startDate, endDate, func(t *types.SkinTemperature) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	coreTemperature, err := seriesByRange(f, types.CoreTemperature{}, startDate, endDate, func(t *types.CoreTemperature) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	oxygenSaturation, err := seriesByRange(f, types.OxygenSaturation{}, startDate, endDate, func(t *types.OxygenSaturation) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	cardioFitnessScore, err := seriesByRange(f, types.CardioFitnessScore{}, startDate, endDate, func(t *types.CardioFitnessScore) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	heartRateVariability, err := seriesByRange(f, types.HeartRateVariabilityTimeSeries{}, startDate, endDate, func(t *types.HeartRateVariabilityTimeSeries) time.Time { return t.Date })
+	if err != nil {
+		return nil, err
+	}
+	sleepLogs, err := f.userSleepLogListByRange(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var userData []*UserData
+	for date := startDate; !date.After(endDate); date = date.AddDate(0, 0, 1) {
+		key := dateKey(date)
+		userData = append(userData, &UserData{
+			Date:                 date,
+			Activities:           activities[key],
+			ActivityCalories:     activityCalories[key],
+			BMI:                  bmi[key],
+			BodyFat:              bodyFat[key],
+			BodyWeight:           bodyWeight[key],
+			CaloriesBMR:          caloriesBMR[key],
+			Calories:             calories[key],
+			Distance:             distance[key],
+			Floors:               floors[key],
+			MinutesFairlyActive:  minutesFairlyActive[key],
+			MinutesLightlyActive: minutesLightlyActive[key],
+			MinutesSedentary:     minutesSedentary[key],
+			MinutesVeryActive:    minutesVeryActive[key],
+			Steps:                steps[key],
+			HeartRate:            heartRate[key],
+			Elevation:            elevation[key],
+			SkinTemperature:      skinTemperature[key],
+			CoreTemperature:      coreTemperature[key],
+			OxygenSaturation:     oxygenSaturation[key],
+			CardioFitnessScore:   cardioFitnessScore[key],
+			HeartRateVariability: heartRateVariability[key],
+			SleepLogs:            sleepLogs[key],
+			SleepLog:             types.MainSleep(sleepLogs[key]),
+		})
+	}
+	return userData, nil
+}
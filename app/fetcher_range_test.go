@@ -0,0 +1,53 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+// benchmarkFetcher returns the fetcher of the first user of the database configured in the
+// environment, and skips the benchmark if the database is not available.
+func benchmarkFetcher(b *testing.B) *fetcher {
+	b.Helper()
+	testDB(b)
+	var user types.User
+	if err := _db.Model(types.User{}).Order("id").Limit(1).Scan(&user); err != nil {
+		b.Skipf("no user in the database: %s", err)
+	}
+	f, err := NewFetcher(&user)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return f
+}
+
+// BenchmarkFetchByRange compares the range loader with the per-day loader, on the 30 days
+// before today: go test ./app -run '^$' -bench FetchByRange
+func BenchmarkFetchByRange(b *testing.B) {
+	f := benchmarkFetcher(b)
+	endDate := time.Now().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	startDate := endDate.AddDate(0, 0, -29)
+
+	b.Run("range", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := f.fetchByRange(startDate, endDate); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("per_day", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for date := startDate; !date.After(endDate); date = date.AddDate(0, 0, 1) {
+				if _, err := f.FetchByDate(date); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,319 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/galeone/fitbit/v2"
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// Fitbit API rate limits
+// https://dev.fitbit.com/build/reference/web-api/developer-guide/application-design/#Rate-Limits
+//
+// Every user can perform 150 requests per hour. Every response contains the headers
+// with the state of the quota.
+const (
+	fitbitAPIHost               = "api.fitbit.com"
+	fitbitRateLimitHeader       = "Fitbit-Rate-Limit-Limit"
+	fitbitRateLimitRemaining    = "Fitbit-Rate-Limit-Remaining"
+	fitbitRateLimitResetSeconds = "Fitbit-Rate-Limit-Reset"
+	// fitbitTokenTimeout is the timeout of the requests to the OAuth2 endpoints
+	fitbitTokenTimeout = 30 * time.Second
+	// maxCachedAccessTokens is the maximum number of access tokens whose user is cached by the fitbitTransport.
+	// The access tokens expire every 8 hours: when full, the cache is emptied.
+	maxCachedAccessTokens = 1000
+)
+
+// _fitbitTransport sends the requests of every Fitbit client, see newFitbitAuthorizer.
+var _fitbitTransport = newFitbitTransport(http.DefaultTransport, dbQuotaStore{})
+
+// newFitbitAuthorizer returns the authorizer of the Fitbit API: the requests of its clients,
+// and the ones of the clients created from it, are sent through _fitbitTransport.
+// The token requests time out after fitbitTokenTimeout. The API requests don't, since
+// they wait for the reset of the quota: they only use the transport of the client.
+func newFitbitAuthorizer() *fitbit.Authorizer {
+	authorizer := fitbit.NewAuthorizer(_db, _clientID, _clientSecret, _redirectURL)
+	authorizer.SetHTTPClient(&http.Client{Transport: _fitbitTransport, Timeout: fitbitTokenTimeout})
+	return authorizer
+}
+
+// quotaStore persists the rate limit quota of the users.
+type quotaStore interface {
+	// UserID returns the ID of the user that owns the access token.
+	UserID(accessToken string) (int64, error)
+	// Quota returns the last quota stored for the user, if any.
+	Quota(userID int64) (*types.RateLimit, error)
+	// SaveQuota stores the quota.
+	SaveQuota(quota *types.RateLimit) error
+}
+
+// dbQuotaStore is the quotaStore backed by the fitbit_rate_limits table.
+type dbQuotaStore struct{}
+
+func (dbQuotaStore) UserID(accessToken string) (int64, error) {
+	user, err := userByAccessToken(accessToken)
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+func (dbQuotaStore) Quota(userID int64) (*types.RateLimit, error) {
+	quota := types.RateLimit{UserID: userID}
+	if err := _db.Model(types.RateLimit{}).Where(&quota).Scan(&quota); err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+func (dbQuotaStore) SaveQuota(quota *types.RateLimit) error {
+	return _db.Model(types.RateLimit{}).Exec(
+		`INSERT INTO fitbit_rate_limits(user_id, quota_limit, remaining, reset_at, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET quota_limit = EXCLUDED.quota_limit, remaining = EXCLUDED.remaining,
+		reset_at = EXCLUDED.reset_at, updated_at = EXCLUDED.updated_at`,
+		quota.UserID, quota.QuotaLimit, quota.Remaining, quota.ResetAt, quota.UpdatedAt)
+}
+
+// fitbitTransport is the http.RoundTripper used for the requests to the Fitbit API.
+// It reads the rate limit headers and tracks the quota of every user, waits for the
+// quota reset when the quota is exhausted, and retries the GET requests that failed
+// with 429 or 5xx status codes, using an exponential backoff (see retryable).
+// The requests to other hosts are sent unchanged.
+type fitbitTransport struct {
+	base  http.RoundTripper
+	store quotaStore
+	host  string
+
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	now        func() time.Time
+	sleep      func(ctx context.Context, d time.Duration) error
+
+	mu     sync.Mutex
+	users  map[string]int64
+	quotas map[int64]*types.RateLimit
+}
+
+func newFitbitTransport(base http.RoundTripper, store quotaStore) *fitbitTransport {
+	return &fitbitTransport{
+		base:       base,
+		store:      store,
+		host:       fitbitAPIHost,
+		maxRetries: 3,
+		backoff:    time.Second,
+		maxBackoff: time.Minute,
+		now:        time.Now,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(d):
+				return nil
+			}
+		},
+		users:  map[string]int64{},
+		quotas: map[int64]*types.RateLimit{},
+	}
+}
+
+// userID returns the ID of the user that sent the request, or 0 if unknown.
+func (t *fitbitTransport) userID(req *http.Request) int64 {
+	accessToken, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return 0
+	}
+
+	t.mu.Lock()
+	userID, ok := t.users[accessToken]
+	t.mu.Unlock()
+	if ok {
+		return userID
+	}
+	// The store is queried without the lock: the requests of the other users don't wait for it
+	userID, err := t.store.UserID(accessToken)
+	if err != nil {
+		return 0
+	}
+	t.mu.Lock()
+	if len(t.users) >= maxCachedAccessTokens {
+		clear(t.users)
+	}
+	t.users[accessToken] = userID
+	t.mu.Unlock()
+	return userID
+}
+
+// quota returns the quota of the user, loading it from the store the first time.
+func (t *fitbitTransport) quota(userID int64) *types.RateLimit {
+	t.mu.Lock()
+	quota, ok := t.quotas[userID]
+	t.mu.Unlock()
+	if ok {
+		return quota
+	}
+	quota, err := t.store.Quota(userID)
+	if err != nil {
+		quota = &types.RateLimit{UserID: userID}
+	}
+	t.mu.Lock()
+	// A response received in the meantime has the most recent quota
+	if current, ok := t.quotas[userID]; ok {
+		quota = current
+	} else {
+		t.quotas[userID] = quota
+	}
+	t.mu.Unlock()
+	return quota
+}
+
+// updateQuota updates the quota of the user using the rate limit headers of the response.
+func (t *fitbitTransport) updateQuota(userID int64, res *http.Response) {
+	limit, errLimit := strconv.ParseInt(res.Header.Get(fitbitRateLimitHeader), 10, 64)
+	remaining, errRemaining := strconv.ParseInt(res.Header.Get(fitbitRateLimitRemaining), 10, 64)
+	reset, errReset := strconv.ParseInt(res.Header.Get(fitbitRateLimitResetSeconds), 10, 64)
+	if errLimit != nil || errRemaining != nil || errReset != nil {
+		return
+	}
+
+	now := t.now().UTC()
+	quota := &types.RateLimit{
+		UserID:     userID,
+		QuotaLimit: limit,
+		Remaining:  remaining,
+		ResetAt:    now.Add(time.Duration(reset) * time.Second),
+		UpdatedAt:  now,
+	}
+	t.mu.Lock()
+	t.quotas[userID] = quota
+	t.mu.Unlock()
+
+	if err := t.store.SaveQuota(quota); err != nil {
+		log.Error("fitbitTransport.SaveQuota: ", err)
+	}
+}
+
+// quotaReset returns how long to wait for the reset of the quota of the user, 0 if not exhausted.
+func (t *fitbitTransport) quotaReset(userID int64) time.Duration {
+	quota := t.quota(userID)
+	if quota.QuotaLimit == 0 || quota.Remaining > 0 {
+		return 0
+	}
+	return max(quota.ResetAt.Sub(t.now().UTC()), 0)
+}
+
+// waitQuota waits until the quota of the user is reset, if exhausted.
+func (t *fitbitTransport) waitQuota(ctx context.Context, userID int64) error {
+	wait := t.quotaReset(userID)
+	if wait == 0 {
+		return nil
+	}
+	log.Printf("Fitbit API quota of user %d exhausted, pausing for %s", userID, wait)
+	if err := t.sleep(ctx, wait); err != nil {
+		return err
+	}
+	log.Printf("Fitbit API quota of user %d reset, resuming", userID)
+	return nil
+}
+
+// retryAfter returns how long to wait before retrying the request that received res.
+func (t *fitbitTransport) retryAfter(res *http.Response, attempt int) time.Duration {
+	if res.StatusCode == http.StatusTooManyRequests {
+		for _, header := range []string{"Retry-After", fitbitRateLimitResetSeconds} {
+			if seconds, err := strconv.ParseInt(res.Header.Get(header), 10, 64); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	backoff := t.backoff << attempt
+	if backoff > t.maxBackoff || backoff <= 0 {
+		backoff = t.maxBackoff
+	}
+	// full jitter
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+// retryable returns true if the request, that received res, can succeed if sent again.
+func retryable(req *http.Request, res *http.Response) bool {
+	// The activity list answers 504 when there are no more activities (see userActivityLogList)
+	if res.StatusCode == http.StatusGatewayTimeout && strings.HasSuffix(req.URL.Path, "/activities/list.json") {
+		return false
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *fitbitTransport) RoundTrip(req *http.Request) (res *http.Response, err error) {
+	// The OAuth2 endpoints are not part of the rate limited API
+	if req.URL.Host != t.host || strings.HasPrefix(req.URL.Path, "/oauth2/") {
+		return t.base.RoundTrip(req)
+	}
+
+	userID := t.userID(req)
+	// Only requests without a body can be sent again
+	canRetry := req.Method == http.MethodGet && req.Body == nil
+	for attempt := 0; ; attempt++ {
+		if userID != 0 {
+			if err = t.waitQuota(req.Context(), userID); err != nil {
+				return nil, err
+			}
+		}
+
+		if res, err = t.base.RoundTrip(req); err != nil {
+			return nil, err
+		}
+		if userID != 0 {
+			t.updateQuota(userID, res)
+		}
+
+		if !canRetry || !retryable(req, res) || attempt >= t.maxRetries {
+			return res, nil
+		}
+
+		res.Body.Close()
+		// When the quota is exhausted, waitQuota pauses until the reset. Otherwise, as when
+		// the reset is already passed, the backoff prevents sending the request again immediately.
+		if userID != 0 && res.StatusCode == http.StatusTooManyRequests && t.quotaReset(userID) > 0 {
+			continue
+		}
+		wait := t.retryAfter(res, attempt)
+		log.Printf("Fitbit API %s returned %d, retrying in %s", req.URL.Path, res.StatusCode, wait)
+		if err = t.sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Quota returns, as JSON, the state of the Fitbit API quota of the logged user.
+func Quota() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+
+		var quota *types.RateLimit
+		if quota, err = (dbQuotaStore{}).Quota(user.ID); err != nil {
+			// No requests sent yet
+			quota = &types.RateLimit{UserID: user.ID}
+		}
+		return c.JSON(http.StatusOK, echo.Map{
+			"limit":     quota.QuotaLimit,
+			"remaining": quota.Remaining,
+			"reset_at":  quota.ResetAt,
+			"exhausted": quota.QuotaLimit > 0 && quota.Remaining <= 0 && time.Now().UTC().Before(quota.ResetAt),
+		})
+	}
+}
@@ -0,0 +1,297 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/galeone/fitbit/v2/client"
+	fitbit_types "github.com/galeone/fitbit/v2/types"
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+// memoryQuotaStore is a quotaStore in memory. The access tokens are "user-<ID>".
+type memoryQuotaStore struct {
+	mu      sync.Mutex
+	lookups int
+	quotas  map[int64]*types.RateLimit
+}
+
+func (s *memoryQuotaStore) UserID(accessToken string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookups++
+	value, ok := strings.CutPrefix(accessToken, "user-")
+	if !ok {
+		return 0, errors.New("unknown access token")
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func (s *memoryQuotaStore) Quota(userID int64) (*types.RateLimit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if quota, ok := s.quotas[userID]; ok {
+		return quota, nil
+	}
+	return nil, errors.New("no quota")
+}
+
+func (s *memoryQuotaStore) SaveQuota(quota *types.RateLimit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quotas[quota.UserID] = quota
+	return nil
+}
+
+// stubFitbitAPI is a Fitbit API that answers with the status codes of the responses, in order,
+// and then with 200. Every response contains the rate limit headers of the quota.
+type stubFitbitAPI struct {
+	*httptest.Server
+	mu        sync.Mutex
+	responses []stubResponse
+	requests  int
+}
+
+type stubResponse struct {
+	status         int
+	remaining      int
+	resetInSeconds int
+}
+
+func newStubFitbitAPI(responses ...stubResponse) *stubFitbitAPI {
+	api := &stubFitbitAPI{responses: responses}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		response := stubResponse{status: http.StatusOK, remaining: 100, resetInSeconds: 3600}
+		if api.requests < len(api.responses) {
+			response = api.responses[api.requests]
+		}
+		api.requests++
+		api.mu.Unlock()
+
+		w.Header().Set(fitbitRateLimitHeader, "150")
+		w.Header().Set(fitbitRateLimitRemaining, strconv.Itoa(response.remaining))
+		w.Header().Set(fitbitRateLimitResetSeconds, strconv.Itoa(response.resetInSeconds))
+		w.WriteHeader(response.status)
+	}))
+	return api
+}
+
+// testFitbitTransport returns the transport for the requests to the api, and the durations of its pauses.
+func testFitbitTransport(t *testing.T, api *stubFitbitAPI) (*fitbitTransport, *memoryQuotaStore, *[]time.Duration) {
+	store := &memoryQuotaStore{quotas: map[int64]*types.RateLimit{}}
+	transport := newFitbitTransport(http.DefaultTransport, store)
+	serverURL, err := url.Parse(api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport.host = serverURL.Host
+	now := time.Date(2024, time.March, 4, 12, 0, 0, 0, time.UTC)
+	transport.now = func() time.Time { return now }
+	var pauses []time.Duration
+	transport.sleep = func(_ context.Context, d time.Duration) error {
+		pauses = append(pauses, d)
+		now = now.Add(d)
+		return nil
+	}
+	return transport, store, &pauses
+}
+
+func getWithToken(t *testing.T, transport http.RoundTripper, endpoint, accessToken string) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res
+}
+
+func TestFitbitTransportRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		path       string
+		responses  []stubResponse
+		wantStatus int
+		wantSent   int
+		wantPauses int
+	}{
+		{
+			name:       "5xx",
+			path:       "/1/user/-/sleep/list.json",
+			responses:  []stubResponse{{http.StatusInternalServerError, 100, 3600}, {http.StatusBadGateway, 99, 3600}},
+			wantStatus: http.StatusOK, wantSent: 3, wantPauses: 2,
+		},
+		{
+			name:       "too many 5xx",
+			path:       "/1/user/-/sleep/list.json",
+			responses:  []stubResponse{{503, 100, 3600}, {503, 100, 3600}, {503, 100, 3600}, {503, 100, 3600}},
+			wantStatus: http.StatusServiceUnavailable, wantSent: 4, wantPauses: 3,
+		},
+		{
+			name:       "end of the activities",
+			path:       "/1/user/-/activities/list.json",
+			responses:  []stubResponse{{http.StatusGatewayTimeout, 100, 3600}},
+			wantStatus: http.StatusGatewayTimeout, wantSent: 1, wantPauses: 0,
+		},
+		{
+			name:       "4xx",
+			path:       "/1/user/-/sleep/list.json",
+			responses:  []stubResponse{{http.StatusForbidden, 100, 3600}},
+			wantStatus: http.StatusForbidden, wantSent: 1, wantPauses: 0,
+		},
+		{
+			name:       "quota exhausted",
+			path:       "/1/user/-/sleep/list.json",
+			responses:  []stubResponse{{http.StatusTooManyRequests, 0, 600}},
+			wantStatus: http.StatusOK, wantSent: 2, wantPauses: 1,
+		},
+		{
+			// The quota is exhausted, but its reset is already passed: the backoff prevents a busy loop
+			name:       "quota reset",
+			path:       "/1/user/-/sleep/list.json",
+			responses:  []stubResponse{{http.StatusTooManyRequests, 0, 0}, {http.StatusTooManyRequests, 0, 0}},
+			wantStatus: http.StatusOK, wantSent: 3, wantPauses: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			api := newStubFitbitAPI(tc.responses...)
+			defer api.Close()
+			transport, _, pauses := testFitbitTransport(t, api)
+
+			res := getWithToken(t, transport, api.URL+tc.path, "user-1")
+			if res.StatusCode != tc.wantStatus {
+				t.Errorf("status = %d, want %d", res.StatusCode, tc.wantStatus)
+			}
+			if api.requests != tc.wantSent {
+				t.Errorf("%d requests sent, want %d", api.requests, tc.wantSent)
+			}
+			if len(*pauses) != tc.wantPauses {
+				t.Errorf("%d pauses, want %d", len(*pauses), tc.wantPauses)
+			}
+			for _, pause := range *pauses {
+				if pause <= 0 {
+					t.Errorf("pause of %s", pause)
+				}
+			}
+		})
+	}
+}
+
+func TestFitbitTransportQuota(t *testing.T) {
+	api := newStubFitbitAPI(stubResponse{http.StatusOK, 0, 600})
+	defer api.Close()
+	transport, store, pauses := testFitbitTransport(t, api)
+
+	getWithToken(t, transport, api.URL+"/1/user/-/sleep/list.json", "user-1")
+	if quota := store.quotas[1]; quota == nil || quota.QuotaLimit != 150 || quota.Remaining != 0 {
+		t.Fatalf("stored quota = %+v, want limit 150 and 0 remaining", quota)
+	}
+	// The next request of the user waits for the reset, the requests of the other users don't
+	getWithToken(t, transport, api.URL+"/1/user/-/sleep/list.json", "user-2")
+	if len(*pauses) != 0 {
+		t.Errorf("the request of another user paused for %v", *pauses)
+	}
+	getWithToken(t, transport, api.URL+"/1/user/-/sleep/list.json", "user-1")
+	if len(*pauses) != 1 || (*pauses)[0] != 10*time.Minute {
+		t.Errorf("pauses = %v, want the 10 minutes to the reset", *pauses)
+	}
+	// The users of the access tokens are cached
+	if store.lookups != 2 {
+		t.Errorf("%d lookups of the access tokens, want 2", store.lookups)
+	}
+	// The requests to the other hosts and to the OAuth2 endpoints are not rate limited
+	getWithToken(t, transport, api.URL+"/oauth2/token", "user-1")
+	if len(*pauses) != 1 {
+		t.Errorf("the request to the OAuth2 endpoint paused")
+	}
+}
+
+func TestFitbitTransportUsersCache(t *testing.T) {
+	api := newStubFitbitAPI()
+	defer api.Close()
+	transport, store, _ := testFitbitTransport(t, api)
+	for i := 0; i <= maxCachedAccessTokens; i++ {
+		getWithToken(t, transport, api.URL+"/1/user/-/sleep/list.json", "user-"+strconv.Itoa(i+1))
+	}
+	if len(transport.users) > maxCachedAccessTokens {
+		t.Errorf("%d access tokens cached, the maximum is %d", len(transport.users), maxCachedAccessTokens)
+	}
+	if store.lookups != maxCachedAccessTokens+1 {
+		t.Errorf("%d lookups, want %d", store.lookups, maxCachedAccessTokens+1)
+	}
+}
+
+// roundTripperFunc is an http.RoundTripper that calls the function.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewFitbitAuthorizer(t *testing.T) {
+	// The Fitbit API answers to every request with an empty activity list
+	var mu sync.Mutex
+	var hosts []string
+	store := &memoryQuotaStore{quotas: map[int64]*types.RateLimit{}}
+	transport := newFitbitTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		hosts = append(hosts, req.URL.Host)
+		mu.Unlock()
+		header := http.Header{}
+		header.Set(fitbitRateLimitHeader, "150")
+		header.Set(fitbitRateLimitRemaining, "149")
+		header.Set(fitbitRateLimitResetSeconds, "3600")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader(`{"activities": []}`)),
+			Request:    req,
+		}, nil
+	}), store)
+	previous := _fitbitTransport
+	_fitbitTransport = transport
+	defer func() { _fitbitTransport = previous }()
+
+	authorizer := newFitbitAuthorizer()
+	authorizer.SetToken(&fitbit_types.AuthorizedUser{AccessToken: "user-7", ExpiresIn: 3600})
+	fb, err := client.NewClient(authorizer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Req creates a new http.Client: it must use the transport too
+	for i := 0; i < 2; i++ {
+		if _, err = fb.UserActivityLogList(&fitbit_types.Pagination{Limit: 1, Sort: "asc"}); err != nil {
+			t.Fatal(err)
+		}
+		if err = fb.Req(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(hosts) != 2 || hosts[0] != fitbitAPIHost {
+		t.Errorf("requests sent to %v, want 2 requests to %s", hosts, fitbitAPIHost)
+	}
+	if store.quotas[7] == nil {
+		t.Error("the requests of the Fitbit client didn't go through the fitbitTransport")
+	}
+	if http.DefaultTransport == http.RoundTripper(transport) {
+		t.Error("http.DefaultTransport has been replaced")
+	}
+}
@@ -7,6 +7,8 @@ package app
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	pgdb "github.com/galeone/fitbit-pgdb/v3"
 	"github.com/galeone/fitsleepinsights/database/types"
@@ -18,7 +20,8 @@ var (
 	_connectionString = fmt.Sprintf(
 		"host=%s user=%s password=%s port=%s dbname=%s sslmode=disable",
 		os.Getenv("DB_HOST"), os.Getenv("DB_USER"), os.Getenv("DB_PASS"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
-	_db           = pgdb.NewPGDB(_connectionString)
+	// _db is the connection to the database, opened by Init
+	_db           *pgdb.PGDB
 	_clientID     = os.Getenv("FITBIT_CLIENT_ID")
 	_clientSecret = os.Getenv("FITBIT_CLIENT_SECRET")
 	_redirectURL  = os.Getenv("FITBIT_REDIRECT_URL")
@@ -44,10 +47,126 @@ var (
 	_vaiProjectID          = os.Getenv("VAI_PROJECT_ID")
 	_vaiServiceAccountKey  = os.Getenv("VAI_SERVICE_ACCOUNT_KEY")
 	_vaiEndpoint           = fmt.Sprintf("%s-aiplatform.googleapis.com:443", _vaiLocation)
-	_vaiEmbeddingsEndpoint = fmt.Sprintf("projects/%s/locations/%s/publishers/%s/models/%s", _vaiProjectID, _vaiLocation, "google", "text-embedding-005")
+	_vaiEmbeddingModel     = stringFromEnv("VAI_EMBEDDING_MODEL", "text-embedding-005")
+	_vaiEmbeddingsEndpoint = fmt.Sprintf("projects/%s/locations/%s/publishers/%s/models/%s", _vaiProjectID, _vaiLocation, "google", _vaiEmbeddingModel)
+	// VAI_CHAT_MODEL and VAI_CHAT_LOCATION are the Gemini model used for the generation, and its region.
+	_vaiChatModel    = stringFromEnv("VAI_CHAT_MODEL", "gemini-2.0-flash")
+	_vaiChatLocation = stringFromEnv("VAI_CHAT_LOCATION", "us-central1")
+
+	// LLM:
+	// LLM_PROVIDER selects the LLM used for the chat, the reports and the embeddings:
+	// - "vertex": Vertex AI, configured with the VAI_* variables
+	// - "openai": an OpenAI-compatible API (e.g. a local Ollama or llama.cpp server), configured with the OPENAI_* variables
+	// - "fake": a deterministic offline provider, for development and tests
+	_llmProvider          = stringFromEnv("LLM_PROVIDER", llmProviderVertex)
+	_openAIBaseURL        = stringFromEnv("OPENAI_BASE_URL", "http://localhost:11434/v1")
+	_openAIAPIKey         = os.Getenv("OPENAI_API_KEY")
+	_openAIChatModel      = stringFromEnv("OPENAI_CHAT_MODEL", "llama3.1")
+	_openAIEmbeddingModel = stringFromEnv("OPENAI_EMBEDDING_MODEL", "nomic-embed-text")
+
+	// Embeddings:
+	// EMBEDDING_PROVIDER selects the model that embeds the reports: "vertex", "openai" or "hash"
+	// (a local hashing of the words, that needs no model). When empty, the LLM_PROVIDER is used.
+	// HASH_EMBEDDING_DIM is the dimension of the "hash" embeddings.
+	// When the model changes, the reports are embedded again in background.
+	_embeddingProvider = os.Getenv("EMBEDDING_PROVIDER")
+	_hashEmbeddingDim  = intFromEnv("HASH_EMBEDDING_DIM", 768)
 
 	// Fitbit:
 	// At startup, we recommend your application retrieve the complete list of activities, cache the results and display the results in the application’s UI later.
 	// https://dev.fitbit.com/build/reference/web-api/activity/get-all-activity-types/
 	_allActivityCatalog []types.Category = nil
+
+	// Background synchronization:
+	// SYNC_INTERVAL is the cadence of the incremental dump of every authorized user (Go duration, e.g. "6h").
+	// SYNC_JITTER is the maximum random delay added before every user synchronization, so we don't hit
+	// the Fitbit API with all the users at the same instant.
+	// SYNC_CONCURRENCY is the maximum number of users synchronized at the same time.
+	_syncInterval    = durationFromEnv("SYNC_INTERVAL", 6*time.Hour)
+	_syncJitter      = durationFromEnv("SYNC_JITTER", 10*time.Minute)
+	_syncConcurrency = intFromEnv("SYNC_CONCURRENCY", 1)
+
+	// Fitbit Subscriptions API:
+	// FITBIT_SUBSCRIBER_VERIFY is the verification code of the subscriber, shown in the Fitbit application settings.
+	// When empty, the webhook is disabled and no subscription is registered.
+	// FITBIT_SUBSCRIBER_ID is the ID of the subscriber. Required only when more than one subscriber is configured.
+	_subscriberVerificationCode = os.Getenv("FITBIT_SUBSCRIBER_VERIFY")
+	_subscriberID               = os.Getenv("FITBIT_SUBSCRIBER_ID")
+
+	// INTRADAY_DAYS is the number of past days whose intraday data is dumped when the user has none.
+	// Every day of intraday data costs a request per data type, thus the history is limited.
+	// 0 disables the intraday data.
+	_intradayDays = nonNegativeIntFromEnv("INTRADAY_DAYS", 7)
+
+	// TCX_QUOTA_RESERVE is the number of requests of the hourly Fitbit API quota of the user
+	// left to the other data types: the TCX of the activities are dumped only above it.
+	_tcxQuotaReserve = intFromEnv("TCX_QUOTA_RESERVE", 50)
+
+	// DAILY_REPORT_SUMMARY enables the summary of the daily reports, written by the LLM.
+	// The rest of the daily reports is rendered from the data, without the LLM.
+	_dailyReportSummary = boolFromEnv("DAILY_REPORT_SUMMARY", true)
+
+	// REPORT_CONCURRENCY is the number of reports generated at the same time by the ReportQueue.
+	// REPORT_MAX_ATTEMPTS is the number of attempts before a report job is marked as failed.
+	_reportConcurrency = intFromEnv("REPORT_CONCURRENCY", 2)
+	_reportMaxAttempts = intFromEnv("REPORT_MAX_ATTEMPTS", 5)
+
+	// PREDICTOR_BACKEND is where the predictors are trained and served: "local" (in process)
+	// or "vertex" (custom training job and endpoint on Vertex AI).
+	_predictorBackend = stringFromEnv("PREDICTOR_BACKEND", predictorBackendLocal)
+	// PREDICTOR_RETRAIN_DAYS is the number of new nights after which a predictor trained in process
+	// is trained again, by the background synchronization.
+	_predictorRetrainDays = intFromEnv("PREDICTOR_RETRAIN_DAYS", 7)
 )
+
+// Init connects to the database and starts the listeners of the application: the new users
+// and the Fitbit notifications. It must be called once, after database.Init and before serving.
+// The rest of the package can be used (and tested) without a database.
+func Init() {
+	_db = pgdb.NewPGDB(_connectionString)
+	listenNewUsers()
+	go processNotifications()
+}
+
+// durationFromEnv parses the environment variable key as a time.Duration.
+// It returns defaultValue if the variable is not set or it's not a valid duration.
+func durationFromEnv(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// stringFromEnv returns the environment variable key, or defaultValue if it's not set.
+func stringFromEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// intFromEnv parses the environment variable key as an int.
+// It returns defaultValue if the variable is not set or it's not a valid positive integer.
+func intFromEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// nonNegativeIntFromEnv is intFromEnv, but 0 is a valid value.
+func nonNegativeIntFromEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value >= 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// boolFromEnv parses the environment variable key as a bool.
+// It returns defaultValue if the variable is not set or it's not a valid bool.
+func boolFromEnv(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,67 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	pgdb "github.com/galeone/fitbit-pgdb/v3"
+	fitbit_types "github.com/galeone/fitbit/v2/types"
+	"github.com/galeone/fitsleepinsights/database"
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/galeone/igor"
+)
+
+var _testSchema sync.Once
+
+// testDB connects to the database configured in the environment, creating its schema, and
+// skips the test (or the benchmark) if the database is not available.
+func testDB(tb testing.TB) {
+	tb.Helper()
+	if _db == nil {
+		db, err := igor.Connect(_connectionString)
+		if err != nil {
+			tb.Skipf("the database is not available: %s", err)
+		}
+		_db = pgdb.NewPGDBFromConnection(db.DB())
+	}
+	_testSchema.Do(database.Init)
+}
+
+// testDBUser creates a user in the database, deleted with its data at the end of the test.
+func testDBUser(t *testing.T) *types.User {
+	t.Helper()
+	testDB(t)
+	token := fitbit_types.AuthorizedUser{
+		AccessToken:  fmt.Sprintf("test-access-%d", time.Now().UnixNano()),
+		ExpiresIn:    28800,
+		RefreshToken: "test-refresh",
+		Scope:        "sleep",
+		TokenType:    "Bearer",
+		UserID:       fmt.Sprintf("test-%d", time.Now().UnixNano()),
+	}
+	if err := _db.UpsertAuthorizedUser(&token); err != nil {
+		t.Fatal(err)
+	}
+	user := types.User{}
+	user.UserID = token.UserID
+	if err := _db.Model(types.User{}).Where(&user).Scan(&user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, table := range []string{"predictors", "sleep_logs", "activity_logs", "dump_jobs", "report_jobs", "conversations", "reports", "fitbit_subscriptions"} {
+			if err := _db.Exec(fmt.Sprintf("DELETE FROM %s WHERE user_id = ?", table), user.ID); err != nil {
+				t.Error(err)
+			}
+		}
+		if err := _db.Exec("DELETE FROM oauth2_authorized WHERE id = ?", user.ID); err != nil {
+			t.Error(err)
+		}
+	})
+	return &user
+}
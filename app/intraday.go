@@ -0,0 +1,335 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	fitbit_client "github.com/galeone/fitbit/v2/client"
+	fitbit_types "github.com/galeone/fitbit/v2/types"
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/gommon/log"
+)
+
+// Fitbit Intraday API
+// https://dev.fitbit.com/build/reference/web-api/intraday/
+//
+// The intraday endpoints return the data of a single day per request, thus the data
+// is dumped day by day. Every row is a minute (a day, for the breathing rate) and the
+// rows already stored are skipped by the unique indexes of the tables.
+
+// intradayBatchSize is the number of rows inserted by a single INSERT statement
+const intradayBatchSize = 1000
+
+// insertIntraday inserts rows, the values of columns, in the table of model.
+// The rows are inserted in batches and the rows already present are skipped.
+func insertIntraday(model tableModel, columns []string, rows [][]interface{}) error {
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	for start := 0; start < len(rows); start += intradayBatchSize {
+		end := start + intradayBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for _, row := range rows[start:end] {
+			values = append(values, placeholders)
+			args = append(args, row...)
+		}
+		query := fmt.Sprintf("INSERT INTO %s(%s) VALUES %s ON CONFLICT DO NOTHING",
+			model.TableName(), strings.Join(columns, ", "), strings.Join(values, ", "))
+		if err := _db.Model(model).Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// atTime returns the date with the hours and minutes of clock.
+func atTime(date, clock time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), 0, 0, time.UTC)
+}
+
+// getJSON sends a GET request to the Fitbit API endpoint and decodes the response in value.
+// Used for the endpoints whose response can't be decoded by the Fitbit client.
+func (d *dumper) getJSON(endpoint string, value interface{}) (err error) {
+	var client *http.Client
+	if client, err = d.authorizer.HTTP(); err != nil {
+		return err
+	}
+	var res *http.Response
+	if res, err = client.Get(endpoint); err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	var body []byte
+	if body, err = io.ReadAll(res.Body); err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return &fitbit_client.ResponseError{StatusCode: res.StatusCode, Message: string(body)}
+	}
+	return json.Unmarshal(body, value)
+}
+
+// userActivityIntraday stores the dataset of an activity intraday time series of the day date.
+func (d *dumper) userActivityIntraday(model tableModel, date *time.Time, series fitbit_types.TimeSeriesIntraday) (err error) {
+	rows := make([][]interface{}, 0, len(series.Dataset))
+	for _, t := range series.Dataset {
+		rows = append(rows, []interface{}{d.User.ID, atTime(*date, t.Time.Time), t.Level, t.Mets, t.Value})
+	}
+	if err = insertIntraday(model, []string{"user_id", "date_time", "level", "mets", "value"}, rows); err != nil {
+		d.logError(err)
+	}
+	return
+}
+
+func (d *dumper) userCaloriesIntraday(date *time.Time) (err error) {
+	var value *fitbit_types.CaloriesSeriesIntraday
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserCaloriesIntraday(date, nil); return }); err != nil {
+		d.logError(err)
+		return
+	}
+	return d.userActivityIntraday(types.CaloriesSeriesIntraday{}, date, value.CaloriesIntraday)
+}
+
+func (d *dumper) userStepsIntraday(date *time.Time) (err error) {
+	var value *fitbit_types.StepsSeriesIntraday
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserStepsIntraday(date, nil); return }); err != nil {
+		d.logError(err)
+		return
+	}
+	return d.userActivityIntraday(types.StepsSeriesIntraday{}, date, value.StepsIntraday)
+}
+
+// userHeartRateIntraday stores the average heart rate of every minute of the day date.
+// Fitbit returns a value every few seconds, but the time of every value is truncated
+// to the minute by the Fitbit client.
+func (d *dumper) userHeartRateIntraday(date *time.Time) (err error) {
+	var value *fitbit_types.HeartRateIntraday
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserHeartRateIntraday(date, nil); return }); err != nil {
+		d.logError(err)
+		return
+	}
+
+	type minute struct {
+		sum   float64
+		count int
+	}
+	minutes := make(map[time.Time]*minute)
+	for _, t := range value.HeartRateIntraday.Dataset {
+		dateTime := atTime(*date, t.Time.Time)
+		if _, ok := minutes[dateTime]; !ok {
+			minutes[dateTime] = &minute{}
+		}
+		minutes[dateTime].sum += t.Value
+		minutes[dateTime].count++
+	}
+
+	rows := make([][]interface{}, 0, len(minutes))
+	for dateTime, m := range minutes {
+		rows = append(rows, []interface{}{d.User.ID, dateTime, m.sum / float64(m.count)})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][1].(time.Time).Before(rows[j][1].(time.Time)) })
+	if err = insertIntraday(types.HeartRateIntraday{}, []string{"user_id", "date_time", "value"}, rows); err != nil {
+		d.logError(err)
+	}
+	return
+}
+
+func (d *dumper) userOxygenSaturationIntraday(date *time.Time) (err error) {
+	var value *fitbit_types.OxygenSaturationIntraday
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserOxygenSaturationIntraday(date, nil); return }); err != nil {
+		d.logError(err)
+		return
+	}
+
+	rows := make([][]interface{}, 0, len(value.Minutes))
+	for _, t := range value.Minutes {
+		rows = append(rows, []interface{}{d.User.ID, t.Minute.Time, t.Value})
+	}
+	if err = insertIntraday(types.OxygenSaturationIntraday{}, []string{"user_id", "date_time", "value"}, rows); err != nil {
+		d.logError(err)
+	}
+	return
+}
+
+// heartRateVariabilityIntraday is the response of the HRV intraday endpoint.
+// The Fitbit client parses the minutes as dates, losing the time: thus the response
+// is decoded here.
+type heartRateVariabilityIntraday struct {
+	Hrv []struct {
+		Minutes []struct {
+			Minute fitbit_types.FitbitDateTime                    `json:"minute"`
+			Value  fitbit_types.HeartRateVariabilityValueIntraday `json:"value"`
+		} `json:"minutes"`
+	} `json:"hrv"`
+}
+
+func (d *dumper) userHeartRateVariabilityIntraday(date *time.Time) (err error) {
+	var value heartRateVariabilityIntraday
+	endpoint := fitbit_client.UserV1(fmt.Sprintf("/hrv/date/%s/all.json", date.Format(fitbit_types.DateLayout)))
+	if err = d.fetch(func() error { return d.getJSON(endpoint, &value) }); err != nil {
+		d.logError(err)
+		return
+	}
+
+	var rows [][]interface{}
+	for _, hrv := range value.Hrv {
+		for _, t := range hrv.Minutes {
+			rows = append(rows, []interface{}{d.User.ID, t.Minute.Time, t.Value.Coverage, t.Value.Hf, t.Value.Lf, t.Value.Rmssd})
+		}
+	}
+	if err = insertIntraday(types.HeartRateVariabilityIntradayHRV{}, []string{"user_id", "date_time", "coverage", "hf", "lf", "rmssd"}, rows); err != nil {
+		d.logError(err)
+	}
+	return
+}
+
+func (d *dumper) userBreathingRateIntraday(date *time.Time) (err error) {
+	var value *fitbit_types.BreathingRateIntraday
+	if err = d.fetch(func() (err error) { value, err = d.fb.UserBreathingRateIntraday(date, nil); return }); err != nil {
+		d.logError(err)
+		return
+	}
+
+	rows := make([][]interface{}, 0, len(value.Br))
+	for _, t := range value.Br {
+		rows = append(rows, []interface{}{
+			d.User.ID, t.DateTime.Time,
+			t.Value.DeepSleepSummary.BreathingRate, t.Value.FullSleepSummary.BreathingRate,
+			t.Value.LightSleepSummary.BreathingRate, t.Value.RemSleepSummary.BreathingRate,
+		})
+	}
+	if err = insertIntraday(types.BreathingRateIntraday{},
+		[]string{"user_id", `"date"`, "deep_sleep_summary", "full_sleep_summary", "light_sleep_summary", "rem_sleep_summary"}, rows); err != nil {
+		d.logError(err)
+	}
+	return
+}
+
+// intradayTarget is an intraday data type dumped day by day.
+type intradayTarget struct {
+	model tableModel
+	// dateColumn is the column used to find the last date dumped
+	dateColumn string
+	dump       func(d *dumper, date *time.Time) error
+}
+
+var _intradayTargets = []intradayTarget{
+	{types.HeartRateIntraday{}, "date_time", (*dumper).userHeartRateIntraday},
+	{types.StepsSeriesIntraday{}, "date_time", (*dumper).userStepsIntraday},
+	{types.CaloriesSeriesIntraday{}, "date_time", (*dumper).userCaloriesIntraday},
+	{types.OxygenSaturationIntraday{}, "date_time", (*dumper).userOxygenSaturationIntraday},
+	{types.HeartRateVariabilityIntradayHRV{}, "date_time", (*dumper).userHeartRateVariabilityIntraday},
+	{types.BreathingRateIntraday{}, `"date"`, (*dumper).userBreathingRateIntraday},
+}
+
+// dumpIntraday dumps, day by day, the intraday data from the last date dumped up to endDate.
+// The last date dumped is the most recent between the last date stored and the last date
+// covered by a successful synchronization, since some data types (e.g. SpO2) are not
+// available for every user or every day. At most the last _intradayDays days are dumped,
+// none when _intradayDays is 0.
+func (d *dumper) dumpIntraday(results dumpResults, endDate time.Time) {
+	if _intradayDays == 0 {
+		return
+	}
+	oldest := endDate.AddDate(0, 0, -(_intradayDays - 1))
+	for _, target := range _intradayTargets {
+		startDate := oldest
+		var last time.Time
+		if err := _db.Model(target.model).Select(fmt.Sprintf("max(%s)", target.dateColumn)).Where("user_id = ?", d.User.ID).Scan(&last); err == nil {
+			// The last day stored could be incomplete: dump it again
+			if last = last.Truncate(time.Hour * 24); last.After(startDate) {
+				startDate = last
+			}
+		}
+		// A synchronization dumps the data up to the day before
+		if err := _db.Model(types.SyncStatus{}).Select("last_success").Where(
+			"user_id = ? AND data_type = ? AND last_success IS NOT NULL", d.User.ID, target.model.TableName()).Scan(&last); err == nil {
+			if last = last.Truncate(time.Hour*24).AddDate(0, 0, -1); last.After(startDate) {
+				startDate = last
+			}
+		}
+
+		for date := startDate; !date.After(endDate); date = date.AddDate(0, 0, 1) {
+			date := date
+			var forbidden bool
+			d.step(results, target.model, &date, &date, func() error {
+				err := target.dump(d, &date)
+				forbidden = fitbitStatusCode(err) == http.StatusForbidden
+				return err
+			})
+			// The application has no intraday access, or the user didn't grant the scope:
+			// the other days fail in the same way
+			if forbidden {
+				break
+			}
+		}
+	}
+}
+
+// intradayRange returns the rows of the table of model with the dateColumn between start and end (included),
+// ordered by dateColumn.
+func (f *fetcher) intradayRange(model tableModel, dateColumn string, start, end time.Time, rows interface{}) error {
+	if err := _db.Model(model).Where(fmt.Sprintf("user_id = ? AND %s BETWEEN ? AND ?", dateColumn), f.user.ID, start, end).Order(dateColumn).Scan(rows); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Error(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// HeartRateIntraday returns the average heart rate of every minute between start and end.
+func (f *fetcher) HeartRateIntraday(start, end time.Time) ([]types.HeartRateIntraday, error) {
+	var rows []types.HeartRateIntraday
+	err := f.intradayRange(types.HeartRateIntraday{}, "date_time", start, end, &rows)
+	return rows, err
+}
+
+// StepsIntraday returns the steps of every minute between start and end.
+func (f *fetcher) StepsIntraday(start, end time.Time) ([]types.StepsSeriesIntraday, error) {
+	var rows []types.StepsSeriesIntraday
+	err := f.intradayRange(types.StepsSeriesIntraday{}, "date_time", start, end, &rows)
+	return rows, err
+}
+
+// CaloriesIntraday returns the calories burned every minute between start and end.
+func (f *fetcher) CaloriesIntraday(start, end time.Time) ([]types.CaloriesSeriesIntraday, error) {
+	var rows []types.CaloriesSeriesIntraday
+	err := f.intradayRange(types.CaloriesSeriesIntraday{}, "date_time", start, end, &rows)
+	return rows, err
+}
+
+// OxygenSaturationIntraday returns the SpO2 measurements between start and end.
+func (f *fetcher) OxygenSaturationIntraday(start, end time.Time) ([]types.OxygenSaturationIntraday, error) {
+	var rows []types.OxygenSaturationIntraday
+	err := f.intradayRange(types.OxygenSaturationIntraday{}, "date_time", start, end, &rows)
+	return rows, err
+}
+
+// HeartRateVariabilityIntraday returns the HRV measurements between start and end.
+func (f *fetcher) HeartRateVariabilityIntraday(start, end time.Time) ([]types.HeartRateVariabilityIntradayHRV, error) {
+	var rows []types.HeartRateVariabilityIntradayHRV
+	err := f.intradayRange(types.HeartRateVariabilityIntradayHRV{}, "date_time", start, end, &rows)
+	return rows, err
+}
+
+// BreathingRateIntraday returns the breathing rate, per sleep stage, of every day between startDate and endDate.
+func (f *fetcher) BreathingRateIntraday(startDate, endDate time.Time) ([]types.BreathingRateIntraday, error) {
+	var rows []types.BreathingRateIntraday
+	err := f.intradayRange(types.BreathingRateIntraday{}, `"date"`, startDate, endDate, &rows)
+	return rows, err
+}
@@ -0,0 +1,108 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"fmt"
+)
+
+// Roles of the messages of a conversation with the LLM
+const (
+	llmRoleUser  = "user"
+	llmRoleModel = "model"
+	// llmRoleTool is the role of the messages containing the results of the tools called by the model
+	llmRoleTool = "tool"
+)
+
+// Providers of the LLM, selected with the LLM_PROVIDER environment variable
+const (
+	llmProviderVertex = "vertex"
+	llmProviderOpenAI = "openai"
+	llmProviderFake   = "fake"
+)
+
+// LLMMessage is a message of a conversation with the LLM.
+type LLMMessage struct {
+	// Role is llmRoleUser, llmRoleModel or llmRoleTool
+	Role string
+	Text string
+	// ToolCalls are the tools the model asked to call, in the messages with llmRoleModel
+	ToolCalls []LLMToolCall
+	// ToolResults are the results of the ToolCalls, in the messages with llmRoleTool
+	ToolResults []LLMToolResult
+}
+
+// Types of the parameters of the tools
+const (
+	llmTypeString  = "string"
+	llmTypeNumber  = "number"
+	llmTypeInteger = "integer"
+	// llmTypeStringArray is an array of strings
+	llmTypeStringArray = "array"
+)
+
+// LLMToolParameter is a parameter of a tool.
+type LLMToolParameter struct {
+	Name        string
+	Type        string
+	Description string
+	// Enum, if not empty, contains the only values accepted for the parameter (or for its elements)
+	Enum     []string
+	Required bool
+}
+
+// LLMTool is a function that the model can ask to call, to get the data it needs to reply.
+type LLMTool struct {
+	Name        string
+	Description string
+	Parameters  []LLMToolParameter
+}
+
+// LLMToolCall is the request of the model to call a tool with some arguments.
+type LLMToolCall struct {
+	// ID identifies the call, for the providers that support parallel calls. It can be empty.
+	ID        string
+	Name      string
+	Arguments map[string]interface{}
+}
+
+// LLMToolResult is the result of a LLMToolCall. Result is encoded as a JSON object.
+type LLMToolResult struct {
+	CallID string
+	Name   string
+	Result map[string]interface{}
+}
+
+// LLMProvider is the LLM used for the chat, the reports and the chart descriptions.
+// The embeddings are generated by the Embedder.
+type LLMProvider interface {
+	// Generate returns the reply of the model to the last message of the conversation.
+	Generate(ctx context.Context, conversation []LLMMessage, temperature float32) (string, error)
+	// GenerateStream is Generate, but the reply is sent to onChunk while it's generated.
+	// The streaming stops at the first error returned by onChunk.
+	GenerateStream(ctx context.Context, conversation []LLMMessage, temperature float32, onChunk func(chunk string) error) error
+	// GenerateStreamWithTools is GenerateStream, but the model can call the tools instead of replying.
+	// The text generated is sent to onChunk, and the tools to call are returned: the caller must
+	// append the calls and their results to the conversation, and generate again.
+	// No tool calls means that the reply is complete.
+	GenerateStreamWithTools(ctx context.Context, conversation []LLMMessage, tools []LLMTool, temperature float32, onChunk func(chunk string) error) ([]LLMToolCall, error)
+	// Close releases the resources of the provider.
+	Close()
+}
+
+// newLLMProvider returns the LLMProvider configured with the LLM_PROVIDER environment variable.
+func newLLMProvider(ctx context.Context) (LLMProvider, error) {
+	switch _llmProvider {
+	case llmProviderVertex:
+		return newVertexProvider(ctx)
+	case llmProviderOpenAI:
+		return newOpenAIProvider(), nil
+	case llmProviderFake:
+		return newFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q: use %q, %q or %q", _llmProvider, llmProviderVertex, llmProviderOpenAI, llmProviderFake)
+	}
+}
@@ -0,0 +1,50 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// fakeProvider is a deterministic LLMProvider that doesn't send the data anywhere.
+// The same conversation always gets the same reply: it's meant for the development and the tests.
+type fakeProvider struct{}
+
+func newFakeProvider() *fakeProvider {
+	return &fakeProvider{}
+}
+
+func (fakeProvider) Generate(_ context.Context, conversation []LLMMessage, _ float32) (string, error) {
+	if len(conversation) == 0 {
+		return "", errors.New("empty conversation")
+	}
+	last := conversation[len(conversation)-1].Text
+	return fmt.Sprintf("This is a fake reply to a message of %d words, after %d messages.",
+		len(strings.Fields(last)), len(conversation)-1), nil
+}
+
+// GenerateStream sends the reply of Generate, word by word.
+func (p fakeProvider) GenerateStream(ctx context.Context, conversation []LLMMessage, temperature float32, onChunk func(chunk string) error) error {
+	reply, err := p.Generate(ctx, conversation, temperature)
+	if err != nil {
+		return err
+	}
+	for _, word := range strings.SplitAfter(reply, " ") {
+		if err = onChunk(word); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateStreamWithTools never calls the tools: the fake replies don't depend on the data.
+func (p fakeProvider) GenerateStreamWithTools(ctx context.Context, conversation []LLMMessage, _ []LLMTool, temperature float32, onChunk func(chunk string) error) ([]LLMToolCall, error) {
+	return nil, p.GenerateStream(ctx, conversation, temperature, onChunk)
+}
+
+func (fakeProvider) Close() {}
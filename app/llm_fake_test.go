@@ -0,0 +1,46 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFakeProviderIsDeterministic(t *testing.T) {
+	provider := newFakeProvider()
+	conversation := []LLMMessage{
+		{Role: llmRoleUser, Text: "How did I sleep?"},
+		{Role: llmRoleModel, Text: "Well."},
+		{Role: llmRoleUser, Text: "And last week?"},
+	}
+	reply, err := provider.Generate(context.Background(), conversation, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "This is a fake reply to a message of 3 words, after 2 messages."; reply != want {
+		t.Errorf("Generate() = %q, want %q", reply, want)
+	}
+
+	var streamed strings.Builder
+	calls, err := provider.GenerateStreamWithTools(context.Background(), conversation, []LLMTool{{Name: "dailyMetrics"}}, 0, func(chunk string) error {
+		streamed.WriteString(chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("GenerateStreamWithTools() called %d tools, want none", len(calls))
+	}
+	if streamed.String() != reply {
+		t.Errorf("streamed reply %q, want %q", streamed.String(), reply)
+	}
+
+	if _, err = provider.Generate(context.Background(), nil, 0); err == nil {
+		t.Error("Generate() of an empty conversation: want an error")
+	}
+}
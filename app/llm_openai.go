@@ -0,0 +1,291 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// openAIProvider is the LLMProvider that uses an OpenAI-compatible HTTP API,
+// e.g. a local Ollama or llama.cpp server, so that the health data never leaves
+// the infrastructure.
+// https://platform.openai.com/docs/api-reference/chat
+type openAIProvider struct {
+	openAIClient
+	chatModel string
+}
+
+func newOpenAIProvider() *openAIProvider {
+	return &openAIProvider{openAIClient: newOpenAIClient(), chatModel: _openAIChatModel}
+}
+
+// openAIClient sends the requests to the OpenAI-compatible API.
+type openAIClient struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func newOpenAIClient() openAIClient {
+	return openAIClient{
+		baseURL: strings.TrimSuffix(_openAIBaseURL, "/"),
+		apiKey:  _openAIAPIKey,
+		// No timeout: the requests are bound to the context, and the streaming can be long
+		client: &http.Client{},
+	}
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	// Index identifies the call in the chunks of a stream
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name string `json:"name,omitempty"`
+		// Arguments is a JSON object, sent in pieces by the stream
+		Arguments string `json:"arguments,omitempty"`
+	} `json:"function"`
+}
+
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description"`
+		Parameters  map[string]interface{} `json:"parameters"`
+	} `json:"function"`
+}
+
+type openAIChatRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Tools       []openAITool    `json:"tools,omitempty"`
+	Temperature float32         `json:"temperature"`
+	Stream      bool            `json:"stream"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+		Delta   openAIMessage `json:"delta"`
+	} `json:"choices"`
+}
+
+// post sends body, encoded as JSON, to the endpoint. The caller must close the body of the response.
+func (c *openAIClient) post(ctx context.Context, endpoint string, body interface{}) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+endpoint, bytes.NewReader(payload)); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	var res *http.Response
+	if res, err = c.client.Do(req); err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		message, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("StatusCode: %d. Message: %s", res.StatusCode, string(message))
+	}
+	return res, nil
+}
+
+// toolCallID returns the ID of the call, or a placeholder for the servers that don't send it.
+func (p *openAIProvider) toolCallID(call LLMToolCall, i int) string {
+	if call.ID != "" {
+		return call.ID
+	}
+	return fmt.Sprintf("call_%d", i)
+}
+
+// chatRequest converts the conversation and the tools to the request of the chat completion.
+func (p *openAIProvider) chatRequest(conversation []LLMMessage, tools []LLMTool, temperature float32, stream bool) (openAIChatRequest, error) {
+	req := openAIChatRequest{Model: p.chatModel, Temperature: temperature, Stream: stream}
+	for _, message := range conversation {
+		switch message.Role {
+		case llmRoleModel:
+			assistant := openAIMessage{Role: "assistant", Content: message.Text}
+			for i, call := range message.ToolCalls {
+				arguments, err := json.Marshal(call.Arguments)
+				if err != nil {
+					return req, err
+				}
+				toolCall := openAIToolCall{ID: p.toolCallID(call, i), Type: "function"}
+				toolCall.Function.Name = call.Name
+				toolCall.Function.Arguments = string(arguments)
+				assistant.ToolCalls = append(assistant.ToolCalls, toolCall)
+			}
+			req.Messages = append(req.Messages, assistant)
+		case llmRoleTool:
+			// A message for every result, identified by the ID of its call
+			for i, result := range message.ToolResults {
+				content, err := json.Marshal(result.Result)
+				if err != nil {
+					return req, err
+				}
+				req.Messages = append(req.Messages, openAIMessage{
+					Role:       "tool",
+					Content:    string(content),
+					ToolCallID: p.toolCallID(LLMToolCall{ID: result.CallID}, i),
+				})
+			}
+		default:
+			req.Messages = append(req.Messages, openAIMessage{Role: "user", Content: message.Text})
+		}
+	}
+
+	for _, tool := range tools {
+		properties := make(map[string]interface{})
+		required := []string{}
+		for _, parameter := range tool.Parameters {
+			property := map[string]interface{}{"type": parameter.Type, "description": parameter.Description}
+			if parameter.Type == llmTypeStringArray {
+				items := map[string]interface{}{"type": llmTypeString}
+				if len(parameter.Enum) > 0 {
+					items["enum"] = parameter.Enum
+				}
+				property["items"] = items
+			} else if len(parameter.Enum) > 0 {
+				property["enum"] = parameter.Enum
+			}
+			properties[parameter.Name] = property
+			if parameter.Required {
+				required = append(required, parameter.Name)
+			}
+		}
+		openAITool := openAITool{Type: "function"}
+		openAITool.Function.Name = tool.Name
+		openAITool.Function.Description = tool.Description
+		openAITool.Function.Parameters = map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}
+		req.Tools = append(req.Tools, openAITool)
+	}
+	return req, nil
+}
+
+func (p *openAIProvider) Generate(ctx context.Context, conversation []LLMMessage, temperature float32) (string, error) {
+	req, err := p.chatRequest(conversation, nil, temperature, false)
+	if err != nil {
+		return "", err
+	}
+	var res *http.Response
+	if res, err = p.post(ctx, "/chat/completions", req); err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var response openAIChatResponse
+	if err = json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", errors.New("no choices returned")
+	}
+	return response.Choices[0].Message.Content, nil
+}
+
+func (p *openAIProvider) GenerateStream(ctx context.Context, conversation []LLMMessage, temperature float32, onChunk func(chunk string) error) error {
+	_, err := p.GenerateStreamWithTools(ctx, conversation, nil, temperature, onChunk)
+	return err
+}
+
+// GenerateStreamWithTools reads the reply sent as Server-Sent Events: every event is a chunk
+// of the reply, and the stream ends with the [DONE] event.
+// The tool calls are sent in pieces too, identified by their index.
+func (p *openAIProvider) GenerateStreamWithTools(ctx context.Context, conversation []LLMMessage, tools []LLMTool, temperature float32, onChunk func(chunk string) error) ([]LLMToolCall, error) {
+	req, err := p.chatRequest(conversation, tools, temperature, true)
+	if err != nil {
+		return nil, err
+	}
+	var res *http.Response
+	if res, err = p.post(ctx, "/chat/completions", req); err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var toolCalls []openAIToolCall
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var response openAIChatResponse
+		if err = json.Unmarshal([]byte(data), &response); err != nil {
+			return nil, err
+		}
+		for _, choice := range response.Choices {
+			for i, delta := range choice.Delta.ToolCalls {
+				index := i
+				if delta.Index != nil {
+					index = *delta.Index
+				}
+				for len(toolCalls) <= index {
+					toolCalls = append(toolCalls, openAIToolCall{})
+				}
+				if delta.ID != "" {
+					toolCalls[index].ID = delta.ID
+				}
+				toolCalls[index].Function.Name += delta.Function.Name
+				toolCalls[index].Function.Arguments += delta.Function.Arguments
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			if err = onChunk(choice.Delta.Content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	calls := make([]LLMToolCall, 0, len(toolCalls))
+	for _, toolCall := range toolCalls {
+		call := LLMToolCall{ID: toolCall.ID, Name: toolCall.Function.Name, Arguments: make(map[string]interface{})}
+		if toolCall.Function.Arguments != "" {
+			if err = json.Unmarshal([]byte(toolCall.Function.Arguments), &call.Arguments); err != nil {
+				return nil, fmt.Errorf("invalid arguments of %s: %w", call.Name, err)
+			}
+		}
+		calls = append(calls, call)
+	}
+	return calls, nil
+}
+
+func (p *openAIProvider) Close() {
+	p.client.CloseIdleConnections()
+}
@@ -0,0 +1,182 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"cloud.google.com/go/vertexai/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// vertexProvider is the LLMProvider backed by Vertex AI Gemini.
+type vertexProvider struct {
+	genaiClient *genai.Client
+}
+
+func newVertexProvider(ctx context.Context) (*vertexProvider, error) {
+	genaiClient, err := genai.NewClient(ctx, _vaiProjectID, _vaiChatLocation, option.WithCredentialsFile(_vaiServiceAccountKey))
+	if err != nil {
+		return nil, err
+	}
+	return &vertexProvider{genaiClient: genaiClient}, nil
+}
+
+// parts converts the message to the parts of a genai.Content.
+func (p *vertexProvider) parts(message LLMMessage) []genai.Part {
+	var parts []genai.Part
+	if message.Text != "" {
+		parts = append(parts, genai.Text(message.Text))
+	}
+	for _, call := range message.ToolCalls {
+		parts = append(parts, genai.FunctionCall{Name: call.Name, Args: call.Arguments})
+	}
+	for _, result := range message.ToolResults {
+		parts = append(parts, genai.FunctionResponse{Name: result.Name, Response: result.Result})
+	}
+	return parts
+}
+
+// tools converts the tools to the function declarations of Gemini.
+func (p *vertexProvider) tools(tools []LLMTool) []*genai.Tool {
+	if len(tools) == 0 {
+		return nil
+	}
+	types := map[string]genai.Type{
+		llmTypeString:      genai.TypeString,
+		llmTypeNumber:      genai.TypeNumber,
+		llmTypeInteger:     genai.TypeInteger,
+		llmTypeStringArray: genai.TypeArray,
+	}
+	declarations := make([]*genai.FunctionDeclaration, 0, len(tools))
+	for _, tool := range tools {
+		parameters := &genai.Schema{Type: genai.TypeObject, Properties: make(map[string]*genai.Schema)}
+		for _, parameter := range tool.Parameters {
+			schema := &genai.Schema{Type: types[parameter.Type], Description: parameter.Description}
+			if parameter.Type == llmTypeStringArray {
+				schema.Items = &genai.Schema{Type: genai.TypeString, Enum: parameter.Enum}
+			} else {
+				schema.Enum = parameter.Enum
+			}
+			parameters.Properties[parameter.Name] = schema
+			if parameter.Required {
+				parameters.Required = append(parameters.Required, parameter.Name)
+			}
+		}
+		declarations = append(declarations, &genai.FunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  parameters,
+		})
+	}
+	return []*genai.Tool{{FunctionDeclarations: declarations}}
+}
+
+// chat returns a chat session whose history is the conversation, except for the last
+// message whose parts are returned to be sent.
+func (p *vertexProvider) chat(conversation []LLMMessage, tools []LLMTool, temperature float32) (*genai.ChatSession, []genai.Part, error) {
+	if len(conversation) == 0 {
+		return nil, nil, errors.New("empty conversation")
+	}
+	model := p.genaiClient.GenerativeModel(_vaiChatModel)
+	model.Temperature = &temperature
+	model.Tools = p.tools(tools)
+	chatSession := model.StartChat()
+	for _, message := range conversation[:len(conversation)-1] {
+		// The results of the tools are sent by the user
+		role := llmRoleUser
+		if message.Role == llmRoleModel {
+			role = llmRoleModel
+		}
+		chatSession.History = append(chatSession.History, &genai.Content{
+			Parts: p.parts(message),
+			Role:  role,
+		})
+	}
+	return chatSession, p.parts(conversation[len(conversation)-1]), nil
+}
+
+// text returns the text of the candidates of the response.
+func (p *vertexProvider) text(response *genai.GenerateContentResponse) string {
+	var builder strings.Builder
+	for _, candidates := range response.Candidates {
+		if candidates.Content == nil {
+			continue
+		}
+		for _, part := range candidates.Content.Parts {
+			if text, ok := part.(genai.Text); ok {
+				builder.WriteString(string(text))
+			}
+		}
+	}
+	return builder.String()
+}
+
+// toolCalls returns the function calls of the candidates of the response.
+func (p *vertexProvider) toolCalls(response *genai.GenerateContentResponse) []LLMToolCall {
+	var calls []LLMToolCall
+	for _, candidates := range response.Candidates {
+		if candidates.Content == nil {
+			continue
+		}
+		for _, part := range candidates.Content.Parts {
+			if call, ok := part.(genai.FunctionCall); ok {
+				calls = append(calls, LLMToolCall{Name: call.Name, Arguments: call.Args})
+			}
+		}
+	}
+	return calls
+}
+
+func (p *vertexProvider) Generate(ctx context.Context, conversation []LLMMessage, temperature float32) (string, error) {
+	chatSession, message, err := p.chat(conversation, nil, temperature)
+	if err != nil {
+		return "", err
+	}
+	var response *genai.GenerateContentResponse
+	if response, err = chatSession.SendMessage(ctx, message...); err != nil {
+		return "", err
+	}
+	if len(response.Candidates) == 0 {
+		return "", errors.New("no candidates returned")
+	}
+	return p.text(response), nil
+}
+
+func (p *vertexProvider) GenerateStream(ctx context.Context, conversation []LLMMessage, temperature float32, onChunk func(chunk string) error) error {
+	_, err := p.GenerateStreamWithTools(ctx, conversation, nil, temperature, onChunk)
+	return err
+}
+
+func (p *vertexProvider) GenerateStreamWithTools(ctx context.Context, conversation []LLMMessage, tools []LLMTool, temperature float32, onChunk func(chunk string) error) ([]LLMToolCall, error) {
+	chatSession, message, err := p.chat(conversation, tools, temperature)
+	if err != nil {
+		return nil, err
+	}
+	var calls []LLMToolCall
+	responseIterator := chatSession.SendMessageStream(ctx, message...)
+	for {
+		response, err := responseIterator.Next()
+		if err == iterator.Done {
+			return calls, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, p.toolCalls(response)...)
+		if text := p.text(response); text != "" {
+			if err = onChunk(text); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (p *vertexProvider) Close() {
+	p.genaiClient.Close()
+}
@@ -5,10 +5,11 @@
 package app
 
 import (
+	"errors"
 	"net/http"
 
-	"github.com/galeone/fitbit/v2"
-	"github.com/galeone/fitbit/v2/types"
+	fitbit_types "github.com/galeone/fitbit/v2/types"
+	"github.com/galeone/fitsleepinsights/database/types"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 )
@@ -30,10 +31,10 @@ func RequireFitbit() echo.MiddlewareFunc {
 				// And we check that if authorizing is set, than we should do the auth + redirect flow
 				// for some reason (maybe the user has deleted the cookies).
 
-				authorizer := fitbit.NewAuthorizer(_db, _clientID, _clientSecret, _redirectURL)
+				authorizer := newFitbitAuthorizer()
 				var cookie *http.Cookie
 				if cookie, err = c.Cookie("authorizing"); err == nil {
-					var authorizing *types.AuthorizingUser
+					var authorizing *fitbit_types.AuthorizingUser
 					if authorizing, err = _db.AuthorizingUser(cookie.Value); err != nil {
 						log.Printf("[RequireFitbit] _db.AuthorizingUser: %s", err)
 						return c.Redirect(http.StatusTemporaryRedirect, "/auth")
@@ -49,14 +50,24 @@ func RequireFitbit() echo.MiddlewareFunc {
 					return c.Redirect(http.StatusTemporaryRedirect, "/auth")
 				}
 
-				var dbToken *types.AuthorizedUser
-				if dbToken, err = _db.AuthorizedUser(cookie.Value); err != nil {
-					log.Print("[RequireFitbit] _db.AuthorizedUser: ", err)
+				var user *types.User
+				if user, err = userByAccessToken(cookie.Value); err != nil {
+					log.Print("[RequireFitbit] userByAccessToken: ", err)
 					return c.Redirect(http.StatusTemporaryRedirect, "/auth")
 				}
-				if dbToken.UserID == "" {
-					log.Print("Empty UserID, error: ", err)
-					return c.Redirect(http.StatusTemporaryRedirect, "/auth")
+
+				// Refresh the token if it's expiring, and keep the cookie in sync
+				var dbToken *fitbit_types.AuthorizedUser
+				if dbToken, err = validToken(user); err != nil {
+					if errors.Is(err, errReconsentRequired) {
+						return c.Redirect(http.StatusTemporaryRedirect, "/reconsent")
+					}
+					// The data is in our database: we can continue and retry the refresh the next time
+					log.Print("[RequireFitbit] validToken: ", err)
+					dbToken = &user.AuthorizedUser.AuthorizedUser
+				}
+				if dbToken.AccessToken != cookie.Value {
+					setTokenCookie(c, dbToken)
 				}
 				authorizer.SetToken(dbToken)
 				c.Set("fitbit", authorizer)
@@ -75,12 +86,9 @@ func validLogin(c echo.Context) bool {
 		return false
 	}
 
-	var dbToken *types.AuthorizedUser
-	if dbToken, err = _db.AuthorizedUser(cookie.Value); err != nil {
-		return false
-	}
-	if dbToken.UserID == "" {
+	var user *types.User
+	if user, err = userByAccessToken(cookie.Value); err != nil {
 		return false
 	}
-	return true
+	return !user.ReconsentRequired
 }
@@ -0,0 +1,318 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// Methods compared by the backtests
+const (
+	// backtestModel is the predictor trained in process
+	backtestModel = "model"
+	// backtestPreviousNight predicts the value of the most recent night before the day
+	backtestPreviousNight = "previous_night"
+	// backtestMean7Days predicts the average of the nights of the 7 days before the day
+	backtestMean7Days = "mean_7_days"
+)
+
+// backtestMethods are the labels of the methods, in the order of the reports
+var backtestMethods = []struct{ method, label string }{
+	{backtestModel, "Predictor"},
+	{backtestPreviousNight, "Same as the previous night"},
+	{backtestMean7Days, "Average of the last 7 days"},
+}
+
+const (
+	// backtestStep is the number of days predicted by every model of the backtest, before
+	// training the next one: training a model for every day would take minutes.
+	backtestStep = 7
+	// backtestTolerance is the maximum error of an accurate prediction, relative to the real value
+	backtestTolerance = 0.1
+)
+
+// backtestScore is the score of a method in a backtest.
+type backtestScore struct {
+	Method string  `json:"method"`
+	Label  string  `json:"label"`
+	MAE    float64 `json:"mae"`
+	RMSE   float64 `json:"rmse"`
+	// Accuracy is the percentage of the days predicted within backtestTolerance
+	Accuracy float64 `json:"accuracy"`
+}
+
+// backtestReport is the result of the walk-forward backtest of the predictor of a target.
+type backtestReport struct {
+	Target string `json:"target"`
+	// StartDate and EndDate are the first and the last predicted day
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Days      int64  `json:"days"`
+	Step      int64  `json:"step"`
+	// Scores contains the model first, then the baselines
+	Scores    []backtestScore `json:"scores"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// accuracy returns the percentage of the predictions whose error is within the tolerance, relative to the real value.
+func accuracy(predictions, y []float64, tolerance float64) float64 {
+	if len(y) == 0 {
+		return 0
+	}
+	var accurate int
+	for i := range y {
+		if math.Abs(predictions[i]-y[i]) <= tolerance*math.Abs(y[i]) {
+			accurate++
+		}
+	}
+	return 100 * float64(accurate) / float64(len(y))
+}
+
+// walkForward predicts the labels y of the rows x, in chronological order by dates, from the row
+// minTraining on. Every step rows, a model is trained on the previous rows only, and it predicts
+// the next step rows. The baselines predict the same rows from the previous labels.
+// It returns the predictions of every method, and the predicted labels.
+func walkForward(dates []time.Time, features []string, x [][]float64, y []float64, minTraining, step int, params gbtParams) (map[string][]float64, []float64, error) {
+	if minTraining < 1 || len(y) <= minTraining {
+		return nil, nil, fmt.Errorf("at least %d days are required to backtest, found %d", minTraining+1, len(y))
+	}
+	predictions := make(map[string][]float64)
+	for start := minTraining; start < len(y); start += step {
+		model, err := trainGBT(features, x[:start], y[:start], params)
+		if err != nil {
+			return nil, nil, err
+		}
+		for day := start; day < start+step && day < len(y); day++ {
+			predictions[backtestModel] = append(predictions[backtestModel], model.Predict(x[day]))
+			predictions[backtestPreviousNight] = append(predictions[backtestPreviousNight], y[day-1])
+
+			// The nights of the 7 days before, or the previous night if there are none
+			weekAgo := dates[day].AddDate(0, 0, -7)
+			var sum float64
+			var count int
+			for previous := day - 1; previous >= 0 && !dates[previous].Before(weekAgo); previous-- {
+				sum += y[previous]
+				count++
+			}
+			if count == 0 {
+				sum, count = y[day-1], 1
+			}
+			predictions[backtestMean7Days] = append(predictions[backtestMean7Days], sum/float64(count))
+		}
+	}
+	return predictions, y[minTraining:], nil
+}
+
+// backtest evaluates the predictor of the target on the UserData, with a walk-forward validation:
+// every day, after the first minTrainingRows days with the target, is predicted by a model trained
+// on the previous days only, and by the naive baselines.
+func backtest(userData []*UserData, target string, step int) (*backtestReport, error) {
+	days, y, err := labeledDays(userData, target)
+	if err != nil {
+		return nil, err
+	}
+	// The features of the previous days are computed with all the days, also the ones without the target
+	spec := newFeatureSpec(predictorFeatures(userData))
+	rows := spec.Rows(userData)
+	x := make([][]float64, len(days))
+	dates := make([]time.Time, len(days))
+	for i, day := range days {
+		x[i], dates[i] = rows[day], userData[day].Date
+	}
+
+	var predictions map[string][]float64
+	var actual []float64
+	if predictions, actual, err = walkForward(dates, spec.Names(), x, y, minTrainingRows, step, defaultGBTParams); err != nil {
+		return nil, err
+	}
+	report := backtestReport{
+		Target:    target,
+		StartDate: dates[minTrainingRows].Format(time.DateOnly),
+		EndDate:   dates[len(dates)-1].Format(time.DateOnly),
+		Days:      int64(len(actual)),
+		Step:      int64(step),
+	}
+	for _, method := range backtestMethods {
+		mae, rmse := regressionMetrics(predictions[method.method], actual)
+		report.Scores = append(report.Scores, backtestScore{
+			Method:   method.method,
+			Label:    method.label,
+			MAE:      twoDecimals(mae),
+			RMSE:     twoDecimals(rmse),
+			Accuracy: twoDecimals(accuracy(predictions[method.method], actual, backtestTolerance)),
+		})
+	}
+	return &report, nil
+}
+
+// BacktestPredictor runs the backtest of the predictor of the target on all the data of the user,
+// and stores its report.
+func BacktestPredictor(user *types.User, target string) (err error) {
+	var fetcher *fetcher
+	if fetcher, err = NewFetcher(user); err != nil {
+		log.Error("error creating fetcher: ", err)
+		return err
+	}
+	var allUserData []*UserData
+	if allUserData, err = fetcher.Fetch(FetchAllWithSleepLog); err != nil {
+		log.Error("error fetching user data: ", err)
+		return err
+	}
+
+	start := time.Now()
+	var report *backtestReport
+	if report, err = backtest(allUserData, target, backtestStep); err != nil {
+		return err
+	}
+	log.Printf("Backtest of the %s predictor of user %d: %d days in %s", target, user.ID, report.Days, time.Since(start))
+
+	run := types.Backtest{
+		UserID:    user.ID,
+		Target:    target,
+		Days:      report.Days,
+		Step:      report.Step,
+		CreatedAt: time.Now(),
+	}
+	run.StartDate, _ = time.Parse(time.DateOnly, report.StartDate)
+	run.EndDate, _ = time.Parse(time.DateOnly, report.EndDate)
+	tx := _db.Begin()
+	if err = tx.Create(&run); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for _, score := range report.Scores {
+		if err = tx.Create(&types.BacktestScore{
+			BacktestID: run.ID,
+			Method:     score.Method,
+			MAE:        score.MAE,
+			RMSE:       score.RMSE,
+			Accuracy:   score.Accuracy,
+		}); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// latestBacktests returns the reports of the most recent backtest of every target of the user.
+func latestBacktests(userID int64) ([]backtestReport, error) {
+	var runs []types.Backtest
+	if err := _db.Raw("SELECT DISTINCT ON (target) * FROM backtests WHERE user_id = ? ORDER BY target, created_at DESC", userID).
+		Scan(&runs); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	labels := make(map[string]string)
+	for _, method := range backtestMethods {
+		labels[method.method] = method.label
+	}
+	reports := []backtestReport{}
+	for _, run := range runs {
+		var scores []types.BacktestScore
+		if err := _db.Model(types.BacktestScore{}).Where("backtest_id = ?", run.ID).Order("id").
+			Scan(&scores); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		report := backtestReport{
+			Target:    run.Target,
+			StartDate: run.StartDate.Format(time.DateOnly),
+			EndDate:   run.EndDate.Format(time.DateOnly),
+			Days:      run.Days,
+			Step:      run.Step,
+			Scores:    []backtestScore{},
+			CreatedAt: run.CreatedAt,
+		}
+		for _, score := range scores {
+			report.Scores = append(report.Scores, backtestScore{
+				Method:   score.Method,
+				Label:    labels[score.Method],
+				MAE:      score.MAE,
+				RMSE:     score.RMSE,
+				Accuracy: score.Accuracy,
+			})
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// Backtests returns, as JSON, the reports of the most recent backtest of every target.
+func Backtests() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		var reports []backtestReport
+		if reports, err = latestBacktests(user.ID); err != nil {
+			log.Error("Backtests: ", err)
+			return err
+		}
+		return c.JSON(http.StatusOK, reports)
+	}
+}
+
+// RunBacktest runs in background the backtest of the predictor of the target in the URL.
+func RunBacktest() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		target := c.Param("target")
+		if !isTarget(target) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%q is not among the supported targets: %v", target, sleepLabels))
+		}
+		go func() {
+			if err := BacktestPredictor(user, target); err != nil {
+				log.Errorf("RunBacktest: backtest of the %s predictor of user %d: %s", target, user.ID, err)
+			}
+		}()
+		return c.NoContent(http.StatusAccepted)
+	}
+}
+
+// PredictorsDashboard renders the active predictors of the user, and how they compare
+// with the naive baselines in their most recent backtest.
+func PredictorsDashboard() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		var predictors []types.Predictor
+		if err = _db.Model(types.Predictor{}).Where("user_id = ? AND status = ?", user.ID, predictorStatusActive).Order("target").
+			Scan(&predictors); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Error("PredictorsDashboard: ", err)
+			return err
+		}
+		active := []predictorVersion{}
+		for _, predictor := range predictors {
+			active = append(active, newPredictorVersion(predictor))
+		}
+		var backtests []backtestReport
+		if backtests, err = latestBacktests(user.ID); err != nil {
+			log.Error("PredictorsDashboard: ", err)
+			return err
+		}
+		return c.Render(http.StatusOK, "dashboard/predictors", echo.Map{
+			"title":      "Predictors - FitSleepInsights",
+			"isLoggedIn": true,
+			"targets":    sleepLabels,
+			"predictors": active,
+			"backtests":  backtests,
+			"tolerance":  backtestTolerance * 100,
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestWalkForward(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	x, y := syntheticRegression(r, 300)
+	dates := make([]time.Time, len(y))
+	date := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for i := range dates {
+		// Some days are missing
+		date = date.AddDate(0, 0, 1+r.Intn(2))
+		dates[i] = date
+	}
+
+	predictions, actual, err := walkForward(dates, []string{"Noise", "Signal"}, x, y, 30, 7, defaultGBTParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 270 {
+		t.Fatalf("%d predicted days, want 270", len(actual))
+	}
+	scores := make(map[string]float64)
+	for _, method := range backtestMethods {
+		if len(predictions[method.method]) != len(actual) {
+			t.Fatalf("%d predictions of %s, want %d", len(predictions[method.method]), method.method, len(actual))
+		}
+		scores[method.method], _ = regressionMetrics(predictions[method.method], actual)
+	}
+	if scores[backtestModel] > 1.5 {
+		t.Errorf("MAE of the model = %.2f, want about 0.8 (the noise)", scores[backtestModel])
+	}
+	if scores[backtestModel] >= scores[backtestPreviousNight] || scores[backtestModel] >= scores[backtestMean7Days] {
+		t.Errorf("MAE of the model %.2f, want it lower than the baselines: %v", scores[backtestModel], scores)
+	}
+	// The baselines look only at the previous days
+	if predictions[backtestPreviousNight][0] != y[29] {
+		t.Errorf("previous night of the first predicted day = %f, want %f", predictions[backtestPreviousNight][0], y[29])
+	}
+}
+
+func TestWalkForwardShortHistory(t *testing.T) {
+	x, y := syntheticRegression(rand.New(rand.NewSource(1)), 30)
+	dates := make([]time.Time, len(y))
+	if _, _, err := walkForward(dates, []string{"Noise", "Signal"}, x, y, 30, 7, defaultGBTParams); err == nil {
+		t.Error("walkForward() of 30 days with 30 training days: want an error")
+	}
+}
+
+func TestMean7DaysBaseline(t *testing.T) {
+	date := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	// Two days in the week before the last one, and one older
+	dates := []time.Time{date, date.AddDate(0, 0, 10), date.AddDate(0, 0, 12), date.AddDate(0, 0, 15)}
+	x := [][]float64{{1}, {2}, {3}, {4}}
+	y := []float64{100, 10, 20, 0}
+	predictions, _, err := walkForward(dates, []string{"Feature"}, x, y, 3, 1, gbtParams{Trees: 1, MaxDepth: 1, MinLeaf: 1, LearningRate: 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mean := predictions[backtestMean7Days][0]; mean != 15 {
+		t.Errorf("mean of the last 7 days = %f, want 15", mean)
+	}
+}
+
+func TestAccuracy(t *testing.T) {
+	tests := []struct {
+		predictions, y []float64
+		want           float64
+	}{
+		{[]float64{90, 80, 50, 0}, []float64{100, 100, 100, 0}, 50},
+		{[]float64{1}, []float64{0}, 0},
+		{nil, nil, 0},
+	}
+	for _, test := range tests {
+		if got := accuracy(test.predictions, test.y, 0.1); got != test.want {
+			t.Errorf("accuracy(%v, %v) = %f, want %f", test.predictions, test.y, got, test.want)
+		}
+	}
+}
+
+// syntheticNights returns n days whose sleep efficiency depends on the steps of the day before.
+func syntheticNights(r *rand.Rand, n int) []*UserData {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	userData := make([]*UserData, n)
+	for i := range userData {
+		userData[i] = syntheticDay(start.AddDate(0, 0, i), float64(r.Intn(10000)), 420)
+		if i > 0 {
+			userData[i].SleepLog.Efficiency = int64(70 + userData[i-1].Steps.Value/500 + r.NormFloat64())
+		}
+	}
+	return userData[1:]
+}
+
+func TestBacktest(t *testing.T) {
+	userData := syntheticNights(rand.New(rand.NewSource(3)), 150)
+	report, err := backtest(userData, "SleepEfficiency", backtestStep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Days != int64(len(userData)-minTrainingRows) {
+		t.Errorf("%d days backtested, want %d", report.Days, len(userData)-minTrainingRows)
+	}
+	if report.StartDate != userData[minTrainingRows].Date.Format(time.DateOnly) {
+		t.Errorf("start date %s, want %s", report.StartDate, userData[minTrainingRows].Date.Format(time.DateOnly))
+	}
+	if len(report.Scores) != len(backtestMethods) || report.Scores[0].Method != backtestModel {
+		t.Fatalf("scores %v, want the model first, then the baselines", report.Scores)
+	}
+	// The model learns from the steps of the day before, the baselines can't
+	model, previousNight := report.Scores[0], report.Scores[1]
+	if model.MAE >= previousNight.MAE || model.Accuracy <= previousNight.Accuracy {
+		t.Errorf("model %+v, want it better than the previous night %+v", model, previousNight)
+	}
+	if math.IsNaN(model.RMSE) {
+		t.Error("RMSE of the model is NaN")
+	}
+
+	if _, err = backtest(userData[:minTrainingRows], "SleepEfficiency", backtestStep); err == nil {
+		t.Errorf("backtest() of %d days: want an error", minTrainingRows)
+	}
+	if _, err = backtest(userData, "Steps", backtestStep); err == nil {
+		t.Error("backtest() of a column that is not a sleep label: want an error")
+	}
+}
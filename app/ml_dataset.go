@@ -4,34 +4,59 @@ import (
 	"bytes"
 	"encoding/csv"
 	"errors"
+	"math"
 	"reflect"
 	"strconv"
 
+	"github.com/galeone/fitsleepinsights/database/types"
+
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
-// csvHeaders returns the headers for the CSV file
-func csvHeaders(userData []*UserData) []string {
+// sleepLabels are the columns of the sleep that can be predicted (the targets of the predictors).
+// They describe the same night, thus they are never features of a predictor of one of them.
+var sleepLabels = types.SleepLog{}.Headers()
+
+// csvHeaders returns the headers for the CSV file, followed by the features of the spec (if any)
+func csvHeaders(userData []*UserData, spec *featureSpec) []string {
 	if len(userData) == 0 {
 		return []string{}
 	}
 
 	headers := []string{"ID"}
 	headers = append(headers, userData[0].Headers()...)
+	if spec != nil {
+		headers = append(headers, spec.Names()...)
+	}
 	return headers
 }
 
+// formatFeature formats the value of a feature for the CSV file: the missing values are empty,
+// as they are omitted from the prediction instances.
+func formatFeature(value float64) string {
+	if math.IsNaN(value) {
+		return ""
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
 // userDataToCSV converts the slice of UserData to a CSV string
 // Add a column ID, because vertex.ai requires it. It's not used for training
 // The label column will be decided by the user ideally. Right now we use the sleep efficiency
 // The date is already in the csv in the vertex.ai expected format, so we don't need to add it.
+// The features of the spec, if not nil, are added after the columns of the UserData: the spec
+// should have no Columns, since all the columns of the UserData are already there.
 // ref: https://cloud.google.com/vertex-ai/docs/tabular-data/bp-tabular
-func userDataToCSV(userData []*UserData) (ret string, err error) {
+func userDataToCSV(userData []*UserData, spec *featureSpec) (ret string, err error) {
 	if len(userData) == 0 {
 		return ret, errors.New("empty userData slice")
 	}
 
-	headers := csvHeaders(userData)
+	headers := csvHeaders(userData, spec)
+	var rows [][]float64
+	if spec != nil {
+		rows = spec.Rows(userData)
+	}
 
 	buffer := bytes.NewBufferString("")
 	w := csv.NewWriter(buffer)
@@ -40,12 +65,19 @@ func userDataToCSV(userData []*UserData) (ret string, err error) {
 	}
 
 	for id, u := range userData {
-		if err = w.Write(append([]string{strconv.FormatInt(int64(id), 10)}, u.Values()...)); err != nil {
+		record := append([]string{strconv.FormatInt(int64(id), 10)}, u.Values()...)
+		if rows != nil {
+			for _, value := range rows[id] {
+				record = append(record, formatFeature(value))
+			}
+		}
+		if err = w.Write(record); err != nil {
 			return ret, err
 		}
 	}
+	w.Flush()
 
-	return buffer.String(), nil
+	return buffer.String(), w.Error()
 }
 
 // UNUSED UserDataToPredictionInstance converts a slice of UserData to a slice of structpb.Value.
@@ -91,7 +123,9 @@ func userDataToPredictionInstanceReflection(userData []*UserData, skipColumns []
 
 // UserDataToPredictionInstance converts a slice of UserData to a slice of structpb.Value.
 // It skips all the columns that are not used for training, that you should pass in the skipColumns parameter.
-func UserDataToPredictionInstance(userData []*UserData, skipColumns []string) ([]*structpb.Value, error) {
+// The features (e.g. computed by the featureSpec used in training) are added to the instances,
+// with the values of the rows: one row for every UserData.
+func UserDataToPredictionInstance(userData []*UserData, skipColumns []string, features []string, rows [][]float64) ([]*structpb.Value, error) {
 	if len(userData) == 0 {
 		return nil, errors.New("empty userData slice")
 	}
@@ -137,6 +171,15 @@ func UserDataToPredictionInstance(userData []*UserData, skipColumns []string) ([
 			// Otherwise is a string.
 			rawInstance[columns[j]] = v
 		}
+		if rows != nil {
+			for j, feature := range features {
+				// The missing values are omitted: in the training CSV they are empty cells,
+				// and the model learned to handle them as missing, not as 0
+				if value := rows[i][j]; !math.IsNaN(value) {
+					rawInstance[feature] = value
+				}
+			}
+		}
 		var err error
 		instances[i], err = structpb.NewValue(rawInstance)
 		if err != nil {
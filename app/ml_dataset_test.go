@@ -0,0 +1,49 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMissingFeatures checks that the missing features are missing both in the training CSV
+// and in the prediction instances.
+func TestMissingFeatures(t *testing.T) {
+	start := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	userData := []*UserData{syntheticDay(start, 1000, 400), syntheticDay(start.AddDate(0, 0, 1), 2000, 410)}
+	spec := &featureSpec{History: []string{"MinutesAsleep"}, Lags: []int{1}}
+	feature := spec.Names()[0]
+
+	content, err := userDataToCSV(userData, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(content)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	column := len(records[0]) - 1
+	if records[0][column] != feature {
+		t.Fatalf("last column = %s, want %s", records[0][column], feature)
+	}
+	// The first day has no previous night
+	if records[1][column] != "" || records[2][column] != "400" {
+		t.Errorf("%s = %q and %q in the CSV, want \"\" and \"400\"", feature, records[1][column], records[2][column])
+	}
+
+	instances, err := UserDataToPredictionInstance(userData, nil, spec.Names(), spec.Rows(userData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := instances[0].GetStructValue().GetFields()[feature]; ok {
+		t.Errorf("%s = %v in the instance of the first day, want it missing", feature, value)
+	}
+	if value := instances[1].GetStructValue().GetFields()[feature].GetNumberValue(); value != 400 {
+		t.Errorf("%s = %v in the instance of the second day, want 400", feature, value)
+	}
+}
@@ -0,0 +1,211 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// maxExplanationFeatures is the maximum number of features that helped, and that hurt, in an explanation
+	maxExplanationFeatures = 5
+	// minContribution is the minimum absolute contribution of a feature shown in an explanation
+	minContribution = 0.05
+)
+
+// errNoExplanation is returned when the predictor of the target can't explain its predictions:
+// there's no predictor, or it has been deployed on Vertex AI.
+var errNoExplanation = errors.New("no explainable predictor: train a predictor with the local backend")
+
+// lowerIsBetter are the sleep labels whose lower values are the better ones.
+var lowerIsBetter = map[string]bool{
+	"MinutesAfterWakeup":  true,
+	"MinutesAwake":        true,
+	"MinutesToFallAsleep": true,
+	"WakeSleepMinutes":    true,
+	"WakeSleepCount":      true,
+}
+
+// featureContribution is the contribution of a feature to a prediction.
+type featureContribution struct {
+	Feature string `json:"feature"`
+	// Value is the value of the feature, empty if missing
+	Value        string  `json:"value"`
+	Contribution float64 `json:"contribution"`
+	// Description explains the contribution in plain language
+	Description string `json:"description"`
+}
+
+// predictionExplanation explains the prediction of the target for a day, ranking the features
+// that helped (moved the prediction towards the better values) and the ones that hurt.
+type predictionExplanation struct {
+	Target string `json:"target"`
+	Date   string `json:"date"`
+	// Baseline is the prediction before looking at the features of the day:
+	// the average of the training days
+	Baseline   float64 `json:"baseline"`
+	Prediction float64 `json:"prediction"`
+	// Actual is the real value of the target, if already known
+	Actual *float64              `json:"actual,omitempty"`
+	Helped []featureContribution `json:"helped"`
+	Hurt   []featureContribution `json:"hurt"`
+}
+
+// humanize converts the name of a column to lower case words, e.g. MinutesVeryActive to "minutes very active"
+// and StepsMean7 to "steps mean 7".
+func humanize(column string) string {
+	var builder strings.Builder
+	var previous rune
+	for i, r := range column {
+		if i > 0 && (unicode.IsUpper(r) || unicode.IsDigit(r) && !unicode.IsDigit(previous)) {
+			builder.WriteRune(' ')
+		}
+		builder.WriteRune(unicode.ToLower(r))
+		previous = r
+	}
+	return builder.String()
+}
+
+// ExplainPrediction explains the prediction of the target for the day, with the contribution of every
+// feature along the paths of the day in the trees of the active predictor, if trained in process.
+func ExplainPrediction(user *types.User, target string, day *UserData) (*predictionExplanation, error) {
+	predictor, err := activePredictor(user.ID, target)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errNoExplanation
+		}
+		return nil, err
+	}
+	if predictor.Backend != predictorBackendLocal {
+		return nil, errNoExplanation
+	}
+	var model gbtModel
+	if err = json.Unmarshal([]byte(predictor.Model), &model); err != nil {
+		return nil, err
+	}
+
+	var rows [][]float64
+	if rows, err = featureRowsWithHistory(user, model.spec(), []*UserData{day}); err != nil {
+		return nil, err
+	}
+	explanation := explainRow(&model, target, day.Date, rows[0])
+	if values, present, err := targetValues([]*UserData{day}, target); err == nil && present[0] {
+		explanation.Actual = &values[0]
+	}
+	return explanation, nil
+}
+
+// explainRow explains the prediction of the model for the row of the features of the date.
+// The contributions of all the features sum to the prediction minus the baseline: the explanation
+// omits only the ones below minContribution, and the ones beyond maxExplanationFeatures.
+func explainRow(model *gbtModel, target string, date time.Time, row []float64) *predictionExplanation {
+	bias, contributions := model.Contributions(row)
+	explanation := predictionExplanation{
+		Target:     target,
+		Date:       date.Format(time.DateOnly),
+		Baseline:   twoDecimals(bias),
+		Prediction: twoDecimals(model.Predict(row)),
+		Helped:     []featureContribution{},
+		Hurt:       []featureContribution{},
+	}
+
+	order := make([]int, len(contributions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return math.Abs(contributions[order[i]]) > math.Abs(contributions[order[j]])
+	})
+	for _, feature := range order {
+		contribution := contributions[feature]
+		if math.Abs(contribution) < minContribution {
+			break
+		}
+		value := ""
+		if !math.IsNaN(row[feature]) {
+			value = strconv.FormatFloat(twoDecimals(row[feature]), 'f', -1, 64)
+		}
+		item := featureContribution{
+			Feature:      model.Features[feature],
+			Value:        value,
+			Contribution: twoDecimals(contribution),
+			Description:  describeContribution(model.Features[feature], value, target, contribution),
+		}
+		if (contribution > 0) != lowerIsBetter[target] {
+			if len(explanation.Helped) < maxExplanationFeatures {
+				explanation.Helped = append(explanation.Helped, item)
+			}
+		} else if len(explanation.Hurt) < maxExplanationFeatures {
+			explanation.Hurt = append(explanation.Hurt, item)
+		}
+	}
+	return &explanation
+}
+
+// describeContribution explains in plain language the contribution of the feature to the prediction of the target.
+func describeContribution(feature, value, target string, contribution float64) string {
+	direction := "raised"
+	if contribution < 0 {
+		direction = "lowered"
+	}
+	subject := fmt.Sprintf("Your %s (%s)", humanize(feature), value)
+	if value == "" {
+		subject = fmt.Sprintf("Not tracking your %s", humanize(feature))
+	}
+	return fmt.Sprintf("%s %s the predicted %s by %.1f", subject, direction, humanize(target), math.Abs(contribution))
+}
+
+// PredictionExplanation returns, as JSON, the explanation of the prediction for the day in the URL.
+// The target query parameter is the predicted column (default SleepEfficiency).
+func PredictionExplanation() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		var date time.Time
+		if date, err = time.Parse(time.DateOnly, fmt.Sprintf("%s-%s-%s", c.Param("year"), c.Param("month"), c.Param("day"))); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid date")
+		}
+		target := c.QueryParam("target")
+		if target == "" {
+			target = "SleepEfficiency"
+		}
+
+		var fetcher *fetcher
+		if fetcher, err = NewFetcher(user); err != nil {
+			log.Error("PredictionExplanation - NewFetcher: ", err)
+			return err
+		}
+		var day *UserData
+		if day, err = fetcher.FetchByDate(date); err != nil {
+			log.Error("PredictionExplanation - FetchByDate: ", err)
+			return err
+		}
+		var explanation *predictionExplanation
+		if explanation, err = ExplainPrediction(user, target, day); err != nil {
+			if errors.Is(err, errNoExplanation) {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			log.Error("PredictionExplanation: ", err)
+			return err
+		}
+		return c.JSON(http.StatusOK, explanation)
+	}
+}
@@ -0,0 +1,95 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// explainedContribution returns the sum of the contributions of the explanation.
+func explainedContribution(explanation *predictionExplanation) float64 {
+	var sum float64
+	for _, item := range append(explanation.Helped, explanation.Hurt...) {
+		sum += item.Contribution
+	}
+	return sum
+}
+
+func TestExplainRow(t *testing.T) {
+	// Two trees: the first splits on the steps, then on the very active minutes (missing to the left),
+	// the second on the resting heart rate
+	model := &gbtModel{
+		Features:     []string{"Steps", "MinutesVeryActive", "RestingHeartRate"},
+		Base:         85,
+		LearningRate: 0.5,
+		Trees: []gbtTree{
+			{
+				{Feature: 0, Threshold: 8000, Left: 1, Right: 2, Value: 1},
+				{Value: -2},
+				{Feature: 1, Threshold: 30, MissingLeft: true, Left: 3, Right: 4, Value: 3},
+				{Value: 2},
+				{Value: 6},
+			},
+			{
+				{Feature: 2, Threshold: 60, Left: 1, Right: 2, Value: 0},
+				{Value: 1},
+				{Value: -4},
+			},
+		},
+	}
+	date := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	row := []float64{10000, math.NaN(), 65}
+
+	explanation := explainRow(model, "SleepEfficiency", date, row)
+	// The baseline is the prediction before any split: 85 + 0.5*1 + 0.5*0
+	if explanation.Baseline != 85.5 || explanation.Prediction != 84 || explanation.Date != "2024-03-04" {
+		t.Fatalf("explanation %+v, want the prediction 84 from the baseline 85.5 on 2024-03-04", explanation)
+	}
+	if sum := explainedContribution(explanation); sum != explanation.Prediction-explanation.Baseline {
+		t.Errorf("contributions sum to %.2f, want the prediction minus the baseline %.2f", sum, explanation.Prediction-explanation.Baseline)
+	}
+	if len(explanation.Helped) != 1 || explanation.Helped[0].Feature != "Steps" || explanation.Helped[0].Contribution != 1 ||
+		explanation.Helped[0].Value != "10000" {
+		t.Errorf("helped %+v, want the steps raising the prediction by 1", explanation.Helped)
+	}
+	// The features that hurt are sorted by the absolute contribution, the missing values have no value
+	if len(explanation.Hurt) != 2 || explanation.Hurt[0].Feature != "RestingHeartRate" || explanation.Hurt[0].Contribution != -2 ||
+		explanation.Hurt[1].Feature != "MinutesVeryActive" || explanation.Hurt[1].Contribution != -0.5 {
+		t.Fatalf("hurt %+v, want the resting heart rate (-2) and the very active minutes (-0.5)", explanation.Hurt)
+	}
+	if want := "Not tracking your minutes very active lowered the predicted sleep efficiency by 0.5"; explanation.Hurt[1].Description != want {
+		t.Errorf("description %q, want %q", explanation.Hurt[1].Description, want)
+	}
+
+	// A lower number of minutes awake is better: the features that lowered it helped
+	explanation = explainRow(model, "MinutesAwake", date, row)
+	if len(explanation.Helped) != 2 || len(explanation.Hurt) != 1 || explanation.Hurt[0].Feature != "Steps" {
+		t.Errorf("helped %+v and hurt %+v, want the steps only to hurt", explanation.Helped, explanation.Hurt)
+	}
+	if sum := explainedContribution(explanation); sum != explanation.Prediction-explanation.Baseline {
+		t.Errorf("contributions sum to %.2f, want the prediction minus the baseline %.2f", sum, explanation.Prediction-explanation.Baseline)
+	}
+}
+
+func TestExplainRowTrained(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	x, y := syntheticRegression(r, 200)
+	model, err := trainGBT([]string{"Noise", "Signal"}, x, y, gbtParams{Trees: 20, MaxDepth: 2, MinLeaf: 5, LearningRate: 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The explanation omits only the contributions below minContribution, and every value is rounded
+	tolerance := float64(len(model.Features))*minContribution + 0.01*float64(len(model.Features)+2)
+	for i, row := range x[:50] {
+		explanation := explainRow(model, "SleepEfficiency", time.Time{}, row)
+		if sum := explainedContribution(explanation); math.Abs(sum-(explanation.Prediction-explanation.Baseline)) > tolerance {
+			t.Fatalf("row %d: contributions sum to %.2f, want the prediction minus the baseline %.2f",
+				i, sum, explanation.Prediction-explanation.Baseline)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+// featureSpec declares the features of a predictor, computed by the feature pipeline from the UserData.
+// UserData.Values() contains only the data of the same day: the pipeline adds the data of the previous
+// days, thus a predictor can learn that a hard workout or a few short nights affect the sleep.
+// The spec is stored with the predictor: the features of the predictions are computed exactly as
+// the features of the training.
+type featureSpec struct {
+	// Columns are the columns of UserData.Headers() used as they are
+	Columns []string `json:"columns"`
+	// History are the columns of UserData.Headers() whose values of the previous days are features:
+	// the values of Lags days before, and their mean and standard deviation in the Windows days before
+	History []string `json:"history"`
+	Lags    []int    `json:"lags"`
+	Windows []int    `json:"windows"`
+	// DayOfWeek adds the day of the week, from 0 (Sunday) to 6
+	DayOfWeek bool `json:"day_of_week"`
+	// LastActivityBeforeBed adds the minutes between the end of the last activity and the start of the sleep
+	LastActivityBeforeBed bool `json:"last_activity_before_bed"`
+	// SleepDebtDays adds the sleep debt: the sum, over the nights of the SleepDebtDays days before,
+	// of the minutes asleep missing to SleepNeed (the longer nights reduce it). Zero disables it.
+	SleepDebtDays int     `json:"sleep_debt_days"`
+	SleepNeed     float64 `json:"sleep_need"`
+}
+
+// newFeatureSpec returns the spec of the predictors trained from now on: the columns of the same day,
+// and the history of the sleep, of the activity and of the heart.
+func newFeatureSpec(columns []string) *featureSpec {
+	return &featureSpec{
+		Columns: columns,
+		History: []string{
+			"MinutesAsleep", "SleepEfficiency",
+			"Steps", "MinutesVeryActive", "ActiveZoneMinutesSum",
+			"RestingHeartRate", "DailyRmssd",
+		},
+		Lags:                  []int{1, 2},
+		Windows:               []int{3, 7, 28},
+		DayOfWeek:             true,
+		LastActivityBeforeBed: true,
+		SleepDebtDays:         7,
+		SleepNeed:             8 * 60,
+	}
+}
+
+// Names returns the names of the features, in the order of the columns of the rows.
+func (s *featureSpec) Names() []string {
+	names := append([]string{}, s.Columns...)
+	for _, column := range s.History {
+		for _, lag := range s.Lags {
+			names = append(names, fmt.Sprintf("%sLag%d", column, lag))
+		}
+		for _, window := range s.Windows {
+			names = append(names, fmt.Sprintf("%sMean%d", column, window), fmt.Sprintf("%sStd%d", column, window))
+		}
+	}
+	if s.DayOfWeek {
+		names = append(names, "DayOfWeek")
+	}
+	if s.LastActivityBeforeBed {
+		names = append(names, "MinutesFromLastActivityToBed")
+	}
+	if s.SleepDebtDays > 0 {
+		names = append(names, fmt.Sprintf("SleepDebt%d", s.SleepDebtDays))
+	}
+	return names
+}
+
+// HistoryDays returns the number of days, before the first predicted day, required by the features.
+func (s *featureSpec) HistoryDays() int {
+	days := s.SleepDebtDays
+	if s.LastActivityBeforeBed && days < 1 {
+		days = 1
+	}
+	if len(s.History) > 0 {
+		for _, lag := range s.Lags {
+			days = max(days, lag)
+		}
+		for _, window := range s.Windows {
+			days = max(days, window)
+		}
+	}
+	return days
+}
+
+// Rows returns the rows of the features of every UserData, in the order of Names.
+// The previous days are looked up by date among the same UserData: the missing days,
+// and the missing values, are NaN.
+func (s *featureSpec) Rows(userData []*UserData) [][]float64 {
+	headers := (UserData{}).Headers()
+	columns := make(map[string]int, len(headers))
+	for i, header := range headers {
+		columns[header] = i
+	}
+	// The values of the columns used by the spec, for every day
+	used := append(append([]string{"MinutesAsleep"}, s.Columns...), s.History...)
+	values := make(map[string][]float64, len(used))
+	for _, column := range used {
+		values[column] = make([]float64, len(userData))
+		for i := range userData {
+			values[column][i] = math.NaN()
+		}
+	}
+	days := make(map[string]int, len(userData))
+	for i, day := range userData {
+		days[dateKey(day.Date)] = i
+		dayValues := day.Values()
+		for column := range values {
+			if index, ok := columns[column]; ok {
+				if value, err := strconv.ParseFloat(dayValues[index], 64); err == nil {
+					values[column][i] = value
+				}
+			}
+		}
+	}
+	// previous returns the values of the column in the days before the day, from the most recent
+	previous := func(column string, day time.Time, count int) []float64 {
+		ret := make([]float64, count)
+		for k := range ret {
+			ret[k] = math.NaN()
+			if index, ok := days[dateKey(day.AddDate(0, 0, -k-1))]; ok {
+				ret[k] = values[column][index]
+			}
+		}
+		return ret
+	}
+
+	rows := make([][]float64, len(userData))
+	for i, day := range userData {
+		row := make([]float64, 0, len(s.Columns))
+		for _, column := range s.Columns {
+			row = append(row, values[column][i])
+		}
+		for _, column := range s.History {
+			for _, lag := range s.Lags {
+				row = append(row, previous(column, day.Date, lag)[lag-1])
+			}
+			for _, window := range s.Windows {
+				mean, std := meanStd(previous(column, day.Date, window))
+				row = append(row, mean, std)
+			}
+		}
+		if s.DayOfWeek {
+			row = append(row, float64(day.Date.Weekday()))
+		}
+		if s.LastActivityBeforeBed {
+			var before *UserData
+			if index, ok := days[dateKey(day.Date.AddDate(0, 0, -1))]; ok {
+				before = userData[index]
+			}
+			row = append(row, minutesFromLastActivityToBed(day, before))
+		}
+		if s.SleepDebtDays > 0 {
+			debt := math.NaN()
+			for _, minutesAsleep := range previous("MinutesAsleep", day.Date, s.SleepDebtDays) {
+				if !math.IsNaN(minutesAsleep) {
+					if math.IsNaN(debt) {
+						debt = 0
+					}
+					debt += s.SleepNeed - minutesAsleep
+				}
+			}
+			row = append(row, debt)
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// meanStd returns the mean and the standard deviation of the values that are not NaN.
+// The mean is NaN without values, the standard deviation with less than two values.
+func meanStd(values []float64) (mean, std float64) {
+	var count int
+	for _, value := range values {
+		if !math.IsNaN(value) {
+			mean += value
+			count++
+		}
+	}
+	if count == 0 {
+		return math.NaN(), math.NaN()
+	}
+	mean /= float64(count)
+	if count < 2 {
+		return mean, math.NaN()
+	}
+	for _, value := range values {
+		if !math.IsNaN(value) {
+			std += (value - mean) * (value - mean)
+		}
+	}
+	return mean, math.Sqrt(std / float64(count))
+}
+
+// minutesFromLastActivityToBed returns the minutes between the end of the last activity, of the day
+// or of the day before, and the start of the main sleep of the day. NaN if there's no sleep or activity.
+// The sleep of a day is the night ending that day: it usually starts the evening of the day before.
+func minutesFromLastActivityToBed(day, before *UserData) float64 {
+	if day.SleepLog == nil {
+		return math.NaN()
+	}
+	bedtime := day.SleepLog.StartTime
+	minutes := math.NaN()
+	for _, activities := range []*DailyActivities{day.Activities, activitiesOf(before)} {
+		if activities == nil {
+			continue
+		}
+		for _, activity := range *activities {
+			end := activity.StartTime.Add(time.Duration(activity.Duration) * time.Millisecond)
+			if end.After(bedtime) {
+				continue
+			}
+			if gap := bedtime.Sub(end).Minutes(); math.IsNaN(minutes) || gap < minutes {
+				minutes = gap
+			}
+		}
+	}
+	return minutes
+}
+
+// activitiesOf returns the activities of the UserData, nil if the UserData is nil.
+func activitiesOf(day *UserData) *DailyActivities {
+	if day == nil {
+		return nil
+	}
+	return day.Activities
+}
+
+// spec returns the spec of the features of the model.
+func (m *gbtModel) spec() *featureSpec {
+	if m.Spec != nil {
+		return m.Spec
+	}
+	return &featureSpec{Columns: m.Features}
+}
+
+// featureRowsWithHistory returns the rows of the features of the UserData, computed with the days
+// before the first UserData required by the spec, fetched from the database.
+func featureRowsWithHistory(user *types.User, spec *featureSpec, userData []*UserData) ([][]float64, error) {
+	if len(userData) == 0 {
+		return nil, nil
+	}
+	if historyDays := spec.HistoryDays(); historyDays > 0 {
+		first := userData[0].Date
+		for _, day := range userData {
+			if day.Date.Before(first) {
+				first = day.Date
+			}
+		}
+		fetcher, err := NewFetcher(user)
+		if err != nil {
+			return nil, err
+		}
+		var history []*UserData
+		if history, err = fetcher.FetchByRange(first.AddDate(0, 0, -historyDays), first.AddDate(0, 0, -1)); err != nil {
+			return nil, err
+		}
+		return spec.Rows(append(history, userData...))[len(history):], nil
+	}
+	return spec.Rows(userData), nil
+}
@@ -0,0 +1,113 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+func TestFeatureSpecNames(t *testing.T) {
+	spec := newFeatureSpec([]string{"Steps"})
+	names := spec.Names()
+	if len(names) != len(spec.Rows([]*UserData{syntheticDay(time.Now(), 1, 1)})[0]) {
+		t.Fatalf("%d names, but the rows have a different number of columns", len(names))
+	}
+	for i, want := range map[int]string{0: "Steps", 1: "MinutesAsleepLag1", 3: "MinutesAsleepMean3", 4: "MinutesAsleepStd3", len(names) - 1: "SleepDebt7"} {
+		if names[i] != want {
+			t.Errorf("names[%d] = %s, want %s", i, names[i], want)
+		}
+	}
+	if days := spec.HistoryDays(); days != 28 {
+		t.Errorf("HistoryDays() = %d, want 28", days)
+	}
+	// The models trained before the feature pipeline use only the same-day columns
+	if days := (&gbtModel{Features: []string{"Steps"}}).spec().HistoryDays(); days != 0 {
+		t.Errorf("HistoryDays() of a model without spec = %d, want 0", days)
+	}
+}
+
+func TestFeatureSpecRows(t *testing.T) {
+	start := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC) // Monday
+	var userData []*UserData
+	for i := 0; i < 10; i++ {
+		// The sixth day is missing
+		if i == 5 {
+			continue
+		}
+		userData = append(userData, syntheticDay(start.AddDate(0, 0, i), float64(1000*i), int64(400+10*i)))
+	}
+	// An activity ending 2 hours before the bedtime of the last day
+	last := userData[len(userData)-1]
+	activity := types.ActivityLog{StartTime: last.SleepLog.StartTime.Add(-3 * time.Hour)}
+	activity.Duration = time.Hour.Milliseconds()
+	last.Activities = &DailyActivities{activity}
+
+	spec := &featureSpec{
+		Columns:               []string{"Steps"},
+		History:               []string{"MinutesAsleep"},
+		Lags:                  []int{1},
+		Windows:               []int{3},
+		DayOfWeek:             true,
+		LastActivityBeforeBed: true,
+		SleepDebtDays:         2,
+		SleepNeed:             480,
+	}
+	rows := spec.Rows(userData)
+	// The last day (the tenth), after 460, 470 and 480 minutes asleep
+	want := []float64{9000, 480, 470, math.Sqrt(200.0 / 3), float64(time.Wednesday), 120, 480 - 480 + 480 - 470}
+	for i, value := range rows[len(rows)-1] {
+		if math.Abs(value-want[i]) > 1e-9 {
+			t.Errorf("%s = %f, want %f", spec.Names()[i], value, want[i])
+		}
+	}
+	// The first day has no history
+	for i, value := range rows[0][1:4] {
+		if !math.IsNaN(value) {
+			t.Errorf("%s of the first day = %f, want NaN", spec.Names()[i+1], value)
+		}
+	}
+	// The day after the missing one has no lag
+	if lag := rows[5][1]; !math.IsNaN(lag) {
+		t.Errorf("lag after a missing day = %f, want NaN", lag)
+	}
+}
+
+func TestMeanStd(t *testing.T) {
+	tests := []struct {
+		values    []float64
+		mean, std float64
+	}{
+		{[]float64{1, math.NaN(), 3}, 2, 1},
+		{[]float64{math.NaN(), 3}, 3, math.NaN()},
+		{[]float64{math.NaN()}, math.NaN(), math.NaN()},
+	}
+	for _, test := range tests {
+		mean, std := meanStd(test.values)
+		if !sameFloat(mean, test.mean) || !sameFloat(std, test.std) {
+			t.Errorf("meanStd(%v) = %f, %f, want %f, %f", test.values, mean, std, test.mean, test.std)
+		}
+	}
+}
+
+// sameFloat returns true if the floats are equal, or both NaN.
+func sameFloat(a, b float64) bool {
+	return a == b || math.IsNaN(a) && math.IsNaN(b)
+}
+
+func TestHumanize(t *testing.T) {
+	for column, want := range map[string]string{
+		"MinutesVeryActive": "minutes very active",
+		"StepsMean28":       "steps mean 28",
+		"SleepDebt7":        "sleep debt 7",
+	} {
+		if got := humanize(column); got != want {
+			t.Errorf("humanize(%s) = %q, want %q", column, got, want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// gbtParams are the hyperparameters of the gradient boosted trees.
+type gbtParams struct {
+	// Trees is the number of trees of the ensemble
+	Trees int
+	// MaxDepth is the maximum depth of every tree
+	MaxDepth int
+	// MinLeaf is the minimum number of rows of a leaf
+	MinLeaf int
+	// LearningRate is the shrinkage of the contribution of every tree
+	LearningRate float64
+}
+
+// defaultGBTParams work well with the few hundreds of days of a user
+var defaultGBTParams = gbtParams{
+	Trees:        100,
+	MaxDepth:     3,
+	MinLeaf:      5,
+	LearningRate: 0.1,
+}
+
+// gbtNode is a node of a regression tree. A node without children is a leaf.
+type gbtNode struct {
+	// Feature is the index of the feature compared with Threshold
+	Feature   int     `json:"feature"`
+	Threshold float64 `json:"threshold"`
+	// MissingLeft is true if the rows without the feature go to the left child
+	MissingLeft bool `json:"missing_left"`
+	// Left and Right are the indexes of the children in the nodes of the tree.
+	// The root is the first node, thus 0 means no child.
+	Left  int `json:"left"`
+	Right int `json:"right"`
+	// Value is the prediction of a leaf. For the inner nodes, it's the average of their rows.
+	Value float64 `json:"value"`
+	// Rows is the number of training rows of the node
+	Rows int `json:"rows"`
+}
+
+// gbtTree is a regression tree, stored as a slice of nodes.
+type gbtTree []gbtNode
+
+// leaf returns the index of the leaf of the tree reached by the row x.
+func (t gbtTree) leaf(x []float64) int {
+	i := 0
+	for t[i].Left != 0 {
+		i = t.child(i, x)
+	}
+	return i
+}
+
+// child returns the child of the node reached by the row x.
+func (t gbtTree) child(node int, x []float64) int {
+	value := x[t[node].Feature]
+	if math.IsNaN(value) {
+		if t[node].MissingLeft {
+			return t[node].Left
+		}
+		return t[node].Right
+	}
+	if value <= t[node].Threshold {
+		return t[node].Left
+	}
+	return t[node].Right
+}
+
+// gbtModel is an ensemble of regression trees trained with gradient boosting on the squared error.
+// It's serialized in JSON to be stored in the database.
+type gbtModel struct {
+	// Features are the names of the columns of the rows, in order
+	Features []string `json:"features"`
+	// Spec computes the Features from the UserData. The models without Spec use the Features
+	// columns of the UserData as they are.
+	Spec         *featureSpec `json:"spec,omitempty"`
+	Base         float64      `json:"base"`
+	LearningRate float64      `json:"learning_rate"`
+	Trees        []gbtTree    `json:"trees"`
+}
+
+// Predict returns the prediction for the row x, whose columns are the model Features.
+// The missing values are NaN.
+func (m *gbtModel) Predict(x []float64) float64 {
+	prediction := m.Base
+	for _, tree := range m.Trees {
+		prediction += m.LearningRate * tree[tree.leaf(x)].Value
+	}
+	return prediction
+}
+
+// Contributions explains the prediction for the row x with the contribution of every feature,
+// measured along the path of x in the trees: every split changes the value of the node to the value
+// of the child, and the change is attributed to the feature of the split. The bias is the prediction
+// before any split, i.e. the average of the training labels. Bias plus contributions is the prediction.
+func (m *gbtModel) Contributions(x []float64) (bias float64, contributions []float64) {
+	contributions = make([]float64, len(m.Features))
+	bias = m.Base
+	for _, tree := range m.Trees {
+		bias += m.LearningRate * tree[0].Value
+		for node := 0; tree[node].Left != 0; {
+			child := tree.child(node, x)
+			contributions[tree[node].Feature] += m.LearningRate * (tree[child].Value - tree[node].Value)
+			node = child
+		}
+	}
+	return bias, contributions
+}
+
+// trainGBT trains the gradient boosted trees on the rows x, with the labels y.
+// The columns of x are the features, the missing values are NaN.
+func trainGBT(features []string, x [][]float64, y []float64, params gbtParams) (*gbtModel, error) {
+	if len(x) == 0 || len(x) != len(y) {
+		return nil, errors.New("trainGBT: the rows and the labels must be the same non-zero number")
+	}
+
+	model := &gbtModel{Features: features, LearningRate: params.LearningRate}
+	for _, label := range y {
+		model.Base += label
+	}
+	model.Base /= float64(len(y))
+
+	// The rows with the feature, sorted by the value of the feature. Computed once,
+	// and filtered by node during the search of the splits.
+	sorted := make([][]int, len(features))
+	for feature := range features {
+		for row := range x {
+			if !math.IsNaN(x[row][feature]) {
+				sorted[feature] = append(sorted[feature], row)
+			}
+		}
+		sort.SliceStable(sorted[feature], func(i, j int) bool {
+			return x[sorted[feature][i]][feature] < x[sorted[feature][j]][feature]
+		})
+	}
+
+	residuals := make([]float64, len(y))
+	for row := range y {
+		residuals[row] = y[row] - model.Base
+	}
+	builder := gbtTreeBuilder{x: x, sorted: sorted, params: params, node: make([]int, len(x))}
+	for i := 0; i < params.Trees; i++ {
+		tree := builder.build(residuals)
+		for row := range x {
+			residuals[row] -= params.LearningRate * tree[tree.leaf(x[row])].Value
+		}
+		model.Trees = append(model.Trees, tree)
+	}
+	return model, nil
+}
+
+// gbtTreeBuilder builds the regression trees on the residuals, splitting the nodes
+// to maximize the reduction of the squared error.
+type gbtTreeBuilder struct {
+	x      [][]float64
+	sorted [][]int
+	params gbtParams
+	// node contains, for every row, the index of the node of the tree containing it
+	node []int
+}
+
+// gbtSplit is the best split of a node found by the builder.
+type gbtSplit struct {
+	feature     int
+	threshold   float64
+	missingLeft bool
+	gain        float64
+}
+
+// build returns the tree fitting the residuals.
+func (b *gbtTreeBuilder) build(residuals []float64) gbtTree {
+	for row := range b.node {
+		b.node[row] = 0
+	}
+	tree := gbtTree{{}}
+	// The nodes to split, level by level
+	level := []int{0}
+	for depth := 0; ; depth++ {
+		sums := make(map[int]float64, len(level))
+		counts := make(map[int]int, len(level))
+		for row, node := range b.node {
+			sums[node] += residuals[row]
+			counts[node]++
+		}
+		for _, node := range level {
+			tree[node].Rows = counts[node]
+			if counts[node] > 0 {
+				tree[node].Value = sums[node] / float64(counts[node])
+			}
+		}
+		if depth == b.params.MaxDepth {
+			break
+		}
+
+		var next []int
+		for _, node := range level {
+			split, ok := b.bestSplit(node, residuals, sums[node], counts[node])
+			if !ok {
+				continue
+			}
+			left, right := len(tree), len(tree)+1
+			tree[node].Feature = split.feature
+			tree[node].Threshold = split.threshold
+			tree[node].MissingLeft = split.missingLeft
+			tree[node].Left, tree[node].Right = left, right
+			tree = append(tree, gbtNode{}, gbtNode{})
+			next = append(next, left, right)
+		}
+		if len(next) == 0 {
+			break
+		}
+		// Move the rows of the nodes just split to their children
+		for row, node := range b.node {
+			if tree[node].Left != 0 {
+				b.node[row] = tree.child(node, b.x[row])
+			}
+		}
+		level = next
+	}
+	return tree
+}
+
+// bestSplit returns the split of the node with the highest reduction of the squared error.
+// The rows without the feature go to the side that reduces the error the most.
+func (b *gbtTreeBuilder) bestSplit(node int, residuals []float64, sum float64, count int) (best gbtSplit, found bool) {
+	minLeaf := b.params.MinLeaf
+	if count < 2*minLeaf {
+		return best, false
+	}
+	parent := sum * sum / float64(count)
+	for feature, rows := range b.sorted {
+		// The rows of the node with the feature, sorted by value
+		var present []int
+		var presentSum float64
+		for _, row := range rows {
+			if b.node[row] == node {
+				present = append(present, row)
+				presentSum += residuals[row]
+			}
+		}
+		missingSum, missingCount := sum-presentSum, count-len(present)
+
+		var leftSum float64
+		for i := 0; i < len(present)-1; i++ {
+			leftSum += residuals[present[i]]
+			value, nextValue := b.x[present[i]][feature], b.x[present[i+1]][feature]
+			if value == nextValue {
+				continue
+			}
+			leftCount := i + 1
+			rightSum, rightCount := presentSum-leftSum, len(present)-leftCount
+			for _, missingLeft := range []bool{false, true} {
+				l, lc, r, rc := leftSum, leftCount, rightSum+missingSum, rightCount+missingCount
+				if missingLeft {
+					l, lc, r, rc = leftSum+missingSum, leftCount+missingCount, rightSum, rightCount
+				}
+				if lc < minLeaf || rc < minLeaf {
+					continue
+				}
+				gain := l*l/float64(lc) + r*r/float64(rc) - parent
+				if gain > best.gain {
+					best = gbtSplit{feature: feature, threshold: (value + nextValue) / 2, missingLeft: missingLeft, gain: gain}
+					found = true
+				}
+				if missingCount == 0 {
+					break
+				}
+			}
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,86 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// syntheticRegression returns n rows of two features, the first one often missing,
+// and labels that depend on both features, with a standard normal noise.
+func syntheticRegression(r *rand.Rand, n int) ([][]float64, []float64) {
+	x := make([][]float64, n)
+	y := make([]float64, n)
+	for i := range x {
+		x[i] = []float64{r.Float64() * 10, r.Float64() * 10}
+		y[i] = 80 + 1.5*x[i][1] + r.NormFloat64()
+		if r.Intn(4) == 0 {
+			x[i][0] = math.NaN()
+		}
+		if x[i][1] > 5 {
+			y[i] += 3
+		}
+	}
+	return x, y
+}
+
+func TestTrainGBT(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	x, y := syntheticRegression(r, 500)
+	model, err := trainGBT([]string{"Noise", "Signal"}, x[:400], y[:400], defaultGBTParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	predictions := make([]float64, 100)
+	for i, row := range x[400:] {
+		predictions[i] = model.Predict(row)
+	}
+	_, rmse := regressionMetrics(predictions, y[400:])
+	// The noise is the lower bound of the error
+	if rmse < 0.8 || rmse > 1.6 {
+		t.Errorf("held-out RMSE = %.2f, want about 1 (the noise)", rmse)
+	}
+
+	if _, err = trainGBT([]string{"Noise", "Signal"}, x, y[:10], defaultGBTParams); err == nil {
+		t.Error("trainGBT() with less labels than rows: want an error")
+	}
+}
+
+func TestGBTContributions(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	x, y := syntheticRegression(r, 200)
+	model, err := trainGBT([]string{"Noise", "Signal"}, x, y, defaultGBTParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signal, noise float64
+	for _, row := range x {
+		bias, contributions := model.Contributions(row)
+		sum := bias
+		for _, contribution := range contributions {
+			sum += contribution
+		}
+		if math.Abs(sum-model.Predict(row)) > 1e-9 {
+			t.Fatalf("bias + contributions = %f, want the prediction %f", sum, model.Predict(row))
+		}
+		noise += math.Abs(contributions[0])
+		signal += math.Abs(contributions[1])
+	}
+	if signal < 10*noise {
+		t.Errorf("contributions of the signal %.2f and of the noise %.2f: want the signal to dominate", signal, noise)
+	}
+}
+
+func TestRegressionMetrics(t *testing.T) {
+	mae, rmse := regressionMetrics([]float64{1, 2, 3}, []float64{2, 2, 6})
+	if mae != 4.0/3 || math.Abs(rmse-math.Sqrt(10.0/3)) > 1e-12 {
+		t.Errorf("regressionMetrics() = %f, %f, want %f, %f", mae, rmse, 4.0/3, math.Sqrt(10.0/3))
+	}
+	if mae, rmse = regressionMetrics(nil, nil); mae != 0 || rmse != 0 {
+		t.Errorf("regressionMetrics() without labels = %f, %f, want 0, 0", mae, rmse)
+	}
+}
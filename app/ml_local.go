@@ -0,0 +1,221 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/gommon/log"
+)
+
+// Backends of the predictors
+const (
+	// predictorBackendLocal trains the gradient boosted trees in process, and stores them in the database
+	predictorBackendLocal = "local"
+	// predictorBackendVertex trains the models with a custom job on Vertex AI, and deploys them on an endpoint
+	predictorBackendVertex = "vertex"
+)
+
+const (
+	// minTrainingRows is the minimum number of days with the target required to train a predictor
+	minTrainingRows = 30
+	// holdoutFraction is the fraction of the most recent days used to evaluate a predictor
+	holdoutFraction = 0.2
+)
+
+// isSkipped returns true if the column is in columns.
+func isSkipped(column string, columns []string) bool {
+	for _, c := range columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// predictorFeatures returns the columns of UserData.Headers() usable as same-day features (the Columns
+// of the featureSpec) of the predictor of the target: the numeric columns, without the sleep labels and the date.
+// A column is numeric if all its values are numbers or missing.
+func predictorFeatures(userData []*UserData) []string {
+	headers := (UserData{}).Headers()
+	numeric := make([]bool, len(headers))
+	for i := range numeric {
+		numeric[i] = !isSkipped(headers[i], sleepLabels) && headers[i] != "Date"
+	}
+	for _, day := range userData {
+		for i, value := range day.Values() {
+			if value == "" || !numeric[i] {
+				continue
+			}
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				numeric[i] = false
+			}
+		}
+	}
+	var features []string
+	for i, header := range headers {
+		if numeric[i] {
+			features = append(features, header)
+		}
+	}
+	return features
+}
+
+// targetValues returns the values of the target column of the UserData, and whether they are present.
+func targetValues(userData []*UserData, target string) ([]float64, []bool, error) {
+	column := -1
+	for i, header := range (UserData{}).Headers() {
+		if header == target {
+			column = i
+			break
+		}
+	}
+	if column < 0 || !isTarget(target) {
+		return nil, nil, fmt.Errorf("%q is not among the supported targets: %v", target, sleepLabels)
+	}
+	values := make([]float64, len(userData))
+	present := make([]bool, len(userData))
+	for i, day := range userData {
+		value, err := strconv.ParseFloat(day.Values()[column], 64)
+		values[i], present[i] = value, err == nil
+	}
+	return values, present, nil
+}
+
+// labeledDays returns the indexes of the UserData with the target, and the values of the target,
+// in chronological order.
+func labeledDays(userData []*UserData, target string) ([]int, []float64, error) {
+	labels, present, err := targetValues(userData, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	var days []int
+	for i := range userData {
+		if present[i] {
+			days = append(days, i)
+		}
+	}
+	sort.SliceStable(days, func(i, j int) bool {
+		return userData[days[i]].Date.Before(userData[days[j]].Date)
+	})
+	y := make([]float64, len(days))
+	for i, day := range days {
+		y[i] = labels[day]
+	}
+	return days, y, nil
+}
+
+// regressionMetrics returns the mean absolute error and the root mean squared error of the predictions.
+func regressionMetrics(predictions, y []float64) (mae, rmse float64) {
+	if len(y) == 0 {
+		return 0, 0
+	}
+	for i := range y {
+		diff := predictions[i] - y[i]
+		mae += math.Abs(diff)
+		rmse += diff * diff
+	}
+	return mae / float64(len(y)), math.Sqrt(rmse / float64(len(y)))
+}
+
+// trainLocalPredictor trains in process the gradient boosted trees predicting the targetColumn
+// from the features of newFeatureSpec, and registers the model as the new active version of the
+// predictor. The model is evaluated on the most recent days, after a training on the previous
+// ones, and then trained again on all the days. The days without the target (e.g. without sleep) are not used.
+func trainLocalPredictor(user *types.User, targetColumn string) (err error) {
+	var fetcher *fetcher
+	if fetcher, err = NewFetcher(user); err != nil {
+		log.Error("error creating fetcher: ", err)
+		return err
+	}
+	var allUserData []*UserData
+	if allUserData, err = fetcher.Fetch(FetchAllWithSleepLog); err != nil {
+		log.Error("error fetching user data: ", err)
+		return err
+	}
+
+	var days []int
+	var y []float64
+	if days, y, err = labeledDays(allUserData, targetColumn); err != nil {
+		return err
+	}
+	if len(days) < minTrainingRows {
+		return fmt.Errorf("at least %d days with %s are required to train a predictor, found %d", minTrainingRows, targetColumn, len(days))
+	}
+
+	// The features of the days with the target, computed with all the days before
+	spec := newFeatureSpec(predictorFeatures(allUserData))
+	features := spec.Names()
+	rows := spec.Rows(allUserData)
+	x := make([][]float64, len(days))
+	for i, day := range days {
+		x[i] = rows[day]
+	}
+	holdout := int(math.Ceil(float64(len(x)) * holdoutFraction))
+	split := len(x) - holdout
+
+	var model *gbtModel
+	if model, err = trainGBT(features, x[:split], y[:split], defaultGBTParams); err != nil {
+		log.Error("error training the predictor: ", err)
+		return err
+	}
+	predictions := make([]float64, holdout)
+	for i, row := range x[split:] {
+		predictions[i] = model.Predict(row)
+	}
+	mae, rmse := regressionMetrics(predictions, y[split:])
+
+	if model, err = trainGBT(features, x, y, defaultGBTParams); err != nil {
+		log.Error("error training the predictor: ", err)
+		return err
+	}
+	model.Spec = spec
+	var serialized []byte
+	if serialized, err = json.Marshal(model); err != nil {
+		return err
+	}
+	return registerPredictor(&types.Predictor{
+		UserID:        user.ID,
+		Target:        targetColumn,
+		Backend:       predictorBackendLocal,
+		Model:         string(serialized),
+		Features:      strings.Join(features, ","),
+		TrainingStart: sql.NullTime{Time: allUserData[days[0]].Date, Valid: true},
+		TrainingEnd:   sql.NullTime{Time: allUserData[days[len(days)-1]].Date, Valid: true},
+		TrainingRows:  int64(len(days)),
+		HoldoutRows:   int64(holdout),
+		MAE:           twoDecimals(mae),
+		RMSE:          twoDecimals(rmse),
+	})
+}
+
+// predictLocal returns the predictions of the predictor trained in process. The targets have
+// different ranges (e.g. the efficiency is a percentage, the minutes asleep are hundreds): the
+// predictions are not rounded nor clamped.
+func predictLocal(user *types.User, predictor *types.Predictor, userData []*UserData) ([]float64, error) {
+	if len(userData) == 0 {
+		return nil, fmt.Errorf("no predictions")
+	}
+	var model gbtModel
+	if err := json.Unmarshal([]byte(predictor.Model), &model); err != nil {
+		return nil, err
+	}
+	rows, err := featureRowsWithHistory(user, model.spec(), userData)
+	if err != nil {
+		return nil, err
+	}
+	predictions := make([]float64, len(userData))
+	for i, row := range rows {
+		predictions[i] = model.Predict(row)
+	}
+	return predictions, nil
+}
@@ -0,0 +1,256 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/galeone/igor"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// Status of the versions of the predictors
+const (
+	// predictorStatusActive is the version serving the predictions of the target
+	predictorStatusActive = "active"
+	// predictorStatusRetired are the previous versions, that can be activated again
+	predictorStatusRetired = "retired"
+)
+
+// activePredictor returns the active version of the predictor of the target of the user.
+func activePredictor(userID int64, target string) (*types.Predictor, error) {
+	var predictor types.Predictor
+	if err := _db.Model(types.Predictor{}).Where("user_id = ? AND target = ? AND status = ?", userID, target, predictorStatusActive).
+		Scan(&predictor); err != nil {
+		return nil, err
+	}
+	return &predictor, nil
+}
+
+// lockPredictorVersions serializes, until the end of the transaction, the changes to the versions
+// of the predictor of the target of the user: concurrent trainings would number the same version.
+// The lock is held by the database, thus it works with more instances of the application.
+func lockPredictorVersions(tx *igor.Database, userID int64, target string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", fmt.Sprintf("predictors/%d/%s", userID, target))
+}
+
+// registerPredictor stores the predictor as the new active version of its target,
+// and retires the version previously active.
+func registerPredictor(predictor *types.Predictor) (err error) {
+	tx := _db.Begin()
+	if err = lockPredictorVersions(tx, predictor.UserID, predictor.Target); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Exec("UPDATE predictors SET status = ? WHERE user_id = ? AND target = ? AND status = ?",
+		predictorStatusRetired, predictor.UserID, predictor.Target, predictorStatusActive); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Raw("SELECT COALESCE(MAX(version), 0) + 1 FROM predictors WHERE user_id = ? AND target = ?",
+		predictor.UserID, predictor.Target).Scan(&predictor.Version); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	predictor.Status = predictorStatusActive
+	predictor.CreatedAt = time.Now()
+	if err = tx.Create(predictor); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// activatePredictorVersion makes the version of the predictor of the target the active one,
+// e.g. to roll back a version worse than the previous one.
+func activatePredictorVersion(userID int64, target string, version int64) (err error) {
+	var predictor types.Predictor
+	if err = _db.Model(types.Predictor{}).Where("user_id = ? AND target = ? AND version = ?", userID, target, version).
+		Scan(&predictor); err != nil {
+		return err
+	}
+	tx := _db.Begin()
+	if err = lockPredictorVersions(tx, userID, target); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Exec("UPDATE predictors SET status = ? WHERE user_id = ? AND target = ? AND status = ?",
+		predictorStatusRetired, userID, target, predictorStatusActive); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Exec("UPDATE predictors SET status = ? WHERE id = ?", predictorStatusActive, predictor.ID); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// retrainPredictors trains again the active predictors of the user trained in process, when at least
+// PREDICTOR_RETRAIN_DAYS nights have been synchronized after the end of their training range.
+// The predictors deployed on Vertex AI are never trained again automatically.
+func retrainPredictors(user *types.User) {
+	predictors, err := predictorsToRetrain(user.ID, _predictorRetrainDays)
+	if err != nil {
+		log.Error("retrainPredictors: ", err)
+		return
+	}
+	for _, predictor := range predictors {
+		log.Printf("Training again the %s predictor of user %d", predictor.Target, user.ID)
+		if err := trainLocalPredictor(user, predictor.Target); err != nil {
+			log.Errorf("retrainPredictors: training the %s predictor of user %d: %s", predictor.Target, user.ID, err)
+		}
+	}
+}
+
+// predictorsToRetrain returns the active predictors of the user trained in process, whose
+// training range ends at least minNewNights main sleeps before the last synchronized one.
+func predictorsToRetrain(userID int64, minNewNights int) ([]types.Predictor, error) {
+	var predictors []types.Predictor
+	if err := _db.Model(types.Predictor{}).Where("user_id = ? AND status = ? AND backend = ?", userID, predictorStatusActive, predictorBackendLocal).
+		Scan(&predictors); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var outdated []types.Predictor
+	for _, predictor := range predictors {
+		var newNights int64
+		if err := _db.Raw("SELECT COUNT(*) FROM sleep_logs WHERE user_id = ? AND is_main_sleep AND date_of_sleep > ?",
+			userID, predictor.TrainingEnd.Time).Scan(&newNights); err != nil {
+			return nil, err
+		}
+		if newNights >= int64(minNewNights) {
+			outdated = append(outdated, predictor)
+		}
+	}
+	return outdated, nil
+}
+
+// predictorVersion is the JSON representation of a version of a predictor, in the registry.
+type predictorVersion struct {
+	Target        string    `json:"target"`
+	Version       int64     `json:"version"`
+	Status        string    `json:"status"`
+	Backend       string    `json:"backend"`
+	Features      []string  `json:"features"`
+	TrainingStart string    `json:"training_start,omitempty"`
+	TrainingEnd   string    `json:"training_end,omitempty"`
+	TrainingRows  int64     `json:"training_rows"`
+	HoldoutRows   int64     `json:"holdout_rows"`
+	MAE           float64   `json:"mae"`
+	RMSE          float64   `json:"rmse"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// newPredictorVersion returns the registry entry of the predictor.
+func newPredictorVersion(predictor types.Predictor) predictorVersion {
+	version := predictorVersion{
+		Target:       predictor.Target,
+		Version:      predictor.Version,
+		Status:       predictor.Status,
+		Backend:      predictor.Backend,
+		Features:     []string{},
+		TrainingRows: predictor.TrainingRows,
+		HoldoutRows:  predictor.HoldoutRows,
+		MAE:          predictor.MAE,
+		RMSE:         predictor.RMSE,
+		CreatedAt:    predictor.CreatedAt,
+	}
+	if predictor.Features != "" {
+		version.Features = strings.Split(predictor.Features, ",")
+	}
+	if predictor.TrainingStart.Valid {
+		version.TrainingStart = predictor.TrainingStart.Time.Format(time.DateOnly)
+	}
+	if predictor.TrainingEnd.Valid {
+		version.TrainingEnd = predictor.TrainingEnd.Time.Format(time.DateOnly)
+	}
+	return version
+}
+
+// isTarget returns true if the column can be predicted.
+func isTarget(column string) bool {
+	return isSkipped(column, sleepLabels)
+}
+
+// Predictors returns, as JSON, the versions of the predictors of the user,
+// by target and from the most recent. The target query parameter filters the target.
+func Predictors() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		condition := "user_id = ?"
+		args := []interface{}{user.ID}
+		if target := c.QueryParam("target"); target != "" {
+			condition += " AND target = ?"
+			args = append(args, target)
+		}
+		var predictors []types.Predictor
+		if err = _db.Model(types.Predictor{}).Where(condition, args...).Order("target, version DESC").
+			Scan(&predictors); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Error("Predictors: ", err)
+			return err
+		}
+		versions := []predictorVersion{}
+		for _, predictor := range predictors {
+			versions = append(versions, newPredictorVersion(predictor))
+		}
+		return c.JSON(http.StatusOK, versions)
+	}
+}
+
+// TrainPredictor trains in background a new version of the predictor of the target in the URL.
+func TrainPredictor() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		target := c.Param("target")
+		if !isTarget(target) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%q is not among the supported targets: %v", target, sleepLabels))
+		}
+		go func() {
+			if err := TrainAndDeployPredictor(user, target); err != nil {
+				log.Errorf("TrainPredictor: training the %s predictor of user %d: %s", target, user.ID, err)
+			}
+		}()
+		return c.NoContent(http.StatusAccepted)
+	}
+}
+
+// ActivatePredictor makes the version in the URL the active version of the predictor of the target.
+func ActivatePredictor() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		var version int64
+		if version, err = strconv.ParseInt(c.Param("version"), 10, 64); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid version")
+		}
+		if err = activatePredictorVersion(user.ID, c.Param("target"), version); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, "predictor version not found")
+			}
+			log.Error("ActivatePredictor: ", err)
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,208 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+func TestPredictLocal(t *testing.T) {
+	// The minutes asleep are above the range of a uint8
+	r := rand.New(rand.NewSource(1))
+	start := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	var userData []*UserData
+	var x [][]float64
+	var y []float64
+	for i := 0; i < 100; i++ {
+		day := syntheticDay(start.AddDate(0, 0, i), float64(r.Intn(10000)), 0)
+		userData = append(userData, day)
+		x = append(x, []float64{day.Steps.Value})
+		y = append(y, 400+day.Steps.Value/100)
+	}
+	model, err := trainGBT([]string{"Steps"}, x, y, defaultGBTParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := json.Marshal(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	predictor := &types.Predictor{Target: "MinutesAsleep", Backend: predictorBackendLocal, Model: string(serialized)}
+	predictions, err := predictLocal(&types.User{}, predictor, userData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, prediction := range predictions {
+		if prediction < 390 || prediction > 510 {
+			t.Fatalf("prediction %d = %.2f, want it in [390, 510] as the labels", i, prediction)
+		}
+	}
+}
+
+// testPredictor returns a local predictor of the target of the user, trained until trainingEnd.
+func testPredictor(user *types.User, target string, trainingEnd time.Time) *types.Predictor {
+	return &types.Predictor{
+		UserID:      user.ID,
+		Target:      target,
+		Backend:     predictorBackendLocal,
+		Model:       "{}",
+		TrainingEnd: sql.NullTime{Time: trainingEnd, Valid: true},
+	}
+}
+
+// predictorVersions returns the versions of the predictor of the target of the user, and the active one.
+func predictorVersions(t *testing.T, user *types.User, target string) (versions []int64, active int64) {
+	t.Helper()
+	var predictors []types.Predictor
+	if err := _db.Model(types.Predictor{}).Where("user_id = ? AND target = ?", user.ID, target).Order("version").
+		Scan(&predictors); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		t.Fatal(err)
+	}
+	for _, predictor := range predictors {
+		versions = append(versions, predictor.Version)
+		if predictor.Status == predictorStatusActive {
+			if active != 0 {
+				t.Errorf("versions %d and %d are both active", active, predictor.Version)
+			}
+			active = predictor.Version
+		}
+	}
+	return versions, active
+}
+
+func TestRegisterPredictor(t *testing.T) {
+	user := testDBUser(t)
+	now := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		if err := registerPredictor(testPredictor(user, "SleepEfficiency", now)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registerPredictor(testPredictor(user, "MinutesAsleep", now)); err != nil {
+		t.Fatal(err)
+	}
+	// Every target has its own versions, and only the last one is active
+	if versions, active := predictorVersions(t, user, "SleepEfficiency"); len(versions) != 3 || versions[2] != 3 || active != 3 {
+		t.Errorf("versions %v with %d active, want [1 2 3] with 3 active", versions, active)
+	}
+	if versions, active := predictorVersions(t, user, "MinutesAsleep"); len(versions) != 1 || active != 1 {
+		t.Errorf("versions %v with %d active, want [1] with 1 active", versions, active)
+	}
+
+	// Concurrent trainings get different versions
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := registerPredictor(testPredictor(user, "SleepEfficiency", now)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	versions, active := predictorVersions(t, user, "SleepEfficiency")
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	for i, version := range versions {
+		if version != int64(i+1) {
+			t.Fatalf("versions %v, want 1 to 8", versions)
+		}
+	}
+	if len(versions) != 8 || active != 8 {
+		t.Errorf("versions %v with %d active, want 1 to 8 with 8 active", versions, active)
+	}
+}
+
+func TestActivatePredictorVersion(t *testing.T) {
+	user := testDBUser(t)
+	for i := 0; i < 3; i++ {
+		if err := registerPredictor(testPredictor(user, "SleepEfficiency", time.Now().UTC())); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Roll back to the first version
+	if err := activatePredictorVersion(user.ID, "SleepEfficiency", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, active := predictorVersions(t, user, "SleepEfficiency"); active != 1 {
+		t.Errorf("version %d active, want 1", active)
+	}
+	if predictor, err := activePredictor(user.ID, "SleepEfficiency"); err != nil || predictor.Version != 1 {
+		t.Errorf("activePredictor() = %+v, %v: want the version 1", predictor, err)
+	}
+
+	// A missing version leaves the active one unchanged
+	if err := activatePredictorVersion(user.ID, "SleepEfficiency", 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("activatePredictorVersion() of a missing version = %v, want sql.ErrNoRows", err)
+	}
+	if _, active := predictorVersions(t, user, "SleepEfficiency"); active != 1 {
+		t.Errorf("version %d active after the missing version, want 1", active)
+	}
+
+	// The next training is the most recent version, and the active one
+	if err := registerPredictor(testPredictor(user, "SleepEfficiency", time.Now().UTC())); err != nil {
+		t.Fatal(err)
+	}
+	if versions, active := predictorVersions(t, user, "SleepEfficiency"); len(versions) != 4 || active != 4 {
+		t.Errorf("versions %v with %d active, want 4 versions with 4 active", versions, active)
+	}
+}
+
+func TestPredictorsToRetrain(t *testing.T) {
+	user := testDBUser(t)
+	trainingEnd := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+	if err := registerPredictor(testPredictor(user, "SleepEfficiency", trainingEnd)); err != nil {
+		t.Fatal(err)
+	}
+	// The predictors deployed on Vertex AI are never trained again
+	vertex := testPredictor(user, "MinutesAsleep", trainingEnd)
+	vertex.Backend, vertex.Endpoint = predictorBackendVertex, "endpoint"
+	if err := registerPredictor(vertex); err != nil {
+		t.Fatal(err)
+	}
+
+	logID := -user.ID * 1000
+	addSleep := func(date time.Time, mainSleep bool) {
+		t.Helper()
+		logID--
+		if err := _db.Exec(`INSERT INTO sleep_logs(log_id, user_id, date_of_sleep, start_time, end_time, is_main_sleep, log_type, "type")
+			VALUES (?, ?, ?, ?, ?, ?, 'auto_detected', 'stages')`,
+			logID, user.ID, date, date.Add(-time.Hour), date.Add(7*time.Hour), mainSleep); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The nights of the training range, a nap, and 6 new nights: not enough
+	addSleep(trainingEnd, true)
+	addSleep(trainingEnd.AddDate(0, 0, 1), false)
+	for i := 1; i <= 6; i++ {
+		addSleep(trainingEnd.AddDate(0, 0, i), true)
+	}
+	predictors, err := predictorsToRetrain(user.ID, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(predictors) != 0 {
+		t.Errorf("%d predictors to retrain after 6 new nights, want none", len(predictors))
+	}
+
+	addSleep(trainingEnd.AddDate(0, 0, 7), true)
+	if predictors, err = predictorsToRetrain(user.ID, 7); err != nil {
+		t.Fatal(err)
+	}
+	if len(predictors) != 1 || predictors[0].Target != "SleepEfficiency" {
+		t.Errorf("predictors to retrain after 7 new nights %+v, want the local SleepEfficiency predictor", predictors)
+	}
+}
@@ -6,6 +6,8 @@ package app
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -21,7 +23,18 @@ import (
 	storage "cloud.google.com/go/storage"
 )
 
+// TrainAndDeployPredictor trains the predictor of the targetColumn on all the data of the user,
+// with the configured PREDICTOR_BACKEND, and stores it in the predictors table.
 func TrainAndDeployPredictor(user *types.User, targetColumn string) (err error) {
+	if _predictorBackend == predictorBackendVertex {
+		return trainAndDeployVertexPredictor(user, targetColumn)
+	}
+	return trainLocalPredictor(user, targetColumn)
+}
+
+// trainAndDeployVertexPredictor trains the predictor with a custom job on Vertex AI
+// and deploys it on a new endpoint.
+func trainAndDeployVertexPredictor(user *types.User, targetColumn string) (err error) {
 
 	var fetcher *fetcher
 	if fetcher, err = NewFetcher(user); err != nil {
@@ -36,8 +49,10 @@ func TrainAndDeployPredictor(user *types.User, targetColumn string) (err error)
 
 	// 2. Prepare training data: convert them to csv
 	// ref: https://cloud.google.com/vertex-ai/docs/tabular-data/classification-regression/prepare-data#csv
+	// The same-day columns are already in the CSV: the spec adds only the history features
+	spec := newFeatureSpec(nil)
 	var csv string
-	if csv, err = userDataToCSV(allUserData); err != nil {
+	if csv, err = userDataToCSV(allUserData, spec); err != nil {
 		log.Error("error converting user data to csv: ", err)
 		return err
 	}
@@ -307,14 +322,45 @@ func TrainAndDeployPredictor(user *types.User, targetColumn string) (err error)
 		return err
 	}
 
-	return _db.Create(&types.Predictor{
-		UserID:   user.ID,
-		Target:   targetColumn,
-		Endpoint: endpoint.GetName(),
+	// The spec is stored in place of the model, to compute the same features in the predictions
+	var serializedSpec []byte
+	if serializedSpec, err = json.Marshal(spec); err != nil {
+		return err
+	}
+	return registerPredictor(&types.Predictor{
+		UserID:        user.ID,
+		Target:        targetColumn,
+		Endpoint:      endpoint.GetName(),
+		Backend:       predictorBackendVertex,
+		Model:         string(serializedSpec),
+		TrainingStart: sql.NullTime{Time: allUserData[len(allUserData)-1].Date, Valid: true},
+		TrainingEnd:   sql.NullTime{Time: allUserData[0].Date, Valid: true},
+		TrainingRows:  int64(len(allUserData)),
 	})
 }
 
-func PredictSleepEfficiency(user *types.User, userData []*UserData) ([]uint8, error) {
+// Predict predicts the target of every UserData with the active predictor of the target
+// of the user, trained by TrainAndDeployPredictor.
+func Predict(user *types.User, target string, userData []*UserData) ([]float64, error) {
+	predictor, err := activePredictor(user.ID, target)
+	if err != nil {
+		return nil, err
+	}
+	if predictor.Backend == predictorBackendVertex {
+		return predictVertex(user, predictor, userData)
+	}
+	return predictLocal(user, predictor, userData)
+}
+
+// PredictSleepEfficiency predicts the sleep efficiency of every UserData, see Predict.
+func PredictSleepEfficiency(user *types.User, userData []*UserData) ([]float64, error) {
+	return Predict(user, "SleepEfficiency", userData)
+}
+
+// predictVertex returns the predictions of the predictor deployed on Vertex AI.
+// The Model of the predictor is the featureSpec of the history features added to the training CSV:
+// empty for the predictors trained before the feature pipeline.
+func predictVertex(user *types.User, predictor *types.Predictor, userData []*UserData) ([]float64, error) {
 	var err error
 	ctx := context.Background()
 
@@ -324,37 +370,21 @@ func PredictSleepEfficiency(user *types.User, userData []*UserData) ([]uint8, er
 	}
 	defer predictionClient.Close()
 	var instances []*structpb.Value
-	var toSkip []string = []string{
-		// potential labels excluded during training
-		"MinutesAfterWakeup",
-		"MinutesAsleep",
-		"MinutesAwake",
-		"MinutesToFallAsleep",
-		"TimeInBed",
-		"LightSleepMinutes",
-		"LightSleepCount",
-		"DeepSleepMinutes",
-		"DeepSleepCount",
-		"RemSleepMinutes",
-		"RemSleepCount",
-		"WakeSleepMinutes",
-		"WakeSleepCount",
-		"SleepDuration",
-		"SleepEfficiency",
-		// ID and Date are not required
-		"ID",
-		"Date",
-	}
-
-	if instances, err = UserDataToPredictionInstance(userData, toSkip); err != nil {
-		return nil, err
+	// The potential labels are excluded during training, ID and Date are not required
+	toSkip := append([]string{"ID", "Date"}, sleepLabels...)
+	var features []string
+	var rows [][]float64
+	if predictor.Model != "" {
+		var spec featureSpec
+		if err = json.Unmarshal([]byte(predictor.Model), &spec); err != nil {
+			return nil, err
+		}
+		if rows, err = featureRowsWithHistory(user, &spec, userData); err != nil {
+			return nil, err
+		}
+		features = spec.Names()
 	}
-
-	// Get the predictor
-	var predictor types.Predictor
-	predictor.UserID = user.ID
-	predictor.Target = "SleepEfficiency"
-	if err = _db.Model(types.Predictor{}).Where(predictor).Scan(&predictor); err != nil {
+	if instances, err = UserDataToPredictionInstance(userData, toSkip, features, rows); err != nil {
 		return nil, err
 	}
 
@@ -373,14 +403,14 @@ func PredictSleepEfficiency(user *types.User, userData []*UserData) ([]uint8, er
 	}
 
 	// Get the argmax for every element of the batch
-	maxIndexes := make([]uint8, len(predictionsBatch))
+	maxIndexes := make([]float64, len(predictionsBatch))
 	for i := range predictionsBatch {
 		values := predictionsBatch[i].GetListValue().GetValues()
 		var max float64 = 0
 		for j, value := range values {
 			if value.GetNumberValue() > max {
 				max = value.GetNumberValue()
-				maxIndexes[i] = uint8(j)
+				maxIndexes[i] = float64(j)
 			}
 		}
 	}
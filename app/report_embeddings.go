@@ -0,0 +1,95 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/gommon/log"
+	"github.com/pgvector/pgvector-go"
+)
+
+// reembedBatchSize is the number of reports embedded again by every iteration of ReembedReports
+const reembedBatchSize = 100
+
+// similarReports returns the limit reports of the user about the days between startDate and endDate
+// most similar to query, embedded by model. The reports embedded by other models are ignored.
+// If reportTypes is not empty, only the reports of these types are considered.
+func similarReports(userID int64, model string, query pgvector.Vector, startDate, endDate time.Time, limit int, reportTypes ...string) (reports []types.Report, err error) {
+	// The dimension is part of the query text (and not a parameter), so that the planner
+	// can match the expression and the condition of the HNSW index of the dimension.
+	dim := len(query.Slice())
+	condition := fmt.Sprintf("user_id = ? AND embedding_model = ? AND embedding_dim = %d AND start_date <= ? AND end_date >= ?", dim)
+	args := []interface{}{userID, model, endDate, startDate}
+	if len(reportTypes) > 0 {
+		condition += " AND report_type IN (?" + strings.Repeat(", ?", len(reportTypes)-1) + ")"
+		for _, reportType := range reportTypes {
+			args = append(args, reportType)
+		}
+	}
+	args = append(args, query, limit)
+	if err = _db.Raw(fmt.Sprintf(
+		`SELECT id, user_id, start_date, end_date, report_type, report, embedding, embedding_model, embedding_dim
+		FROM reports WHERE %s ORDER BY embedding::vector(%d) <-> ?::vector(%d) LIMIT ?`,
+		condition, dim, dim), args...).Scan(&reports); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return reports, nil
+}
+
+// ReembedReports embeds again the reports whose embedding has not been generated by the
+// configured Embedder (e.g. after a change of EMBEDDING_PROVIDER), so that they can be found
+// by the similarity search. It's executed in background at startup, and it stops at the first error:
+// the remaining reports are embedded at the next startup.
+func ReembedReports(ctx context.Context) {
+	embedder, err := newEmbedder(ctx)
+	if err != nil {
+		log.Error("ReembedReports - newEmbedder: ", err)
+		return
+	}
+	defer embedder.Close()
+
+	model := embedder.Model()
+	var total int
+	start := time.Now()
+	for {
+		var reports []types.Report
+		if err = _db.Model(&types.Report{}).Where("embedding_model <> ? OR embedding IS NULL", model).
+			Order("id").Limit(reembedBatchSize).Scan(&reports); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Error("ReembedReports: ", err)
+			}
+			break
+		}
+
+		for _, report := range reports {
+			var embedding pgvector.Vector
+			if embedding, err = embedder.Embed(ctx, report.Report); err != nil {
+				log.Errorf("ReembedReports: embedding report %d: %s", report.ID, err)
+				return
+			}
+			dim := len(embedding.Slice())
+			if err = _db.Model(&types.Report{}).Exec(
+				"UPDATE reports SET embedding = ?, embedding_model = ?, embedding_dim = ? WHERE id = ?",
+				embedding, model, dim, report.ID); err != nil {
+				log.Errorf("ReembedReports: updating report %d: %s", report.ID, err)
+				return
+			}
+			total++
+		}
+	}
+	if total > 0 {
+		log.Printf("ReembedReports: %d reports embedded with %s in %s", total, model, time.Since(start))
+	}
+}
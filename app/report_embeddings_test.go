@@ -0,0 +1,67 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+func TestSimilarReports(t *testing.T) {
+	user := testDBUser(t)
+	day := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	// The reports of two models with the same dimension, and of a model with another dimension
+	for _, report := range []struct {
+		embedder *hashEmbedder
+		model    string
+		text     string
+	}{
+		{newHashEmbedder(768), "", "Last night the deep sleep lasted 90 minutes, and the sleep efficiency was 92%."},
+		{newHashEmbedder(768), "", "You walked 10234 steps and climbed 12 floors during the afternoon."},
+		{newHashEmbedder(768), "other", "Last night the deep sleep lasted 90 minutes."},
+		{newHashEmbedder(100), "", "Last night the deep sleep lasted 90 minutes."},
+	} {
+		embedding, err := report.embedder.Embed(context.Background(), report.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		model := report.model
+		if model == "" {
+			model = report.embedder.Model()
+		}
+		if err = _db.Create(&types.Report{UserID: user.ID, StartDate: day, EndDate: day, ReportType: reportTypeDaily,
+			Report: report.text, Embedding: embedding, EmbeddingModel: model, EmbeddingDim: int64(len(embedding.Slice()))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	embedder := newHashEmbedder(768)
+	query, err := embedder.Embed(context.Background(), "How was my deep sleep last night?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports, err := similarReports(user.ID, embedder.Model(), query, day, day, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the reports of the model, the most similar first
+	if len(reports) != 2 {
+		t.Fatalf("%d reports, want the 2 reports of %s", len(reports), embedder.Model())
+	}
+	if reports[0].Report != "Last night the deep sleep lasted 90 minutes, and the sleep efficiency was 92%." {
+		t.Errorf("the most similar report is %q, want the sleep report", reports[0].Report)
+	}
+
+	// The reports of other types, or of other days, are ignored
+	if reports, err = similarReports(user.ID, embedder.Model(), query, day, day, 5, reportTypeWeekly); err != nil || len(reports) != 0 {
+		t.Errorf("similarReports() of the weekly reports = %d reports, %v: want none", len(reports), err)
+	}
+	if reports, err = similarReports(user.ID, embedder.Model(), query, day.AddDate(0, 0, 1), day.AddDate(0, 0, 7), 5); err != nil || len(reports) != 0 {
+		t.Errorf("similarReports() of the next week = %d reports, %v: want none", len(reports), err)
+	}
+}
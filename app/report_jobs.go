@@ -0,0 +1,320 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// Status of the report jobs
+const (
+	reportJobPending = "pending"
+	reportJobRunning = "running"
+	reportJobDone    = "done"
+	reportJobFailed  = "failed"
+)
+
+const (
+	// reportJobBackoff is the delay before the first retry of a failed job. It doubles at every attempt.
+	reportJobBackoff = time.Minute
+	// reportJobMaxBackoff is the maximum delay between two attempts
+	reportJobMaxBackoff = 6 * time.Hour
+	// reportJobStale is the time after which a running job is considered abandoned
+	// (e.g. the process has been stopped), and it's claimed again
+	reportJobStale = 30 * time.Minute
+	// reportJobPoll is the interval between the checks of the queue, when it's empty
+	reportJobPoll = 10 * time.Second
+)
+
+// enqueueReportJobs queues the generation of the missing reports of the user between startDate
+// and endDate: a daily report for every day, and the weekly and monthly reports of the periods
+// already over. The jobs are unique per report, thus enqueueing again the same range is a no-op,
+// except for the failed jobs (and for the reports deleted) that are queued again.
+// The report of today is not generated: the data of the day is complete only when the day is over,
+// and a report is never generated again.
+func enqueueReportJobs(userID int64, startDate, endDate time.Time) error {
+	yesterday := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	if endDate.After(yesterday) {
+		endDate = yesterday
+	}
+	if endDate.Before(startDate) {
+		return nil
+	}
+
+	// The jobs already pending or running are left untouched
+	const onConflict = `ON CONFLICT (user_id, report_type, start_date) DO UPDATE
+		SET status = 'pending', attempts = 0, run_after = EXCLUDED.run_after, error = '', updated_at = EXCLUDED.updated_at
+		WHERE report_jobs.status IN ('done', 'failed')`
+	now := time.Now().UTC()
+	if err := _db.Model(types.ReportJob{}).Exec(
+		`INSERT INTO report_jobs(user_id, report_type, start_date, end_date, run_after, updated_at)
+		SELECT ?, ?, day::date, day::date, ?, ? FROM generate_series(?::date, ?::date, interval '1 day') AS day
+		WHERE NOT EXISTS (
+			SELECT 1 FROM reports WHERE user_id = ? AND report_type = ? AND start_date = day::date
+		) `+onConflict,
+		userID, reportTypeDaily, now, now, startDate, endDate, userID, reportTypeDaily); err != nil {
+		return err
+	}
+
+	for _, period := range completePeriods(startDate, endDate) {
+		if err := _db.Model(types.ReportJob{}).Exec(
+			`INSERT INTO report_jobs(user_id, report_type, start_date, end_date, run_after, updated_at)
+			SELECT ?, ?, ?, ?, ?, ?
+			WHERE NOT EXISTS (
+				SELECT 1 FROM reports WHERE user_id = ? AND report_type = ? AND start_date = ?
+			) `+onConflict,
+			userID, period.reportType, period.startDate, period.endDate, now, now,
+			userID, period.reportType, period.startDate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReportQueue generates in background the reports queued in the report_jobs table.
+// More instances of the application can share the same queue: the jobs are claimed
+// with SKIP LOCKED, thus every job is executed by a single worker.
+type ReportQueue struct {
+	clock       clock
+	concurrency int
+	maxAttempts int64
+}
+
+// NewReportQueue creates a ReportQueue configured using the REPORT_CONCURRENCY
+// and REPORT_MAX_ATTEMPTS environment variables.
+func NewReportQueue() *ReportQueue {
+	return &ReportQueue{
+		clock:       realClock{},
+		concurrency: _reportConcurrency,
+		maxAttempts: int64(_reportMaxAttempts),
+	}
+}
+
+// Run executes the queued jobs with concurrency workers, until ctx is done.
+func (q *ReportQueue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work executes a job after the other, waiting when the queue is empty.
+func (q *ReportQueue) work(ctx context.Context) {
+	for {
+		job, err := q.claim()
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Error("ReportQueue: ", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.clock.After(reportJobPoll):
+			}
+			continue
+		}
+		q.complete(job, q.execute(job))
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+// claim marks as running the next job to execute, and returns it.
+// The daily reports are generated first, since the weekly and monthly reports need them.
+func (q *ReportQueue) claim() (*types.ReportJob, error) {
+	now := q.clock.Now().UTC()
+	var job types.ReportJob
+	if err := _db.Raw(
+		`UPDATE report_jobs SET status = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id = (
+			SELECT id FROM report_jobs
+			WHERE (status = ? AND run_after <= ?) OR (status = ? AND updated_at < ?)
+			ORDER BY report_type <> ?, run_after
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		reportJobRunning, now,
+		reportJobPending, now, reportJobRunning, now.Add(-reportJobStale),
+		reportTypeDaily).Scan(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// errReportJobWaiting is returned by execute when the job can't be executed yet,
+// because of another job or of the dump of the user. It's not a failure.
+var errReportJobWaiting = errors.New("waiting")
+
+// execute generates the report of the job.
+func (q *ReportQueue) execute(job *types.ReportJob) error {
+	var exists bool
+	if err := _db.Raw(
+		"SELECT EXISTS(SELECT 1 FROM reports WHERE user_id = ? AND report_type = ? AND start_date = ?)",
+		job.UserID, job.ReportType, job.StartDate).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		// Generated by a previous attempt, completed but not marked as done
+		return nil
+	}
+
+	if job.ReportType != reportTypeDaily {
+		// The daily reports of the period must be generated first
+		var waiting bool
+		if err := _db.Raw(
+			`SELECT EXISTS(SELECT 1 FROM report_jobs WHERE user_id = ? AND report_type = ?
+			AND start_date BETWEEN ? AND ? AND status IN (?, ?))`,
+			job.UserID, reportTypeDaily, job.StartDate, job.EndDate, reportJobPending, reportJobRunning).Scan(&waiting); err != nil {
+			return err
+		}
+		if waiting {
+			return errReportJobWaiting
+		}
+	}
+
+	var user types.User
+	if err := _db.Model(types.User{}).Where("id = ?", job.UserID).Scan(&user); err != nil {
+		return err
+	}
+	fetcher, err := NewFetcher(&user)
+	if err != nil {
+		return err
+	}
+	var reporter *Reporter
+	if reporter, err = NewReporter(&user); err != nil {
+		return err
+	}
+	defer reporter.Close()
+
+	if job.ReportType != reportTypeDaily {
+		return generatePeriodReport(reporter, fetcher, reportPeriod{job.ReportType, job.StartDate, job.EndDate})
+	}
+
+	var data *UserData
+	if data, err = fetcher.FetchByDate(job.StartDate); err != nil {
+		var fetcherError *FetcherError
+		if errors.As(err, &fetcherError) {
+			// The user is dumping: the data of the day can be incomplete
+			return errReportJobWaiting
+		}
+		return err
+	}
+	var report *types.Report
+	if report, err = reporter.GenerateDailyReport(data); err != nil {
+		return err
+	}
+	return _db.Create(report)
+}
+
+// complete stores the outcome of the job. The failed jobs are scheduled again with an
+// exponential backoff, until the maximum number of attempts.
+func (q *ReportQueue) complete(job *types.ReportJob, err error) {
+	now := q.clock.Now().UTC()
+	var dbErr error
+	switch {
+	case err == nil:
+		dbErr = _db.Model(types.ReportJob{}).Exec(
+			"UPDATE report_jobs SET status = ?, error = '', updated_at = ? WHERE id = ?",
+			reportJobDone, now, job.ID)
+	case errors.Is(err, errReportJobWaiting):
+		// Not an attempt
+		dbErr = _db.Model(types.ReportJob{}).Exec(
+			"UPDATE report_jobs SET status = ?, attempts = attempts - 1, run_after = ?, updated_at = ? WHERE id = ?",
+			reportJobPending, now.Add(reportJobBackoff), now, job.ID)
+	case job.Attempts >= q.maxAttempts:
+		log.Errorf("ReportQueue: %s report of user %d from %s failed: %s", job.ReportType, job.UserID, job.StartDate.Format(time.DateOnly), err)
+		dbErr = _db.Model(types.ReportJob{}).Exec(
+			"UPDATE report_jobs SET status = ?, error = ?, updated_at = ? WHERE id = ?",
+			reportJobFailed, err.Error(), now, job.ID)
+	default:
+		dbErr = _db.Model(types.ReportJob{}).Exec(
+			"UPDATE report_jobs SET status = ?, error = ?, run_after = ?, updated_at = ? WHERE id = ?",
+			reportJobPending, err.Error(), now.Add(reportJobRetryDelay(job.Attempts)), now, job.ID)
+	}
+	if dbErr != nil {
+		log.Error("ReportQueue: ", dbErr)
+	}
+}
+
+// reportJobRetryDelay returns the delay before the next attempt of a job failed after the given
+// number of attempts: reportJobBackoff after the first one, doubled at every attempt, up to reportJobMaxBackoff.
+func reportJobRetryDelay(attempts int64) time.Duration {
+	backoff := reportJobBackoff << (attempts - 1)
+	if backoff > reportJobMaxBackoff || backoff <= 0 {
+		backoff = reportJobMaxBackoff
+	}
+	return backoff
+}
+
+// reportJobsStatus is the progress of the generation of the reports of a date range.
+type reportJobsStatus struct {
+	Pending int64 `json:"pending"`
+	Running int64 `json:"running"`
+	Done    int64 `json:"done"`
+	Failed  int64 `json:"failed"`
+	// Error is the last error of the failed jobs, if any
+	Error string `json:"error,omitempty"`
+}
+
+// ReportJobsStatus returns, as JSON, the status of the generation of the reports of the user
+// about the date range given by the start and end query parameters (YYYY-MM-DD).
+func ReportJobsStatus() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var user *types.User
+		if user, err = getUser(c); err != nil {
+			return err
+		}
+		var startDate, endDate time.Time
+		if startDate, err = time.Parse(time.DateOnly, c.QueryParam("start")); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid start date")
+		}
+		if endDate, err = time.Parse(time.DateOnly, c.QueryParam("end")); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid end date")
+		}
+
+		var jobs []types.ReportJob
+		if err = _db.Model(types.ReportJob{}).
+			Where("user_id = ? AND start_date BETWEEN ? AND ?", user.ID, startDate, endDate).
+			Order("updated_at").Scan(&jobs); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Error("ReportJobsStatus: ", err)
+			return err
+		}
+		var status reportJobsStatus
+		for _, job := range jobs {
+			switch job.Status {
+			case reportJobPending:
+				status.Pending++
+			case reportJobRunning:
+				status.Running++
+			case reportJobDone:
+				status.Done++
+			case reportJobFailed:
+				status.Failed++
+				status.Error = fmt.Sprintf("%s report of %s: %s", job.ReportType, job.StartDate.Format(time.DateOnly), job.Error)
+			}
+		}
+		return c.JSON(http.StatusOK, status)
+	}
+}
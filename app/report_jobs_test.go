@@ -0,0 +1,215 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+func TestReportJobRetryDelay(t *testing.T) {
+	for _, tt := range []struct {
+		attempts int64
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{5, 16 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, reportJobMaxBackoff},
+		{100, reportJobMaxBackoff},
+	} {
+		if got := reportJobRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("reportJobRetryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// userReportJobs returns the report jobs of the user, by type and first day.
+func userReportJobs(t *testing.T, user *types.User) map[string]types.ReportJob {
+	t.Helper()
+	var jobs []types.ReportJob
+	if err := _db.Model(types.ReportJob{}).Where("user_id = ?", user.ID).Scan(&jobs); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		t.Fatal(err)
+	}
+	byReport := make(map[string]types.ReportJob)
+	for _, job := range jobs {
+		byReport[job.ReportType+" "+job.StartDate.Format(time.DateOnly)] = job
+	}
+	return byReport
+}
+
+func TestEnqueueReportJobs(t *testing.T) {
+	user := testDBUser(t)
+	// From Monday to Sunday: the daily reports and the weekly report
+	monday := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	if err := enqueueReportJobs(user.ID, monday, monday.AddDate(0, 0, 6)); err != nil {
+		t.Fatal(err)
+	}
+	jobs := userReportJobs(t, user)
+	if len(jobs) != 8 {
+		t.Fatalf("%d jobs, want 7 daily jobs and a weekly job", len(jobs))
+	}
+	if job, ok := jobs["weekly 2024-03-04"]; !ok || !job.EndDate.Equal(monday.AddDate(0, 0, 6)) {
+		t.Errorf("weekly job %+v, want the week from 2024-03-04 to 2024-03-10", job)
+	}
+
+	// Enqueueing again is a no-op
+	if err := enqueueReportJobs(user.ID, monday, monday.AddDate(0, 0, 6)); err != nil {
+		t.Fatal(err)
+	}
+	for key, job := range userReportJobs(t, user) {
+		if job.ID != jobs[key].ID || job.Status != reportJobPending {
+			t.Errorf("%s job %+v after enqueueing again, want %+v", key, job, jobs[key])
+		}
+	}
+
+	// The failed jobs are queued again, the done jobs only if their report has been deleted
+	failed, done, generated := jobs["daily 2024-03-04"], jobs["daily 2024-03-05"], jobs["daily 2024-03-06"]
+	if err := _db.Exec("UPDATE report_jobs SET status = ?, attempts = 5, error = 'boom' WHERE id = ?", reportJobFailed, failed.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := _db.Exec("UPDATE report_jobs SET status = ? WHERE id IN (?, ?)", reportJobDone, done.ID, generated.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := _db.Create(&types.Report{UserID: user.ID, StartDate: generated.StartDate, EndDate: generated.EndDate,
+		ReportType: reportTypeDaily, Report: "report"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueueReportJobs(user.ID, monday, monday.AddDate(0, 0, 6)); err != nil {
+		t.Fatal(err)
+	}
+	jobs = userReportJobs(t, user)
+	if job := jobs["daily 2024-03-04"]; job.Status != reportJobPending || job.Attempts != 0 || job.Error != "" {
+		t.Errorf("failed job %+v after enqueueing again, want pending with no attempts", job)
+	}
+	if job := jobs["daily 2024-03-05"]; job.Status != reportJobPending {
+		t.Errorf("done job without report %+v after enqueueing again, want pending", job)
+	}
+	if job := jobs["daily 2024-03-06"]; job.Status != reportJobDone {
+		t.Errorf("done job with report %+v after enqueueing again, want done", job)
+	}
+
+	// The report of today is not generated until the day is over
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if err := enqueueReportJobs(user.ID, today.AddDate(0, 0, -1), today.AddDate(0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	jobs = userReportJobs(t, user)
+	if _, ok := jobs["daily "+today.Format(time.DateOnly)]; ok {
+		t.Error("the report of today has been enqueued")
+	}
+	if _, ok := jobs["daily "+today.AddDate(0, 0, -1).Format(time.DateOnly)]; !ok {
+		t.Error("the report of yesterday has not been enqueued")
+	}
+}
+
+// testReportQueue returns a queue whose clock is in 2000: it claims only the jobs created by
+// insertReportJob, with run_after in the same year.
+func testReportQueue() (*ReportQueue, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2000, time.January, 1, 12, 0, 0, 0, time.UTC)}
+	return &ReportQueue{clock: clock, concurrency: 1, maxAttempts: 3}, clock
+}
+
+// insertReportJob queues the report of the user, executable from runAfter.
+func insertReportJob(t *testing.T, user *types.User, reportType string, startDate time.Time, runAfter time.Time) {
+	t.Helper()
+	if err := _db.Exec(
+		"INSERT INTO report_jobs(user_id, report_type, start_date, end_date, run_after, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		user.ID, reportType, startDate, startDate, runAfter, runAfter); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReportQueueClaim(t *testing.T) {
+	user := testDBUser(t)
+	q, clock := testReportQueue()
+	now := clock.Now()
+	day := time.Date(1999, time.December, 6, 0, 0, 0, 0, time.UTC)
+	insertReportJob(t, user, reportTypeWeekly, day, now.Add(-2*time.Hour))
+	insertReportJob(t, user, reportTypeDaily, day.AddDate(0, 0, 1), now.Add(-time.Hour))
+	insertReportJob(t, user, reportTypeDaily, day, now.Add(-time.Minute))
+	insertReportJob(t, user, reportTypeDaily, day.AddDate(0, 0, 2), now.Add(time.Minute))
+
+	// The daily jobs first, the older first, then the weekly one. The jobs not executable yet are left.
+	for _, want := range []string{"daily 1999-12-07", "daily 1999-12-06", "weekly 1999-12-06"} {
+		job, err := q.claim()
+		if err != nil {
+			t.Fatalf("claim() = %v, want the %s job", err, want)
+		}
+		if got := job.ReportType + " " + job.StartDate.Format(time.DateOnly); got != want || job.Status != reportJobRunning || job.Attempts != 1 {
+			t.Errorf("claimed the %s job %+v, want the %s job running at its first attempt", got, job, want)
+		}
+	}
+	if job, err := q.claim(); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("claim() = %+v, %v: want no job", job, err)
+	}
+
+	// A running job abandoned by a stopped worker is claimed again
+	clock.Advance(reportJobStale + time.Minute)
+	job, err := q.claim()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !job.StartDate.Equal(day.AddDate(0, 0, 1)) || job.Attempts != 2 {
+		t.Errorf("claimed %+v, want the abandoned daily job of 1999-12-07 at its second attempt", job)
+	}
+}
+
+func TestReportQueueComplete(t *testing.T) {
+	user := testDBUser(t)
+	q, clock := testReportQueue()
+	day := time.Date(1999, time.December, 6, 0, 0, 0, 0, time.UTC)
+	insertReportJob(t, user, reportTypeDaily, day, clock.Now())
+
+	claim := func() *types.ReportJob {
+		t.Helper()
+		job, err := q.claim()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	// Waiting for the dump of the user is not an attempt
+	q.complete(claim(), errReportJobWaiting)
+	if job := userReportJobs(t, user)["daily 1999-12-06"]; job.Status != reportJobPending || job.Attempts != 0 ||
+		!job.RunAfter.Equal(clock.Now().Add(reportJobBackoff)) {
+		t.Errorf("waiting job %+v, want pending after %s with no attempts", job, reportJobBackoff)
+	}
+
+	// The failures are retried with a backoff, until the maximum number of attempts
+	for attempt := int64(1); attempt <= q.maxAttempts; attempt++ {
+		if job, err := q.claim(); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("claim() = %+v, %v during the backoff: want no job", job, err)
+		}
+		clock.Advance(reportJobRetryDelay(attempt))
+		job := claim()
+		if job.Attempts != attempt {
+			t.Fatalf("attempt %d, want %d", job.Attempts, attempt)
+		}
+		q.complete(job, errors.New("boom"))
+	}
+	if job := userReportJobs(t, user)["daily 1999-12-06"]; job.Status != reportJobFailed || job.Error != "boom" {
+		t.Errorf("job %+v after %d failures, want failed with the last error", job, q.maxAttempts)
+	}
+	clock.Advance(reportJobMaxBackoff)
+	if job, err := q.claim(); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("claim() = %+v, %v: the failed job has been claimed again", job, err)
+	}
+
+	// A success clears the error of the previous attempts
+	if err := _db.Exec("UPDATE report_jobs SET status = ?, attempts = 0, run_after = ? WHERE user_id = ?",
+		reportJobPending, clock.Now(), user.ID); err != nil {
+		t.Fatal(err)
+	}
+	q.complete(claim(), nil)
+	if job := userReportJobs(t, user)["daily 1999-12-06"]; job.Status != reportJobDone || job.Error != "" {
+		t.Errorf("job %+v after a success, want done without error", job)
+	}
+}
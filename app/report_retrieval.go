@@ -0,0 +1,273 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/pgvector/pgvector-go"
+)
+
+// dateRange is a period mentioned in a question, from start to end (included).
+type dateRange struct {
+	start, end time.Time
+}
+
+const monthNames = `jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?`
+
+const weekdayNames = `monday|tuesday|wednesday|thursday|friday|saturday|sunday`
+
+var (
+	isoDateMention  = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+	monthDayMention = regexp.MustCompile(`(?i)\b(` + monthNames + `)\.?\s+(\d{1,2})(?:st|nd|rd|th)?\b(?:,?\s+(\d{4})\b)?`)
+	dayMonthMention = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th)?\s+(?:of\s+)?(` + monthNames + `)\b(?:,?\s+(\d{4})\b)?`)
+	// A month alone is "in March", "of May 2024" or "March 2024": "may" is too common otherwise
+	monthMention     = regexp.MustCompile(`(?i)\b(?:(?:in|of|during)\s+(` + monthNames + `)\b(?:\s+(\d{4})\b)?|(` + monthNames + `)\s+(\d{4})\b)`)
+	weekOfMention    = regexp.MustCompile(`(?i)\bweek\s+of\s+(?:the\s+)?$`)
+	weekdayMention   = regexp.MustCompile(`(?i)\b(last\s+|on\s+)?(` + weekdayNames + `)\b`)
+	daysAgoMention   = regexp.MustCompile(`(?i)\b(\d{1,3})\s+days?\s+ago\b`)
+	lastDaysMention  = regexp.MustCompile(`(?i)\b(?:last|past|previous)\s+(\d{1,3})\s+days\b`)
+	relativeMention  = regexp.MustCompile(`(?i)\b(today|tonight|yesterday|last\s+night|(?:this|last|previous|past)\s+(?:week|month))\b`)
+	monthsByPrefixes = map[string]time.Month{
+		"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+		"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+		"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+	}
+)
+
+// monthByName returns the month whose name (or abbreviation) is name.
+func monthByName(name string) time.Month {
+	return monthsByPrefixes[strings.ToLower(name)[:3]]
+}
+
+// weekOf returns the week (from Monday to Sunday) containing day.
+func weekOf(day time.Time) dateRange {
+	monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	return dateRange{monday, monday.AddDate(0, 0, 6)}
+}
+
+// monthOf returns the month containing day.
+func monthOf(day time.Time) dateRange {
+	first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return dateRange{first, first.AddDate(0, 1, -1)}
+}
+
+// dateMentions returns the periods mentioned in the question, in the order they appear.
+// It understands the dates (2024-03-05, March 5, 5th of March 2024), the months (in March,
+// March 2024), the weeks of a date (the week of March 3), the weekdays (last Tuesday) and
+// the relative expressions (yesterday, 3 days ago, last week, this month). The dates without
+// the year are the last ones before today.
+func dateMentions(question string, today time.Time) []dateRange {
+	today = today.UTC().Truncate(24 * time.Hour)
+
+	type mention struct {
+		position int
+		dateRange
+	}
+	var mentions []mention
+	// The parts of the question already parsed, so that "March 5" is not also "in March"
+	used := make([]bool, len(question))
+	add := func(start, end int, period dateRange) {
+		for i := start; i < end; i++ {
+			if used[i] {
+				return
+			}
+		}
+		for i := start; i < end; i++ {
+			used[i] = true
+		}
+		// "the week of March 3" is the whole week
+		if weekOfMention.MatchString(question[:start]) && period.start.Equal(period.end) {
+			period = weekOf(period.start)
+		}
+		mentions = append(mentions, mention{start, period})
+	}
+	// date builds the date from the parsed parts. Without the year, it's the last one before today.
+	date := func(year string, month time.Month, day string) (time.Time, bool) {
+		d, err := strconv.Atoi(day)
+		if err != nil || d < 1 || d > 31 {
+			return time.Time{}, false
+		}
+		if year == "" {
+			parsed := time.Date(today.Year(), month, d, 0, 0, 0, 0, time.UTC)
+			if parsed.After(today) {
+				parsed = parsed.AddDate(-1, 0, 0)
+			}
+			return parsed, parsed.Day() == d
+		}
+		y, _ := strconv.Atoi(year)
+		parsed := time.Date(y, month, d, 0, 0, 0, 0, time.UTC)
+		return parsed, parsed.Day() == d
+	}
+
+	for _, match := range isoDateMention.FindAllStringSubmatchIndex(question, -1) {
+		if day, err := time.Parse(time.DateOnly, question[match[0]:match[1]]); err == nil {
+			add(match[0], match[1], dateRange{day, day})
+		}
+	}
+	for _, match := range monthDayMention.FindAllStringSubmatchIndex(question, -1) {
+		year := ""
+		if match[6] >= 0 {
+			year = question[match[6]:match[7]]
+		}
+		if day, ok := date(year, monthByName(question[match[2]:match[3]]), question[match[4]:match[5]]); ok {
+			add(match[0], match[1], dateRange{day, day})
+		}
+	}
+	for _, match := range dayMonthMention.FindAllStringSubmatchIndex(question, -1) {
+		year := ""
+		if match[6] >= 0 {
+			year = question[match[6]:match[7]]
+		}
+		if day, ok := date(year, monthByName(question[match[4]:match[5]]), question[match[2]:match[3]]); ok {
+			add(match[0], match[1], dateRange{day, day})
+		}
+	}
+	for _, match := range monthMention.FindAllStringSubmatchIndex(question, -1) {
+		name, year := match[2:4], match[4:6]
+		if name[0] < 0 {
+			name, year = match[6:8], match[8:10]
+		}
+		yearString := ""
+		if year[0] >= 0 {
+			yearString = question[year[0]:year[1]]
+		}
+		if first, ok := date(yearString, monthByName(question[name[0]:name[1]]), "1"); ok {
+			add(match[0], match[1], monthOf(first))
+		}
+	}
+	for _, match := range weekdayMention.FindAllStringSubmatchIndex(question, -1) {
+		var weekday time.Weekday
+		for weekday = time.Sunday; weekday <= time.Saturday; weekday++ {
+			if strings.EqualFold(weekday.String(), question[match[4]:match[5]]) {
+				break
+			}
+		}
+		// The last one, not after today. "last Tuesday" is never today.
+		back := (int(today.Weekday()) - int(weekday) + 7) % 7
+		if back == 0 && match[2] >= 0 && strings.HasPrefix(strings.ToLower(question[match[2]:match[3]]), "last") {
+			back = 7
+		}
+		day := today.AddDate(0, 0, -back)
+		add(match[0], match[1], dateRange{day, day})
+	}
+	for _, match := range daysAgoMention.FindAllStringSubmatchIndex(question, -1) {
+		days, _ := strconv.Atoi(question[match[2]:match[3]])
+		day := today.AddDate(0, 0, -days)
+		add(match[0], match[1], dateRange{day, day})
+	}
+	for _, match := range lastDaysMention.FindAllStringSubmatchIndex(question, -1) {
+		days, _ := strconv.Atoi(question[match[2]:match[3]])
+		if days > 0 {
+			add(match[0], match[1], dateRange{today.AddDate(0, 0, -days+1), today})
+		}
+	}
+	for _, match := range relativeMention.FindAllStringIndex(question, -1) {
+		expression := strings.Join(strings.Fields(strings.ToLower(question[match[0]:match[1]])), " ")
+		var period dateRange
+		switch expression {
+		case "today", "tonight":
+			period = dateRange{today, today}
+		case "yesterday":
+			yesterday := today.AddDate(0, 0, -1)
+			period = dateRange{yesterday, yesterday}
+		case "last night":
+			// The sleep of the night is stored in the day of the wake up
+			period = dateRange{today.AddDate(0, 0, -1), today}
+		case "this week":
+			period = dateRange{weekOf(today).start, today}
+		case "last week", "previous week", "past week":
+			period = weekOf(today.AddDate(0, 0, -7))
+		case "this month":
+			period = dateRange{monthOf(today).start, today}
+		case "last month", "previous month", "past month":
+			period = monthOf(monthOf(today).start.AddDate(0, 0, -1))
+		}
+		add(match[0], match[1], period)
+	}
+
+	sort.SliceStable(mentions, func(i, j int) bool {
+		return mentions[i].position < mentions[j].position
+	})
+	periods := make([]dateRange, 0, len(mentions))
+	for _, mention := range mentions {
+		periods = append(periods, mention.dateRange)
+	}
+	return periods
+}
+
+// reportsOfPeriod returns at most limit reports of the user about the period. The report
+// of exactly the period comes first, followed by the reports of the periods it contains (from
+// the longest), and then by the reports of the periods containing it (from the shortest).
+// E.g. for a week: the weekly report, the daily reports of its days, and the monthly report.
+func reportsOfPeriod(userID int64, period dateRange, limit int) (reports []types.Report, err error) {
+	if err = _db.Raw(
+		`SELECT * FROM reports
+		WHERE user_id = ? AND ((start_date >= ? AND end_date <= ?) OR (start_date <= ? AND end_date >= ?))
+		ORDER BY (start_date = ? AND end_date = ?) DESC,
+			(start_date >= ? AND end_date <= ?) DESC,
+			CASE WHEN start_date >= ? AND end_date <= ? THEN start_date - end_date ELSE end_date - start_date END,
+			start_date
+		LIMIT ?`,
+		userID, period.start, period.end, period.start, period.end,
+		period.start, period.end,
+		period.start, period.end,
+		period.start, period.end,
+		limit).Scan(&reports); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return reports, nil
+}
+
+// RetrieveReports returns at most limit reports of the user, to answer the question about the data
+// between startDate and endDate. The reports of the periods mentioned in the question (e.g. "last
+// Tuesday", "the week of March 3") are looked up by date and come first, in the order of the mentions.
+// The remaining reports are the ones of the range most similar to the question.
+func (r *Reporter) RetrieveReports(question string, startDate, endDate time.Time, limit int) ([]types.Report, error) {
+	var reports []types.Report
+	seen := make(map[int64]bool)
+	appendReports := func(found []types.Report) {
+		for _, report := range found {
+			if len(reports) < limit && !seen[report.ID] {
+				seen[report.ID] = true
+				reports = append(reports, report)
+			}
+		}
+	}
+
+	for _, period := range dateMentions(question, time.Now()) {
+		found, err := reportsOfPeriod(r.user.ID, period, limit)
+		if err != nil {
+			return nil, err
+		}
+		appendReports(found)
+	}
+	if len(reports) == limit {
+		return reports, nil
+	}
+
+	var query pgvector.Vector
+	var err error
+	if query, err = r.GenerateEmbeddings(question); err != nil {
+		return nil, err
+	}
+	// The reports already found can be among the similar ones
+	var similar []types.Report
+	if similar, err = r.SimilarReports(query, startDate, endDate, limit, reportTypesFor(question)...); err != nil {
+		return nil, err
+	}
+	appendReports(similar)
+	return reports, nil
+}
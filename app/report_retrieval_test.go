@@ -0,0 +1,66 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func (r dateRange) String() string {
+	return fmt.Sprintf("%s/%s", r.start.Format(time.DateOnly), r.end.Format(time.DateOnly))
+}
+
+func TestDateMentions(t *testing.T) {
+	// Wednesday, March 13 2024: the time of the day is ignored
+	today := time.Date(2024, time.March, 13, 10, 30, 0, 0, time.UTC)
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC) }
+	single := func(month time.Month, d int) dateRange { return dateRange{day(month, d), day(month, d)} }
+
+	for _, tc := range []struct {
+		question string
+		want     []dateRange
+	}{
+		{"How did I sleep on 2024-03-05?", []dateRange{single(time.March, 5)}},
+		{"How did I sleep on March 5?", []dateRange{single(time.March, 5)}},
+		{"And on Mar. 5th, 2023?", []dateRange{{day(time.March, 5).AddDate(-1, 0, 0), day(time.March, 5).AddDate(-1, 0, 0)}}},
+		{"What about the 5th of March?", []dateRange{single(time.March, 5)}},
+		// Without the year, the last one before today
+		{"What did I do on December 25?", []dateRange{{time.Date(2023, time.December, 25, 0, 0, 0, 0, time.UTC), time.Date(2023, time.December, 25, 0, 0, 0, 0, time.UTC)}}},
+		{"Did I sleep well on February 30?", []dateRange{}},
+		{"How was my sleep in March?", []dateRange{{day(time.March, 1), day(time.March, 31)}}},
+		{"How was my sleep in May?", []dateRange{{time.Date(2023, time.May, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, time.May, 31, 0, 0, 0, 0, time.UTC)}}},
+		{"My steps of March 2024", []dateRange{{day(time.March, 1), day(time.March, 31)}}},
+		// "may" alone is not a month
+		{"May I see my steps?", []dateRange{}},
+		// The date is not also the month
+		{"What happened in March 5th?", []dateRange{single(time.March, 5)}},
+		{"How was the week of March 6?", []dateRange{{day(time.March, 4), day(time.March, 10)}}},
+		{"How did I sleep last Tuesday?", []dateRange{single(time.March, 12)}},
+		{"How did I sleep last Wednesday?", []dateRange{single(time.March, 6)}},
+		{"How am I doing on Wednesday?", []dateRange{single(time.March, 13)}},
+		{"And 3 days ago?", []dateRange{single(time.March, 10)}},
+		{"In the last 7 days", []dateRange{{day(time.March, 7), day(time.March, 13)}}},
+		{"How many steps today?", []dateRange{single(time.March, 13)}},
+		{"How did I sleep yesterday?", []dateRange{single(time.March, 12)}},
+		// The sleep of the night is stored in the day of the wake up
+		{"How did I sleep last  night?", []dateRange{{day(time.March, 12), day(time.March, 13)}}},
+		{"This week", []dateRange{{day(time.March, 11), day(time.March, 13)}}},
+		{"Last week", []dateRange{{day(time.March, 4), day(time.March, 10)}}},
+		{"This month", []dateRange{{day(time.March, 1), day(time.March, 13)}}},
+		{"Previous month", []dateRange{{day(time.February, 1), day(time.February, 29)}}},
+		// In the order of the question
+		{"Compare yesterday with 2024-03-01", []dateRange{single(time.March, 12), single(time.March, 1)}},
+		{"How are you?", []dateRange{}},
+	} {
+		t.Run(tc.question, func(t *testing.T) {
+			got := dateMentions(tc.question, today)
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("dateMentions(%q) = %v, want %v", tc.question, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	//go:embed templates/daily_report.md.tmpl
+	dailyReportTemplateText string
+	// dailyReportTemplate renders the daily reports from the UserData, without the LLM
+	dailyReportTemplate = template.Must(template.New("daily_report").Funcs(template.FuncMap{
+		"date": func(t time.Time) string {
+			return t.Format(time.DateOnly)
+		},
+		"clock": func(t time.Time) string {
+			return t.Format("15:04")
+		},
+		// minutes converts the milliseconds of the Fitbit durations to minutes
+		"minutes": func(ms int64) int64 {
+			return int64(math.Round(float64(ms) * msToMin))
+		},
+		"hm": func(minutes int64) string {
+			return fmt.Sprintf("%dh %02dm", minutes/60, minutes%60)
+		},
+		"round0": func(value float64) string {
+			return strconv.FormatFloat(value, 'f', 0, 64)
+		},
+		"round2": func(value float64) string {
+			return strconv.FormatFloat(value, 'f', 2, 64)
+		},
+	}).Parse(dailyReportTemplateText))
+)
+
+// dailyReportData is the data of the daily report template.
+type dailyReportData struct {
+	Data *UserData
+	// Summary is the narrative section, written by the LLM. It can be empty.
+	Summary string
+}
+
+// renderDailyReport renders the daily report of data. All the values are taken from data:
+// the same data always renders the same report.
+func renderDailyReport(data *UserData, summary string) (string, error) {
+	var builder strings.Builder
+	if err := dailyReportTemplate.Execute(&builder, dailyReportData{Data: data, Summary: strings.TrimSpace(summary)}); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
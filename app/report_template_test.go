@@ -0,0 +1,162 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+// updateGolden rewrites the golden files with the output of the tests: go test ./app -run Golden -update
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// checkGolden compares got with the content of the golden file testdata/name.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("the output differs from %s (run with -update to rewrite it):\n%s", path, got)
+	}
+}
+
+var reportDate = time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+
+// fullReportDay returns a day with every data tracked, and a main sleep with the stages.
+func fullReportDay() *UserData {
+	day := &UserData{
+		Date:                 reportDate,
+		Steps:                &types.StepsSeries{Value: 10234},
+		Calories:             &types.CaloriesSeries{Value: 2512.4},
+		ActivityCalories:     &types.ActivityCaloriesSeries{Value: 812},
+		Distance:             &types.DistanceSeries{Value: 7.456},
+		Floors:               &types.FloorsSeries{Value: 12},
+		MinutesLightlyActive: &types.MinutesLightlyActiveSeries{Value: 201},
+		MinutesFairlyActive:  &types.MinutesFairlyActiveSeries{Value: 25},
+		MinutesVeryActive:    &types.MinutesVeryActiveSeries{Value: 42},
+		MinutesSedentary:     &types.MinutesSedentarySeries{Value: 640},
+		BodyWeight:           &types.BodyWeightSeries{Value: 72.35},
+		BMI:                  &types.BMISeries{Value: 22.81},
+		BodyFat:              &types.BodyFatSeries{Value: 18.5},
+		HeartRateVariability: &types.HeartRateVariabilityTimeSeries{DailyRmssd: 41.234, DeepRmssd: 48.5},
+		CardioFitnessScore:   &types.CardioFitnessScore{Vo2MaxLowerBound: 44, Vo2MaxUpperBound: 48},
+		SkinTemperature:      &types.SkinTemperature{Value: -0.3},
+		OxygenSaturation:     &types.OxygenSaturation{Avg: 95.5, Min: 93, Max: 98},
+		BreathingRate:        &types.BreathingRate{BreathingRate: 14.8},
+	}
+	day.HeartRate = &types.HeartRateActivities{RestingHeartRate: sql.NullInt64{Int64: 58, Valid: true}}
+	for _, zone := range []struct {
+		name        string
+		min, max    int64
+		minutes     int64
+		caloriesOut float64
+	}{
+		{"Out of Range", 30, 115, 1300, 1700.2},
+		{"Fat Burn", 115, 141, 95, 560.7},
+		{"Cardio", 141, 172, 40, 250.1},
+		{"Peak", 172, 220, 5, 40},
+	} {
+		heartRateZone := types.HeartRateZone{}
+		heartRateZone.Name, heartRateZone.Min, heartRateZone.Max = zone.name, zone.min, zone.max
+		heartRateZone.Minutes, heartRateZone.CaloriesOut = zone.minutes, zone.caloriesOut
+		day.HeartRate.HeartRateZones = append(day.HeartRate.HeartRateZones, heartRateZone)
+	}
+
+	run := types.ActivityLog{StartTime: reportDate.Add(18*time.Hour + 30*time.Minute)}
+	run.ActivityName = "Run"
+	run.ActiveDuration = (35 * time.Minute).Milliseconds()
+	run.Calories = 410
+	run.Distance = 6.12
+	run.Steps = 6800
+	run.AverageHeartRate = 152
+	weights := types.ActivityLog{StartTime: reportDate.Add(7 * time.Hour)}
+	weights.ActivityName = "Weights"
+	weights.ActiveDuration = (45 * time.Minute).Milliseconds()
+	weights.Calories = 220
+	day.Activities = &DailyActivities{weights, run}
+
+	sleep := &types.SleepLog{
+		StartTime: reportDate.Add(-time.Hour - 15*time.Minute),
+		EndTime:   reportDate.Add(6*time.Hour + 45*time.Minute),
+	}
+	sleep.IsMainSleep = true
+	sleep.Type = "stages"
+	sleep.Duration = (8 * time.Hour).Milliseconds()
+	sleep.MinutesAsleep = 430
+	sleep.Efficiency = 92
+	sleep.MinutesToFallAsleep = 8
+	sleep.Levels.Summary.Deep.Minutes = 85
+	sleep.Levels.Summary.Light.Minutes = 230
+	sleep.Levels.Summary.Rem.Minutes = 115
+	sleep.Levels.Summary.Wake.Minutes = 50
+	sleep.Levels.Summary.Wake.Count = 21
+	day.SleepLog = sleep
+	day.SleepLogs = []*types.SleepLog{sleep}
+	return day
+}
+
+// napsReportDay returns a day with a main sleep without the stages, and two naps.
+func napsReportDay() *UserData {
+	sleep := &types.SleepLog{
+		StartTime: reportDate.Add(-30 * time.Minute),
+		EndTime:   reportDate.Add(5 * time.Hour),
+	}
+	sleep.IsMainSleep = true
+	sleep.Type = "classic"
+	sleep.Duration = (5*time.Hour + 30*time.Minute).Milliseconds()
+	sleep.MinutesAsleep = 301
+	sleep.Efficiency = 88
+	sleep.MinutesToFallAsleep = 12
+	day := &UserData{Date: reportDate, Steps: &types.StepsSeries{Value: 4521}, SleepLog: sleep, SleepLogs: []*types.SleepLog{sleep}}
+	for _, start := range []time.Duration{13*time.Hour + 10*time.Minute, 17 * time.Hour} {
+		nap := &types.SleepLog{StartTime: reportDate.Add(start), EndTime: reportDate.Add(start + 40*time.Minute)}
+		nap.Type = "classic"
+		nap.MinutesAsleep = 35
+		day.SleepLogs = append(day.SleepLogs, nap)
+	}
+	return day
+}
+
+func TestRenderDailyReportGolden(t *testing.T) {
+	// The heart rate series without the zones and without the resting heart rate
+	withoutZones := &UserData{Date: reportDate, HeartRate: &types.HeartRateActivities{}}
+
+	for _, tc := range []struct {
+		golden  string
+		data    *UserData
+		summary string
+	}{
+		{"daily_report_full.md", fullReportDay(), "  A balanced day, with a run in the evening and a restful night.\n"},
+		{"daily_report_empty.md", &UserData{Date: reportDate}, ""},
+		{"daily_report_naps.md", napsReportDay(), ""},
+		{"daily_report_heart_rate_without_zones.md", withoutZones, ""},
+	} {
+		t.Run(tc.golden, func(t *testing.T) {
+			report, err := renderDailyReport(tc.data, tc.summary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tc.golden, report)
+			// The same data always renders the same report
+			if again, _ := renderDailyReport(tc.data, tc.summary); again != report {
+				t.Error("the report of the same data changed")
+			}
+		})
+	}
+}
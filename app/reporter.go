@@ -3,157 +3,139 @@ package app
 import (
 	"context"
 	_ "embed"
-	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
-	vai "cloud.google.com/go/aiplatform/apiv1beta1"
-	vaipb "cloud.google.com/go/aiplatform/apiv1beta1/aiplatformpb"
-	"cloud.google.com/go/vertexai/genai"
 	"github.com/galeone/fitsleepinsights/database/types"
 	"github.com/pgvector/pgvector-go"
-	"google.golang.org/api/option"
-	"google.golang.org/protobuf/types/known/structpb"
 )
 
 var (
-	//go:embed templates/daily_report.md
-	dailyReportTemplate string
+	//go:embed templates/weekly_report.md
+	weeklyReportTemplate string
+	//go:embed templates/monthly_report.md
+	monthlyReportTemplate string
+)
+
+// Types of the reports
+const (
+	reportTypeDaily   = "daily"
+	reportTypeWeekly  = "weekly"
+	reportTypeMonthly = "monthly"
 )
 
 type Reporter struct {
-	user             *types.User
-	predictionClient *vai.PredictionClient
-	genaiClient      *genai.Client
-	ctx              context.Context
+	user     *types.User
+	llm      LLMProvider
+	embedder Embedder
+	ctx      context.Context
 }
 
-// NewReporter creates a new Reporter
+// NewReporter creates a new Reporter, that uses the configured LLMProvider and Embedder
 func NewReporter(user *types.User) (*Reporter, error) {
 	ctx := context.Background()
 
-	var predictionClient *vai.PredictionClient
-	var err error
-	if predictionClient, err = vai.NewPredictionClient(ctx, option.WithEndpoint(_vaiEndpoint)); err != nil {
+	llm, err := newLLMProvider(ctx)
+	if err != nil {
 		return nil, err
 	}
-
-	var genaiClient *genai.Client
-	const region = "us-central1"
-	if genaiClient, err = genai.NewClient(ctx, _vaiProjectID, region, option.WithCredentialsFile(_vaiServiceAccountKey)); err != nil {
+	var embedder Embedder
+	if embedder, err = newEmbedder(ctx); err != nil {
+		llm.Close()
 		return nil, err
 	}
-
-	return &Reporter{user: user, predictionClient: predictionClient, genaiClient: genaiClient, ctx: ctx}, nil
+	return &Reporter{user: user, llm: llm, embedder: embedder, ctx: ctx}, nil
 }
 
-// Close closes the client
+// Close closes the clients
 func (r *Reporter) Close() {
-	r.predictionClient.Close()
-	r.genaiClient.Close()
+	r.llm.Close()
+	r.embedder.Close()
 }
 
-// GenerateEmbeddings uses VertexAI to generate embeddings for a given prompt
+// GenerateEmbeddings uses the Embedder to generate embeddings for a given prompt
 func (r *Reporter) GenerateEmbeddings(prompt string) (embeddings pgvector.Vector, err error) {
-	// Instances: the prompt
-	var promptValue *structpb.Value
-	if promptValue, err = structpb.NewValue(map[string]interface{}{"content": prompt}); err != nil {
-		return
-	}
-
-	// PredictRequest: create the model prediction request
-	// autoTruncate: false
-	// https://cloud.google.com/vertex-ai/generative-ai/docs/embeddings/get-text-embeddings#generative-ai-get-text-embedding-go
-	var autoTruncate *structpb.Value
-	if autoTruncate, err = structpb.NewValue(map[string]interface{}{"autoTruncate": false}); err != nil {
-		return
-	}
-
-	req := &vaipb.PredictRequest{
-		Endpoint:   _vaiEmbeddingsEndpoint,
-		Instances:  []*structpb.Value{promptValue},
-		Parameters: autoTruncate,
-	}
-
-	// PredictResponse: receive the response from the model
-	var resp *vaipb.PredictResponse
-	if resp, err = r.predictionClient.Predict(r.ctx, req); err != nil {
-		return
-	}
+	return r.embedder.Embed(r.ctx, prompt)
+}
 
-	// Extract the embeddings from the response
-	mapResponse, ok := resp.Predictions[0].GetStructValue().AsMap()["embeddings"].(map[string]interface{})
-	if !ok {
-		err = fmt.Errorf("error extracting embeddings")
-		return
-	}
-	values, ok := mapResponse["values"].([]interface{})
-	if !ok {
-		err = fmt.Errorf("error extracting embeddings")
-		return
-	}
-	rawEmbeddings := make([]float32, len(values))
-	for i, v := range values {
-		rawEmbeddings[i] = float32(v.(float64))
+// SimilarReports returns the limit reports of the user about the days between startDate and endDate
+// most similar to the embeddings of query. The reports of reportTypes are preferred: if there are none,
+// the reports of every type are returned.
+func (r *Reporter) SimilarReports(query pgvector.Vector, startDate, endDate time.Time, limit int, reportTypes ...string) ([]types.Report, error) {
+	reports, err := similarReports(r.user.ID, r.embedder.Model(), query, startDate, endDate, limit, reportTypes...)
+	if err != nil || len(reports) > 0 || len(reportTypes) == 0 {
+		return reports, err
 	}
-	// dim: 768
-	embeddings = pgvector.NewVector(rawEmbeddings)
-	return
+	return similarReports(r.user.ID, r.embedder.Model(), query, startDate, endDate, limit)
 }
 
-// GenerateDailyReport generates a daily report for the given user
-func (r *Reporter) GenerateDailyReport(data *UserData) (report *types.Report, err error) {
-	gemini := r.genaiClient.GenerativeModel("gemini-2.0-flash")
-	temperature := ChatTemperature
-	gemini.Temperature = &temperature
-
+// fillTemplate asks the LLM to fill the markdown template with the data, sent in the next messages.
+func (r *Reporter) fillTemplate(template, dataDescription string, data string) (string, error) {
 	var builder strings.Builder
 	fmt.Fprintln(&builder, "This is a markdown template you have to fill with the data I will provide you in the next message.")
-	fmt.Fprintf(&builder, "```\n%s```\n\n", dailyReportTemplate)
+	fmt.Fprintf(&builder, "```\n%s```\n\n", template)
 	fmt.Fprintln(&builder, "You can find the sections to fill highlighted with \"[LLM to ...]\" with instructions on how to fill the section.")
-	fmt.Fprintln(&builder, "I will send you the data in JSON format in the next message.")
+	fmt.Fprintf(&builder, "I will send you %s in the next message.\n", dataDescription)
 	introductionString := builder.String()
 
-	chatSession := gemini.StartChat()
-	chatSession.History = []*genai.Content{
-		{
-			Parts: []genai.Part{
-				genai.Text(introductionString),
-			},
-			Role: "user",
-		},
-		{
-			Parts: []genai.Part{
-				genai.Text("Send me the data in JSON format. I will fill the template you provided using this data"),
-			},
-			Role: "model",
-		},
+	conversation := []LLMMessage{
+		{Role: llmRoleUser, Text: introductionString},
+		{Role: llmRoleModel, Text: fmt.Sprintf("Send me %s. I will fill the template you provided using this data", dataDescription)},
+		{Role: llmRoleUser, Text: data},
 	}
+	return r.llm.Generate(r.ctx, conversation, ChatTemperature)
+}
 
-	var jsonData []byte
-	if jsonData, err = json.Marshal(data); err != nil {
-		return nil, err
+// newReport returns the report of the user, with its embeddings.
+func (r *Reporter) newReport(reportType string, startDate, endDate time.Time, text string) (report *types.Report, err error) {
+	report = &types.Report{
+		StartDate:  startDate,
+		EndDate:    endDate,
+		ReportType: reportType,
+		UserID:     r.user.ID,
+		Report:     text + "\n",
 	}
 
-	var response *genai.GenerateContentResponse
-	if response, err = chatSession.SendMessage(r.ctx, genai.Text(string(jsonData))); err != nil {
+	if report.Embedding, err = r.GenerateEmbeddings(report.Report); err != nil {
 		return nil, err
 	}
-	report = &types.Report{
-		StartDate:  data.Date,
-		EndDate:    data.Date,
-		ReportType: "daily",
-		UserID:     r.user.ID,
-	}
-	for _, candidates := range response.Candidates {
-		for _, part := range candidates.Content.Parts {
-			report.Report += fmt.Sprintf("%s\n", part)
+	report.EmbeddingModel = r.embedder.Model()
+	report.EmbeddingDim = int64(len(report.Embedding.Slice()))
+
+	return report, nil
+}
+
+// GenerateDailyReport generates a daily report for the given user.
+// The report is rendered from the data: only the summary is written by the LLM,
+// if DAILY_REPORT_SUMMARY is enabled.
+func (r *Reporter) GenerateDailyReport(data *UserData) (report *types.Report, err error) {
+	var summary string
+	if _dailyReportSummary {
+		var facts string
+		if facts, err = renderDailyReport(data, ""); err != nil {
+			return nil, err
+		}
+		if summary, err = r.summarizeDailyReport(facts); err != nil {
+			return nil, err
 		}
 	}
 
-	if report.Embedding, err = r.GenerateEmbeddings(report.Report); err != nil {
+	var text string
+	if text, err = renderDailyReport(data, summary); err != nil {
 		return nil, err
 	}
+	return r.newReport(reportTypeDaily, data.Date, data.Date, strings.TrimRight(text, "\n"))
+}
 
-	return report, nil
+// summarizeDailyReport asks the LLM to write the summary of the daily report.
+func (r *Reporter) summarizeDailyReport(report string) (string, error) {
+	var builder strings.Builder
+	fmt.Fprintln(&builder, "This is the daily report of the activity and the sleep of a user, generated from their Fitbit data.")
+	fmt.Fprintf(&builder, "```\n%s```\n\n", report)
+	fmt.Fprintln(&builder, "Write the content of the Summary section: a short paragraph with the insights on the day,")
+	fmt.Fprintln(&builder, "and the potential relations between the activity and the sleep.")
+	fmt.Fprintln(&builder, "Use only the values of the report, without repeating all of them. Do not write titles or headings.")
+
+	return r.llm.Generate(r.ctx, []LLMMessage{{Role: llmRoleUser, Text: builder.String()}}, ChatTemperature)
 }
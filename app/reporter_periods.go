@@ -0,0 +1,194 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+// metricSummary is the summary of a metric over the days of a period.
+type metricSummary struct {
+	Average float64 `json:"average"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Total   float64 `json:"total"`
+	// Days is the number of days with a value
+	Days int `json:"days"`
+}
+
+// periodSummary is the aggregation of the UserData of the days of a period, sent to the LLM
+// to fill the weekly and monthly templates.
+type periodSummary struct {
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	// Days is the number of days of the period
+	Days int `json:"days"`
+	// Metrics are the summaries of the columns of UserData.Headers()
+	Metrics map[string]metricSummary `json:"metrics"`
+	// Activities is the number of times every activity has been done
+	Activities map[string]int `json:"activities"`
+}
+
+// summarizePeriod aggregates the data of the days between startDate and endDate.
+func summarizePeriod(startDate, endDate time.Time, data []*UserData) periodSummary {
+	summary := periodSummary{
+		StartDate:  startDate.Format(time.DateOnly),
+		EndDate:    endDate.Format(time.DateOnly),
+		Days:       int(endDate.Sub(startDate).Hours()/24) + 1,
+		Metrics:    make(map[string]metricSummary),
+		Activities: make(map[string]int),
+	}
+	headers := (UserData{}).Headers()
+	for _, day := range data {
+		for i, value := range day.Values() {
+			// Date and ActivitiesNameConcatenation are not numbers
+			parsed, ok := number(value)
+			if !ok {
+				continue
+			}
+			metric, found := summary.Metrics[headers[i]]
+			if !found {
+				metric.Min, metric.Max = math.Inf(1), math.Inf(-1)
+			}
+			metric.Total += parsed
+			metric.Min = math.Min(metric.Min, parsed)
+			metric.Max = math.Max(metric.Max, parsed)
+			metric.Days++
+			summary.Metrics[headers[i]] = metric
+		}
+		if day.Activities != nil {
+			for _, activity := range *day.Activities {
+				summary.Activities[activity.ActivityName]++
+			}
+		}
+	}
+	for header, metric := range summary.Metrics {
+		metric.Average = math.Round(metric.Total/float64(metric.Days)*100) / 100
+		summary.Metrics[header] = metric
+	}
+	return summary
+}
+
+// GeneratePeriodReport generates the weekly or the monthly report of the period between startDate
+// and endDate, from the aggregated data of its days and from their daily reports.
+func (r *Reporter) GeneratePeriodReport(reportType string, startDate, endDate time.Time, data []*UserData, dailyReports []types.Report) (report *types.Report, err error) {
+	var template string
+	switch reportType {
+	case reportTypeWeekly:
+		template = weeklyReportTemplate
+	case reportTypeMonthly:
+		template = monthlyReportTemplate
+	default:
+		return nil, fmt.Errorf("unsupported report type %q", reportType)
+	}
+
+	var jsonData []byte
+	if jsonData, err = json.Marshal(summarizePeriod(startDate, endDate, data)); err != nil {
+		return nil, err
+	}
+	var builder strings.Builder
+	fmt.Fprintln(&builder, string(jsonData))
+	if len(dailyReports) > 0 {
+		fmt.Fprintln(&builder, "")
+		fmt.Fprintln(&builder, "These are the daily reports of the period:")
+		for _, dailyReport := range dailyReports {
+			fmt.Fprintln(&builder, "")
+			fmt.Fprintln(&builder, dailyReport.Report)
+		}
+	}
+
+	var response string
+	if response, err = r.fillTemplate(template, "the aggregated data in JSON format, followed by the daily reports", builder.String()); err != nil {
+		return nil, err
+	}
+	return r.newReport(reportType, startDate, endDate, response)
+}
+
+// reportPeriod is a week or a month to report.
+type reportPeriod struct {
+	reportType         string
+	startDate, endDate time.Time
+}
+
+// completePeriods returns the weeks (from Monday to Sunday) and the months between startDate
+// and endDate (included) that are already over.
+func completePeriods(startDate, endDate time.Time) []reportPeriod {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if !endDate.Before(today) {
+		endDate = today.AddDate(0, 0, -1)
+	}
+	var periods []reportPeriod
+
+	// The first Monday of the range
+	monday := startDate.AddDate(0, 0, (8-int(startDate.Weekday()))%7)
+	for ; !monday.AddDate(0, 0, 6).After(endDate); monday = monday.AddDate(0, 0, 7) {
+		periods = append(periods, reportPeriod{reportTypeWeekly, monday, monday.AddDate(0, 0, 6)})
+	}
+
+	// The first day of the first month starting in the range
+	month := time.Date(startDate.Year(), startDate.Month(), 1, 0, 0, 0, 0, startDate.Location())
+	if month.Before(startDate) {
+		month = month.AddDate(0, 1, 0)
+	}
+	for ; !month.AddDate(0, 1, -1).After(endDate); month = month.AddDate(0, 1, 0) {
+		periods = append(periods, reportPeriod{reportTypeMonthly, month, month.AddDate(0, 1, -1)})
+	}
+	return periods
+}
+
+// generatePeriodReport generates and stores the weekly or monthly report of the period,
+// from its daily reports. A period without daily reports has no data, and no report.
+func generatePeriodReport(reporter *Reporter, fetcher *fetcher, period reportPeriod) error {
+	var dailyReports []types.Report
+	if err := _db.Model(&types.Report{}).
+		Where("user_id = ? AND report_type = ? AND start_date BETWEEN ? AND ?", fetcher.user.ID, reportTypeDaily, period.startDate, period.endDate).
+		Order("start_date").Scan(&dailyReports); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	data, err := fetcher.FetchPartialByRange(period.startDate, period.endDate)
+	if err != nil {
+		return err
+	}
+
+	var report *types.Report
+	if report, err = reporter.GeneratePeriodReport(period.reportType, period.startDate, period.endDate, data, dailyReports); err != nil {
+		return err
+	}
+	return _db.Create(report)
+}
+
+var (
+	weeklyQuestion  = regexp.MustCompile(`(?i)\b(week|weeks|weekly)\b`)
+	monthlyQuestion = regexp.MustCompile(`(?i)\b(month|months|monthly)\b`)
+	dailyQuestion   = regexp.MustCompile(`(?i)\b(day|days|daily|night|nights|today|yesterday|tonight|\d{4}-\d{2}-\d{2})\b`)
+)
+
+// reportTypesFor returns the types of the reports that answer the question best,
+// from the periods it mentions. No types means that any report is fine.
+func reportTypesFor(question string) []string {
+	var reportTypes []string
+	if dailyQuestion.MatchString(question) {
+		reportTypes = append(reportTypes, reportTypeDaily)
+	}
+	if weeklyQuestion.MatchString(question) {
+		reportTypes = append(reportTypes, reportTypeWeekly)
+	}
+	if monthlyQuestion.MatchString(question) {
+		reportTypes = append(reportTypes, reportTypeMonthly)
+	}
+	return reportTypes
+}
@@ -0,0 +1,82 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// periodStarts returns the first days of the periods of the report type, and checks that every
+// week ends on the Sunday and every month on its last day.
+func periodStarts(t *testing.T, periods []reportPeriod, reportType string) string {
+	t.Helper()
+	var starts []string
+	for _, period := range periods {
+		if period.reportType != reportType {
+			continue
+		}
+		end := period.startDate.AddDate(0, 0, 6)
+		if reportType == reportTypeMonthly {
+			end = period.startDate.AddDate(0, 1, -1)
+		}
+		if !period.endDate.Equal(end) {
+			t.Errorf("%s period from %s ends on %s, want %s", reportType, period.startDate.Format(time.DateOnly),
+				period.endDate.Format(time.DateOnly), end.Format(time.DateOnly))
+		}
+		starts = append(starts, period.startDate.Format(time.DateOnly))
+	}
+	return strings.Join(starts, " ")
+}
+
+func TestCompletePeriods(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		start, end    string
+		weeks, months string
+	}{
+		{"a week", "2024-03-04", "2024-03-10", "2024-03-04", ""},
+		{"a week without its Sunday", "2024-03-04", "2024-03-09", "", ""},
+		{"a week without its Monday", "2024-03-05", "2024-03-17", "2024-03-11", ""},
+		{"from a Sunday", "2024-03-03", "2024-03-17", "2024-03-04 2024-03-11", ""},
+		{"a week across two months", "2024-04-29", "2024-05-05", "2024-04-29", ""},
+		{"a month", "2024-04-01", "2024-04-30", "2024-04-01 2024-04-08 2024-04-15 2024-04-22", "2024-04-01"},
+		{"a month without its last day", "2024-04-01", "2024-04-29", "2024-04-01 2024-04-08 2024-04-15 2024-04-22", ""},
+		{"a month without its first day", "2024-02-02", "2024-03-31",
+			"2024-02-05 2024-02-12 2024-02-19 2024-02-26 2024-03-04 2024-03-11 2024-03-18 2024-03-25", "2024-03-01"},
+		{"February of a leap year", "2024-02-01", "2024-02-29", "2024-02-05 2024-02-12 2024-02-19", "2024-02-01"},
+		{"the months across the year", "2023-12-01", "2024-01-31",
+			"2023-12-04 2023-12-11 2023-12-18 2023-12-25 2024-01-01 2024-01-08 2024-01-15 2024-01-22", "2023-12-01 2024-01-01"},
+		{"a day", "2024-03-04", "2024-03-04", "", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			start, _ := time.Parse(time.DateOnly, tt.start)
+			end, _ := time.Parse(time.DateOnly, tt.end)
+			periods := completePeriods(start, end)
+			if weeks := periodStarts(t, periods, reportTypeWeekly); weeks != tt.weeks {
+				t.Errorf("weeks from %q, want from %q", weeks, tt.weeks)
+			}
+			if months := periodStarts(t, periods, reportTypeMonthly); months != tt.months {
+				t.Errorf("months from %q, want from %q", months, tt.months)
+			}
+		})
+	}
+}
+
+func TestCompletePeriodsNotOver(t *testing.T) {
+	// The current week and the current month are not over, even if the range ends later
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	month := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for _, period := range completePeriods(today.AddDate(0, -2, 0), today.AddDate(0, 1, 0)) {
+		if !period.endDate.Before(today) {
+			t.Errorf("period %+v is not over", period)
+		}
+		if period.startDate.Equal(monday) || (period.reportType == reportTypeMonthly && period.startDate.Equal(month)) {
+			t.Errorf("period %+v is the current one", period)
+		}
+	}
+}
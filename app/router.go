@@ -67,6 +67,9 @@ func NewRouter() (*echo.Echo, error) {
 	viewConf.Funcs["timeOnly"] = func(t time.Time) string {
 		return t.Format(time.TimeOnly)
 	}
+	viewConf.Funcs["msToMin"] = func(ms int64) float64 {
+		return float64(ms) * msToMin
+	}
 
 	router.Renderer = echoview.New(viewConf)
 
@@ -77,6 +80,8 @@ func NewRouter() (*echo.Echo, error) {
 	// Login route is auth
 	// Logout is the cookie removal
 	router.GET("/login", Auth())
+	// Shown when the permission given to the app has been revoked
+	router.GET("/reconsent", Reconsent())
 	router.GET("/logout", func(c echo.Context) (err error) {
 		var cookie *http.Cookie
 		if cookie, err = c.Cookie("token"); err == nil {
@@ -88,6 +93,12 @@ func NewRouter() (*echo.Echo, error) {
 		return c.Redirect(http.StatusTemporaryRedirect, "/")
 	})
 
+	// Fitbit Subscriptions API subscriber endpoint
+	router.GET("/fitbit/subscriber", SubscriberVerification())
+	router.POST("/fitbit/subscriber", SubscriberNotifications())
+	// State of the Fitbit API quota of the user
+	router.GET("/fitbit/quota", Quota(), RequireFitbit())
+
 	router.GET("/", Index())
 	router.GET("/about", About())
 	router.GET("/contact", Contact())
@@ -98,6 +109,14 @@ func NewRouter() (*echo.Echo, error) {
 	router.GET("/dashboard/:startYear/:startMonth/:startDay/:endYear/:endMonth/:endDay", CustomDashboard(), RequireFitbit())
 	// All the dashboard routes below are defined but already superseded by the one above
 	// decide with to do. Perhaps when clicking on some shortcut we can point to these, or link to them somehow...
+	// Progress of the import of the user data
+	router.GET("/dashboard/progress", DumpProgress(), RequireFitbit())
+	router.GET("/dashboard/progress/status", DumpProgressStatus(), RequireFitbit())
+	router.GET("/dashboard/progress/events", DumpProgressEvents(), RequireFitbit())
+	// Detail of a single night, reachable clicking on the "Sleep Data" chart
+	router.GET("/dashboard/sleep/:year/:month/:day", SleepNight(), RequireFitbit())
+	router.GET("/dashboard/predictors", PredictorsDashboard(), RequireFitbit())
+	router.GET("/dashboard/activity/:id", ActivityDetail(), RequireFitbit())
 	router.GET("/dashboard/week", WeeklyDashboard(), RequireFitbit())
 	router.GET("/dashboard/month", MonthlyDashboard(), RequireFitbit())
 	router.GET("/dashboard/year", YearlyDashboard(), RequireFitbit())
@@ -106,6 +125,21 @@ func NewRouter() (*echo.Echo, error) {
 	router.GET("/dashboard/:year", YearlyDashboard(), RequireFitbit())
 
 	router.GET("/chat/:startYear/:startMonth/:startDay/:endYear/:endMonth/:endDay", ChatWithData(), RequireFitbit())
+	// Chat conversations of a date range, stored to be resumed
+	router.GET("/conversations", Conversations(), RequireFitbit())
+	router.DELETE("/conversations/:id", DeleteConversation(), RequireFitbit())
+	router.GET("/conversations/:id/export", ExportConversation(), RequireFitbit())
+	// Progress of the generation of the reports of a date range
+	router.GET("/reports/status", ReportJobsStatus(), RequireFitbit())
+	// What helped and what hurt the predicted sleep of a day
+	router.GET("/predictions/explain/:year/:month/:day", PredictionExplanation(), RequireFitbit())
+	// Registry of the versions of the predictors of every target
+	router.GET("/predictors", Predictors(), RequireFitbit())
+	router.POST("/predictors/:target/train", TrainPredictor(), RequireFitbit())
+	router.POST("/predictors/:target/:version/activate", ActivatePredictor(), RequireFitbit())
+	// Walk-forward backtests of the predictors, against the naive baselines
+	router.GET("/predictors/backtests", Backtests(), RequireFitbit())
+	router.POST("/predictors/:target/backtest", RunBacktest(), RequireFitbit())
 
 	router.Static("/static", "static")
 	router.File("/favicon.ico", "static/favicon.ico")
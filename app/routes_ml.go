@@ -45,18 +45,10 @@ func TestTrainAndDeploy() echo.HandlerFunc {
 
 type PredictionResult struct {
 	// The prediction result
-	Prediction []float32 `json:"prediction"`
+	Prediction []float64 `json:"prediction"`
 	Target     string    `json:"target"`
 }
 
-func toFloat32(input []uint8) []float32 {
-	output := make([]float32, len(input))
-	for i, v := range input {
-		output[i] = float32(v)
-	}
-	return output
-}
-
 func TestPredictSleepEfficiency() echo.HandlerFunc {
 	return func(c echo.Context) (err error) {
 		// 1. Fetch all user data
@@ -79,12 +71,12 @@ func TestPredictSleepEfficiency() echo.HandlerFunc {
 
 		todayData, _ := fetcher.FetchByDate(time.Now())
 
-		var sleepEfficiency []uint8
+		var sleepEfficiency []float64
 		if sleepEfficiency, err = PredictSleepEfficiency(&user, []*UserData{todayData}); err != nil {
 			return err
 		}
 		return c.JSON(http.StatusOK, PredictionResult{
-			Prediction: toFloat32(sleepEfficiency),
+			Prediction: sleepEfficiency,
 			Target:     "SleepEfficiency",
 		})
 	}
@@ -14,7 +14,6 @@ import (
 	"net/url"
 	"time"
 
-	"github.com/galeone/fitbit/v2"
 	"github.com/galeone/fitbit/v2/types"
 	"github.com/galeone/fitsleepinsights/database"
 	"github.com/google/uuid"
@@ -35,7 +34,7 @@ import (
 // Loaded from a .env file - if any.
 func Auth() func(echo.Context) error {
 	return func(c echo.Context) (err error) {
-		authorizer := fitbit.NewAuthorizer(_db, _clientID, _clientSecret, _redirectURL)
+		authorizer := newFitbitAuthorizer()
 
 		authorizing := types.AuthorizingUser{
 			CSRFToken: uuid.New().String(),
@@ -87,7 +86,7 @@ func Auth() func(echo.Context) error {
 // access token expires.
 func Redirect() func(echo.Context) error {
 	return func(c echo.Context) (err error) {
-		authorizer := fitbit.NewAuthorizer(_db, _clientID, _clientSecret, _redirectURL)
+		authorizer := newFitbitAuthorizer()
 		var cookie *http.Cookie
 		if cookie, err = c.Cookie("authorizing"); err == nil {
 			var authorizing *types.AuthorizingUser
@@ -121,19 +120,16 @@ func Redirect() func(echo.Context) error {
 			log.Errorf("Error upserting authorized user: %s", err)
 			return err
 		}
+		if err = tokenIssued(token); err != nil {
+			log.Errorf("Error storing the token expiration: %s", err)
+			return err
+		}
 		// Send a database notification over the channel.
 		// The receiver will start the routing for fetching all the data
 		if err = _db.Notify(database.NewUsersChannel, token.AccessToken); err != nil {
 			c.Logger().Error("Unable to sent new user creation notification")
 		}
-		cookie = &http.Cookie{
-			Name:     "token",
-			Value:    token.AccessToken,
-			Domain:   _domain,
-			Expires:  time.Now().Add(time.Second * time.Duration(token.ExpiresIn)),
-			HttpOnly: true,
-		}
-		c.SetCookie(cookie)
+		setTokenCookie(c, token)
 
 		// Unset the authorizing cookie
 		c.SetCookie(&http.Cookie{
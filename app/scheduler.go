@@ -0,0 +1,278 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/gommon/log"
+)
+
+// syncAllDataTypes is the data type used in the sync_status table to store
+// the outcome of the whole synchronization of a user.
+const syncAllDataTypes = "all"
+
+// clock abstracts the time source used by the scheduler.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// userLocks contains a mutex per user ID.
+type userLocks struct {
+	mu    sync.Mutex
+	locks map[int64]*sync.Mutex
+}
+
+func newUserLocks() *userLocks {
+	return &userLocks{locks: map[int64]*sync.Mutex{}}
+}
+
+// get returns the mutex of the user, creating it if needed.
+func (l *userLocks) get(userID int64) *sync.Mutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	mu, ok := l.locks[userID]
+	if !ok {
+		mu = &sync.Mutex{}
+		l.locks[userID] = mu
+	}
+	return mu
+}
+
+// _userDumpLocks are held while the data of the user is being dumped, so two
+// dumps of the same user (e.g. the login and the background synchronization) never overlap.
+var _userDumpLocks = newUserLocks()
+
+// lockUserDump waits until no other dump of the user is running, and locks it.
+// The returned function releases the lock.
+func lockUserDump(userID int64) func() {
+	mu := _userDumpLocks.get(userID)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// tryLockUserDump locks the dump of the user, only if no other dump is running.
+// The returned function releases the lock and it's nil if the lock has not been acquired.
+func tryLockUserDump(userID int64) func() {
+	mu := _userDumpLocks.get(userID)
+	if !mu.TryLock() {
+		return nil
+	}
+	return mu.Unlock
+}
+
+// recordSyncStatus stores in the sync_status table the outcome of the dump of every data type
+// contained in results.
+func recordSyncStatus(userID int64, results dumpResults, now time.Time) {
+	for dataType, err := range results {
+		var dbErr error
+		if err == nil {
+			dbErr = _db.Model(types.SyncStatus{}).Exec(
+				`INSERT INTO sync_status(user_id, data_type, last_success) VALUES (?, ?, ?)
+				ON CONFLICT (user_id, data_type) DO UPDATE SET last_success = EXCLUDED.last_success`,
+				userID, dataType, now)
+		} else {
+			dbErr = _db.Model(types.SyncStatus{}).Exec(
+				`INSERT INTO sync_status(user_id, data_type, last_failure, last_error) VALUES (?, ?, ?, ?)
+				ON CONFLICT (user_id, data_type) DO UPDATE SET last_failure = EXCLUDED.last_failure, last_error = EXCLUDED.last_error`,
+				userID, dataType, now, err.Error())
+		}
+		if dbErr != nil {
+			log.Error("recordSyncStatus: ", dbErr)
+		}
+	}
+}
+
+// SyncScheduler periodically dumps the newer data of every authorized user,
+// so the data is up to date even if the users never login again.
+// The historical backfill of the users is a separate job, started after every synchronization
+// if not already running: the backfill can last hours, and it never delays the synchronizations.
+type SyncScheduler struct {
+	clock       clock
+	interval    time.Duration
+	jitter      time.Duration
+	concurrency int
+	// random returns a random number in [0, n), used for the jitter
+	random func(n int64) int64
+	// users returns the users to synchronize
+	users func() ([]types.User, error)
+	// sync synchronizes a user
+	sync func(user types.User)
+	// backfill continues the historical backfill of a user
+	backfill func(user types.User)
+	// backfilling is true while the backfill job is running
+	backfilling atomic.Bool
+}
+
+// NewSyncScheduler creates a SyncScheduler configured using the SYNC_INTERVAL,
+// SYNC_JITTER, and SYNC_CONCURRENCY environment variables.
+func NewSyncScheduler() *SyncScheduler {
+	s := &SyncScheduler{
+		clock:       realClock{},
+		interval:    _syncInterval,
+		jitter:      _syncJitter,
+		concurrency: _syncConcurrency,
+		random:      rand.Int63n,
+		users:       authorizedUsers,
+	}
+	s.sync = s.syncUser
+	s.backfill = s.backfillUser
+	return s
+}
+
+// authorizedUsers returns all the authorized users.
+func authorizedUsers() (users []types.User, err error) {
+	err = _db.Model(types.User{}).Scan(&users)
+	return
+}
+
+// Run synchronizes all the users at startup, and then every interval, until ctx is done.
+func (s *SyncScheduler) Run(ctx context.Context) {
+	for {
+		s.SyncAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(s.interval):
+		}
+	}
+}
+
+// SyncAll synchronizes every authorized user, at most concurrency users at a time,
+// and then starts the backfill job, if not already running.
+// Users with a dump already in progress are skipped.
+func (s *SyncScheduler) SyncAll(ctx context.Context) {
+	users, err := s.users()
+	if err != nil {
+		log.Error("SyncAll: ", err)
+		return
+	}
+
+	log.Printf("Background synchronization of %d users started", len(users))
+	s.syncUsers(ctx, users)
+	log.Print("Background synchronization finished")
+
+	if s.backfilling.CompareAndSwap(false, true) {
+		go func() {
+			defer s.backfilling.Store(false)
+			s.backfillUsers(ctx, users)
+		}()
+	}
+}
+
+// backfillUsers continues the historical backfill of the users, a user at a time, until ctx is done.
+func (s *SyncScheduler) backfillUsers(ctx context.Context, users []types.User) {
+	for _, user := range users {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		s.backfill(user)
+	}
+}
+
+// syncUsers synchronizes the users, at most concurrency users at a time.
+// Every user waits a random jitter before taking its turn, so the waits don't
+// keep the other users from being synchronized.
+func (s *SyncScheduler) syncUsers(ctx context.Context, users []types.User) {
+	semaphore := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+	for _, user := range users {
+		wg.Add(1)
+		go func(user types.User) {
+			defer wg.Done()
+			if s.jitter > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-s.clock.After(time.Duration(s.random(int64(s.jitter)))):
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case semaphore <- struct{}{}:
+			}
+			defer func() { <-semaphore }()
+			s.sync(user)
+		}(user)
+	}
+	wg.Wait()
+}
+
+// syncUser dumps the newer data of user, and stores the outcome in the sync_status table.
+func (s *SyncScheduler) syncUser(user types.User) {
+	if user.ReconsentRequired {
+		log.Printf("User %d must give again the permission to the app, skipping synchronization", user.ID)
+		return
+	}
+
+	unlock := tryLockUserDump(user.ID)
+	if unlock == nil {
+		log.Printf("User %d is already dumping, skipping synchronization", user.ID)
+		return
+	}
+
+	d, err := NewDumper(user.AccessToken)
+	if err != nil {
+		unlock()
+		recordSyncStatus(user.ID, dumpResults{syncAllDataTypes: err}, s.clock.Now())
+		return
+	}
+
+	// The dashboards show the data imported so far while the user is dumping
+	if err := setDumping(user.ID, true); err != nil {
+		unlock()
+		log.Error("syncUser: ", err)
+		recordSyncStatus(user.ID, dumpResults{syncAllDataTypes: err}, s.clock.Now())
+		return
+	}
+	results := d.dumpNewer()
+	if err := setDumping(user.ID, false); err != nil {
+		log.Error("syncUser: ", err)
+	}
+	unlock()
+	results.add(syncAllDataTypes, results.err())
+	now := s.clock.Now()
+	recordSyncStatus(user.ID, results, now)
+
+	// The report of yesterday, now that its data is complete
+	yesterday := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	if err := enqueueReportJobs(user.ID, yesterday, yesterday); err != nil {
+		log.Error("enqueueReportJobs: ", err)
+	}
+	// The predictors learn from the new nights
+	retrainPredictors(&user)
+}
+
+// backfillUser continues the historical backfill of the user, if not completed yet.
+func (s *SyncScheduler) backfillUser(user types.User) {
+	// The access token may have been refreshed by the synchronization
+	if err := _db.Model(types.User{}).Where("id = ?", user.ID).Scan(&user); err != nil {
+		log.Error("backfillUser: ", err)
+		return
+	}
+	if user.ReconsentRequired {
+		return
+	}
+	d, err := NewDumper(user.AccessToken)
+	if err != nil {
+		log.Error("backfillUser: ", err)
+		return
+	}
+	d.Backfill()
+}
@@ -0,0 +1,238 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	fitbit_pgdb "github.com/galeone/fitbit-pgdb/v3"
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+// fakeClock is a clock whose time moves only with Advance.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := fakeTimer{deadline: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.timers = append(c.timers, timer)
+	return timer.ch
+}
+
+// Advance moves the time forward by d, and fires the expired timers.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.deadline.After(c.now) {
+			pending = append(pending, timer)
+		} else {
+			timer.ch <- c.now
+		}
+	}
+	c.timers = pending
+}
+
+// waitTimers waits until n timers are pending, and returns their durations.
+func (c *fakeClock) waitTimers(t *testing.T, n int) []time.Duration {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		c.mu.Lock()
+		if len(c.timers) == n {
+			var durations []time.Duration
+			for _, timer := range c.timers {
+				durations = append(durations, timer.deadline.Sub(c.now))
+			}
+			c.mu.Unlock()
+			return durations
+		}
+		c.mu.Unlock()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t.Fatalf("%d timers pending, want %d", len(c.timers), n)
+	return nil
+}
+
+// testSyncScheduler returns a scheduler that records the synchronized users, and the
+// maximum number of users synchronized at the same time.
+func testSyncScheduler(concurrency int) (*SyncScheduler, *fakeClock, func() ([]int64, int)) {
+	clock := &fakeClock{now: time.Date(2024, time.March, 4, 3, 0, 0, 0, time.UTC)}
+	var mu sync.Mutex
+	var synced []int64
+	var running, maxRunning int
+	var draws int64
+	s := &SyncScheduler{
+		clock:       clock,
+		interval:    time.Hour,
+		jitter:      10 * time.Minute,
+		concurrency: concurrency,
+		// The users wait 1, 2, 3... minutes
+		random: func(n int64) int64 {
+			mu.Lock()
+			defer mu.Unlock()
+			draws++
+			return min(draws*int64(time.Minute), n-1)
+		},
+		sync: func(user types.User) {
+			mu.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			synced = append(synced, user.ID)
+			running--
+			mu.Unlock()
+		},
+	}
+	return s, clock, func() ([]int64, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return synced, maxRunning
+	}
+}
+
+func testUsers(n int) []types.User {
+	var users []types.User
+	for i := 1; i <= n; i++ {
+		users = append(users, types.User{AuthorizedUser: fitbit_pgdb.AuthorizedUser{ID: int64(i)}})
+	}
+	return users
+}
+
+func TestSyncUsers(t *testing.T) {
+	s, clock, results := testSyncScheduler(2)
+	done := make(chan struct{})
+	go func() {
+		s.syncUsers(context.Background(), testUsers(5))
+		close(done)
+	}()
+
+	// All the users wait their jitter at the same time: the waits don't hold the semaphore
+	for _, d := range clock.waitTimers(t, 5) {
+		if d <= 0 || d >= s.jitter {
+			t.Errorf("jitter of %s, want it in (0, %s)", d, s.jitter)
+		}
+	}
+	if synced, _ := results(); len(synced) != 0 {
+		t.Fatalf("users %v synchronized before their jitter", synced)
+	}
+	clock.Advance(s.jitter)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the synchronization didn't finish")
+	}
+
+	synced, maxRunning := results()
+	if len(synced) != 5 {
+		t.Errorf("users %v synchronized, want 5 users", synced)
+	}
+	if maxRunning > s.concurrency {
+		t.Errorf("%d users synchronized at the same time, the concurrency is %d", maxRunning, s.concurrency)
+	}
+}
+
+func TestSyncUsersCanceled(t *testing.T) {
+	s, clock, results := testSyncScheduler(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.syncUsers(ctx, testUsers(3))
+		close(done)
+	}()
+
+	clock.waitTimers(t, 3)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the synchronization didn't stop")
+	}
+	if synced, _ := results(); len(synced) != 0 {
+		t.Errorf("users %v synchronized after the cancellation", synced)
+	}
+}
+
+func TestSyncSchedulerRun(t *testing.T) {
+	s, clock, results := testSyncScheduler(2)
+	s.jitter = 0
+	s.users = func() ([]types.User, error) { return testUsers(3), nil }
+	// The backfill of the first user lasts until release is closed
+	release := make(chan struct{})
+	backfilled := make(chan int64, 10)
+	s.backfill = func(user types.User) {
+		if user.ID == 1 {
+			<-release
+		}
+		backfilled <- user.ID
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	// The users are synchronized at startup, without waiting the interval
+	if d := clock.waitTimers(t, 1); d[0] != s.interval {
+		t.Errorf("next synchronization in %s, want %s", d[0], s.interval)
+	}
+	if synced, _ := results(); len(synced) != 3 {
+		t.Errorf("users %v synchronized at startup, want 3 users", synced)
+	}
+
+	// The backfill doesn't delay the next synchronization, and it's not started again while running
+	clock.Advance(s.interval)
+	clock.waitTimers(t, 1)
+	if synced, _ := results(); len(synced) != 6 {
+		t.Errorf("users %v synchronized after an interval, want every user twice", synced)
+	}
+	close(release)
+	for i := int64(1); i <= 3; i++ {
+		select {
+		case id := <-backfilled:
+			if id != i {
+				t.Errorf("user %d backfilled, want %d", id, i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the backfill didn't finish")
+		}
+	}
+	select {
+	case id := <-backfilled:
+		t.Errorf("user %d backfilled again by a concurrent backfill job", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the scheduler didn't stop")
+	}
+}
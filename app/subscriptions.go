@@ -0,0 +1,276 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	fitbit_client "github.com/galeone/fitbit/v2/client"
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// Fitbit Subscriptions API
+// https://dev.fitbit.com/build/reference/web-api/developer-guide/using-subscriptions/
+//
+// Every user is subscribed to the collections below. When new data is synced
+// with Fitbit, Fitbit sends a notification to our subscriber endpoint and we
+// dump only the affected collection and date.
+var subscriptionCollections = []string{"activities", "body", "sleep"}
+
+// maxNotificationsBytes is the maximum size of the body of the requests to the subscriber endpoint.
+// Fitbit sends a few notifications per request, each one is less than 200 bytes.
+const maxNotificationsBytes = 1 << 20
+
+// subscriptionNotification is a single notification sent by Fitbit to the subscriber endpoint.
+type subscriptionNotification struct {
+	CollectionType string `json:"collectionType"`
+	Date           string `json:"date"`
+	OwnerID        string `json:"ownerId"`
+	OwnerType      string `json:"ownerType"`
+	SubscriptionID string `json:"subscriptionId"`
+}
+
+// _notifications is the queue of the notifications received, processed in background
+// by processNotifications. In this way the subscriber endpoint answers immediately,
+// as required by Fitbit.
+var _notifications = make(chan subscriptionNotification, 1024)
+
+func processNotifications() {
+	dispatchNotifications(_notifications, processNotification)
+}
+
+// dispatchNotifications processes the notifications with a worker per user, that exists while the
+// user has notifications pending. The notifications of a user are processed sequentially, because
+// every dump locks the data of the user (e.g. for hours during the backfill), but they never delay
+// the notifications of the other users. The duplicates of the pending notifications are dropped.
+func dispatchNotifications(notifications <-chan subscriptionNotification, process func(subscriptionNotification)) {
+	var mu sync.Mutex
+	pending := map[string][]subscriptionNotification{}
+	// worker processes the pending notifications of the owner, until there are none
+	worker := func(owner string) {
+		for {
+			mu.Lock()
+			queue := pending[owner]
+			if len(queue) == 0 {
+				delete(pending, owner)
+				mu.Unlock()
+				return
+			}
+			pending[owner] = queue[1:]
+			mu.Unlock()
+			process(queue[0])
+		}
+	}
+
+	for notification := range notifications {
+		mu.Lock()
+		queue, running := pending[notification.OwnerID]
+		if !slices.Contains(queue, notification) {
+			pending[notification.OwnerID] = append(queue, notification)
+		}
+		mu.Unlock()
+		if !running {
+			go worker(notification.OwnerID)
+		}
+	}
+}
+
+// processNotification dumps the collection and date contained in the notification.
+func processNotification(notification subscriptionNotification) {
+	var user types.User
+	condition := types.User{}
+	condition.UserID = notification.OwnerID
+	if err := _db.Model(types.User{}).Where(&condition).Scan(&user); err != nil {
+		log.Errorf("processNotification: unknown owner %s: %s", notification.OwnerID, err)
+		return
+	}
+
+	if notification.CollectionType == "userRevokedAccess" {
+		// Fitbit already removed the subscriptions of the user, and the tokens are not valid anymore:
+		// the user must login again, and until then the user is not synchronized
+		if err := _db.Delete(&types.Subscription{UserID: user.ID}); err != nil {
+			log.Error("processNotification: ", err)
+		}
+		if err := _tokenStore.RequireReconsent(user.ID); err != nil {
+			log.Error("processNotification: ", err)
+		}
+		return
+	}
+
+	date, err := time.Parse(time.DateOnly, notification.Date)
+	if err != nil {
+		log.Error("processNotification: ", err)
+		return
+	}
+
+	unlock := lockUserDump(user.ID)
+	defer unlock()
+
+	var d *dumper
+	if d, err = NewDumper(user.AccessToken); err != nil {
+		log.Error("processNotification: ", err)
+		return
+	}
+	recordSyncStatus(user.ID, d.dumpCollection(notification.CollectionType, date), time.Now())
+}
+
+// dumpCollection dumps the data of the collection (as defined by the Fitbit Subscriptions API)
+// for the specified date.
+// The daily time series are dumped only when date is in the past, because the data of the
+// current day is still changing and it will be dumped by the next synchronization.
+func (d *dumper) dumpCollection(collectionType string, date time.Time) dumpResults {
+	results := dumpResults{}
+	yesterday := time.Now().Add(-time.Duration(24) * time.Hour).Truncate(time.Hour * 24)
+	complete := !date.After(yesterday)
+
+	switch collectionType {
+	case "sleep":
+		results.add(types.SleepLog{}.TableName(), d.userSleepLogList(&date, &date))
+	case "activities":
+		results.add(types.ActivityLog{}.TableName(), d.userActivityLogList(&date, nil))
+		// Only the TCX of the activities of the notification: the others are dumped by the synchronizations
+		results.add(types.ActivityTrackpoint{}.TableName(), d.dumpActivitiesTCX(&date))
+		if !complete {
+			break
+		}
+		results.add(types.ActivityCaloriesSeries{}.TableName(), d.userActivityCaloriesTimeseries(&date, &date))
+		results.add(types.CaloriesBMRSeries{}.TableName(), d.userCaloriesBMRTimeseries(&date, &date))
+		results.add(types.CaloriesSeries{}.TableName(), d.userCaloriesTimeseries(&date, &date))
+		results.add(types.DistanceSeries{}.TableName(), d.userDistanceTimeseries(&date, &date))
+		results.add(types.FloorsSeries{}.TableName(), d.userFloorsTimeseries(&date, &date))
+		results.add(types.MinutesFairlyActiveSeries{}.TableName(), d.userMinutesFairlyActiveTimeseries(&date, &date))
+		results.add(types.MinutesLightlyActiveSeries{}.TableName(), d.userMinutesLightlyActiveTimeseries(&date, &date))
+		results.add(types.MinutesSedentarySeries{}.TableName(), d.userMinutesSedentaryTimeseries(&date, &date))
+		results.add(types.MinutesVeryActiveSeries{}.TableName(), d.userMinutesVeryActiveTimeseries(&date, &date))
+		results.add(types.StepsSeries{}.TableName(), d.userStepsTimeseries(&date, &date))
+		results.add(types.HeartRateActivities{}.TableName(), d.userHeartRateTimeseries(&date, &date))
+		results.add(types.ElevationSeries{}.TableName(), d.userElevationTimeseries(&date, &date))
+	case "body":
+		if !complete {
+			break
+		}
+		results.add(types.BMISeries{}.TableName(), d.userBMITimeseries(&date, &date))
+		results.add(types.BodyFatSeries{}.TableName(), d.userBodyFatTimeseries(&date, &date))
+		results.add(types.BodyWeightSeries{}.TableName(), d.userBodyWeightTimeseries(&date, &date))
+	default:
+		log.Printf("dumpCollection: unsupported collection %s", collectionType)
+	}
+	return results
+}
+
+// subscribe registers a subscription for every collection in subscriptionCollections
+// not yet registered for the user.
+func (d *dumper) subscribe() (err error) {
+	var client *http.Client
+	if client, err = d.authorizer.HTTP(); err != nil {
+		return err
+	}
+
+	for _, collection := range subscriptionCollections {
+		subscription := types.Subscription{UserID: d.User.ID, CollectionType: collection}
+		// No error = found
+		if err = _db.Model(types.Subscription{}).Where(&subscription).Scan(&subscription); err == nil {
+			continue
+		}
+
+		subscription.SubscriptionID = fmt.Sprintf("%d-%s", d.User.ID, collection)
+		var req *http.Request
+		endpoint := fitbit_client.UserV1(fmt.Sprintf("%s/apiSubscriptions/%s.json", collection, subscription.SubscriptionID))
+		if req, err = http.NewRequest(http.MethodPost, endpoint, nil); err != nil {
+			return err
+		}
+		if _subscriberID != "" {
+			req.Header.Set("X-Fitbit-Subscriber-Id", _subscriberID)
+		}
+
+		var res *http.Response
+		if res, err = client.Do(req); err != nil {
+			return err
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		// 200: the subscription already exists, 201: created
+		if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+			return &fitbit_client.ResponseError{StatusCode: res.StatusCode, Message: string(body)}
+		}
+
+		if err = _db.Create(&subscription); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validSignature returns true if signature is the base64 encoded HMAC-SHA1 of body,
+// signed with the client secret followed by "&", as Fitbit does.
+func validSignature(body []byte, signature string) bool {
+	mac := hmac.New(sha1.New, []byte(_clientSecret+"&"))
+	mac.Write(body)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// SubscriberVerification handles the verification of the subscriber endpoint.
+// Fitbit sends two requests, one with the correct verification code (we must answer 204)
+// and one with a wrong verification code (we must answer 404).
+func SubscriberVerification() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _subscriberVerificationCode == "" || c.QueryParam("verify") != _subscriberVerificationCode {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// SubscriberNotifications receives the notifications sent by Fitbit, validates their signature
+// and enqueues them for the dump of the updated data.
+func SubscriberNotifications() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if _subscriberVerificationCode == "" {
+			return c.NoContent(http.StatusNotFound)
+		}
+
+		var body []byte
+		if body, err = io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxNotificationsBytes)); err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				return c.NoContent(http.StatusRequestEntityTooLarge)
+			}
+			return c.NoContent(http.StatusBadRequest)
+		}
+		// Fitbit recommends answering 404 when the signature is not valid
+		if !validSignature(body, c.Request().Header.Get("X-Fitbit-Signature")) {
+			log.Warn("SubscriberNotifications: invalid signature")
+			return c.NoContent(http.StatusNotFound)
+		}
+
+		var notifications []subscriptionNotification
+		if err = json.Unmarshal(body, &notifications); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		for _, notification := range notifications {
+			select {
+			case _notifications <- notification:
+			default:
+				// The queue is full: the data will be dumped by the next synchronization
+				log.Warnf("SubscriberNotifications: queue full, dropping %+v", notification)
+			}
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
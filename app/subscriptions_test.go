@@ -0,0 +1,175 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/echo/v4"
+)
+
+func TestDispatchNotifications(t *testing.T) {
+	notifications := make(chan subscriptionNotification)
+	// The dumps of the user "slow" wait for release, as a long backfill
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var processed []subscriptionNotification
+	done := make(chan subscriptionNotification)
+	go dispatchNotifications(notifications, func(notification subscriptionNotification) {
+		if notification.OwnerID == "slow" {
+			<-release
+		}
+		mu.Lock()
+		processed = append(processed, notification)
+		mu.Unlock()
+		done <- notification
+	})
+
+	slow := subscriptionNotification{OwnerID: "slow", CollectionType: "sleep", Date: "2024-03-04"}
+	notifications <- slow
+	// Queued while the first dump of the user is running: the duplicate is dropped
+	next := subscriptionNotification{OwnerID: "slow", CollectionType: "activities", Date: "2024-03-04"}
+	notifications <- next
+	notifications <- next
+
+	// The other users are not delayed
+	fast := subscriptionNotification{OwnerID: "fast", CollectionType: "sleep", Date: "2024-03-04"}
+	notifications <- fast
+	select {
+	case notification := <-done:
+		if notification != fast {
+			t.Fatalf("processed %+v, want %+v", notification, fast)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the notification of a user waited for the dump of another user")
+	}
+
+	close(release)
+	for _, want := range []subscriptionNotification{slow, next} {
+		if notification := <-done; notification != want {
+			t.Errorf("processed %+v, want %+v: the notifications of a user must be processed in order", notification, want)
+		}
+	}
+	close(notifications)
+	select {
+	case notification := <-done:
+		t.Errorf("processed %+v, a duplicate", notification)
+	case <-time.After(100 * time.Millisecond):
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(processed) != 3 {
+		t.Errorf("%d notifications processed, want 3", len(processed))
+	}
+}
+
+// signNotifications signs the body as Fitbit does, following the README.
+func signNotifications(body []byte, clientSecret string) string {
+	mac := hmac.New(sha1.New, []byte(clientSecret+"&"))
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSubscriberNotifications(t *testing.T) {
+	previousSecret, previousCode := _clientSecret, _subscriberVerificationCode
+	_clientSecret, _subscriberVerificationCode = "secret", "verify"
+	defer func() { _clientSecret, _subscriberVerificationCode = previousSecret, previousCode }()
+
+	payload := []byte(`[{"collectionType":"sleep","date":"2024-03-04","ownerId":"ABC123","ownerType":"user","subscriptionId":"1-sleep"}]`)
+	oversized := append([]byte(`[`), bytes.Repeat([]byte(" "), maxNotificationsBytes)...)
+	for _, tc := range []struct {
+		name       string
+		body       []byte
+		signature  string
+		wantStatus int
+		wantQueued bool
+	}{
+		{"signed", payload, signNotifications(payload, "secret"), http.StatusNoContent, true},
+		{"wrong secret", payload, signNotifications(payload, "other"), http.StatusNotFound, false},
+		{"unsigned", payload, "", http.StatusNotFound, false},
+		{"not JSON", []byte("nope"), signNotifications([]byte("nope"), "secret"), http.StatusBadRequest, false},
+		{"too large", oversized, signNotifications(oversized, "secret"), http.StatusRequestEntityTooLarge, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/subscriber", bytes.NewReader(tc.body))
+			req.Header.Set("X-Fitbit-Signature", tc.signature)
+			rec := httptest.NewRecorder()
+			if err := SubscriberNotifications()(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			select {
+			case notification := <-_notifications:
+				if !tc.wantQueued {
+					t.Errorf("queued %+v", notification)
+				} else if notification.OwnerID != "ABC123" || notification.CollectionType != "sleep" || notification.Date != "2024-03-04" {
+					t.Errorf("queued %+v, want the notification of the payload", notification)
+				}
+			default:
+				if tc.wantQueued {
+					t.Error("no notification queued")
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriberVerification(t *testing.T) {
+	previous := _subscriberVerificationCode
+	_subscriberVerificationCode = "verify"
+	defer func() { _subscriberVerificationCode = previous }()
+
+	for code, wantStatus := range map[string]int{"verify": http.StatusNoContent, "wrong": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/subscriber?verify="+code, nil)
+		rec := httptest.NewRecorder()
+		if err := SubscriberVerification()(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != wantStatus {
+			t.Errorf("verification code %q: status = %d, want %d", code, rec.Code, wantStatus)
+		}
+	}
+}
+
+func TestProcessNotificationRevokedAccess(t *testing.T) {
+	user := testDBUser(t)
+	for _, collection := range subscriptionCollections {
+		if err := _db.Create(&types.Subscription{UserID: user.ID, CollectionType: collection,
+			SubscriptionID: fmt.Sprintf("%s-%s", user.UserID, collection)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	processNotification(subscriptionNotification{CollectionType: "userRevokedAccess", OwnerID: user.UserID, OwnerType: "user"})
+
+	var subscriptions []types.Subscription
+	if err := _db.Model(types.Subscription{}).Where("user_id = ?", user.ID).Scan(&subscriptions); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		t.Fatal(err)
+	}
+	if len(subscriptions) != 0 {
+		t.Errorf("%d subscriptions left, want none", len(subscriptions))
+	}
+	stored, err := _tokenStore.User(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.ReconsentRequired {
+		t.Error("the user is not marked as reconsent required")
+	}
+}
@@ -0,0 +1,160 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/galeone/tcx"
+	"github.com/labstack/gommon/log"
+)
+
+// The TCX of an activity contains its trackpoints: position, altitude, distance, heart rate
+// and cadence, sampled every few seconds. Every TCX is an API call, thus the TCX are dumped
+// separately from the activity list, only while the hourly quota of the user is above
+// _tcxQuotaReserve. The activities whose TCX has not been dumped yet are dumped by the
+// next synchronizations.
+
+// tcxQuotaAvailable returns true if the quota of the user allows to dump another TCX.
+func tcxQuotaAvailable(userID int64) bool {
+	quota, err := dbQuotaStore{}.Quota(userID)
+	if err != nil || quota.QuotaLimit == 0 {
+		// Unknown quota: the first response will tell us
+		return true
+	}
+	if !quota.ResetAt.After(time.Now().UTC()) {
+		return true
+	}
+	return quota.Remaining > int64(_tcxQuotaReserve)
+}
+
+// trackpoints returns the rows of the activity_trackpoints table of the trackpoints
+// contained in xml.
+func trackpoints(userID, logID int64, xml *tcx.TCXDB) [][]interface{} {
+	var rows [][]interface{}
+	if xml == nil || xml.Acts == nil {
+		return rows
+	}
+	for _, activity := range xml.Acts.Act {
+		for _, lap := range activity.Laps {
+			if lap.Trk == nil {
+				continue
+			}
+			for _, point := range lap.Trk.Pt {
+				if point.Time.IsZero() {
+					continue
+				}
+				// The trackpoints without position (e.g. the activities without GPS)
+				// have latitude and longitude equal to zero.
+				var latitude, longitude, altitude interface{}
+				if point.Lat != 0 || point.Long != 0 {
+					latitude, longitude, altitude = point.Lat, point.Long, point.Alt
+				}
+				rows = append(rows, []interface{}{
+					userID, logID, point.Time.UTC(), latitude, longitude, altitude, point.Dist, point.HR, point.Cad,
+				})
+			}
+		}
+	}
+	return rows
+}
+
+// noTCX returns true if err, returned by the Fitbit client, means that the activity has no TCX.
+// Fitbit has several problems with the TCX: a client error means there's no TCX to dump for the
+// activity, except the ones that don't depend on the activity: the rate limit, and the token or
+// the permission (the location scope) missing.
+func noTCX(err error) bool {
+	switch status := fitbitStatusCode(err); status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	default:
+		return status >= http.StatusBadRequest && status < http.StatusInternalServerError
+	}
+}
+
+// dumpTCX dumps the TCX of the activities of the user not dumped yet, starting from
+// the most recent, until the quota reserved to the TCX is exhausted.
+func (d *dumper) dumpTCX() error {
+	return d.dumpActivitiesTCX(nil)
+}
+
+// dumpActivitiesTCX dumps the TCX of the activities of the user not dumped yet, started on date
+// or, if date is nil, of all the activities. See dumpTCX.
+func (d *dumper) dumpActivitiesTCX(date *time.Time) (err error) {
+	condition := "user_id = ? AND NOT tcx_fetched AND log_type <> 'manual'"
+	args := []interface{}{d.User.ID}
+	if date != nil {
+		condition += " AND start_time::date = ?"
+		args = append(args, *date)
+	}
+	var logIDs []int64
+	if err = _db.Model(types.ActivityLog{}).Select("log_id").
+		Where(condition, args...).
+		Order("start_time DESC").Scan(&logIDs); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	columns := []string{"user_id", "activity_log_id", `"time"`, "latitude", "longitude", "altitude", "distance", "heart_rate", "cadence"}
+	for i, logID := range logIDs {
+		if !tcxQuotaAvailable(d.User.ID) {
+			log.Printf("dumpTCX: quota reserved to the TCX exhausted for user %d, %d activities left", d.User.ID, len(logIDs)-i)
+			return nil
+		}
+
+		var xml *tcx.TCXDB
+		if err = d.fetch(func() (err error) { xml, err = d.fb.UserActivityTCX(logID); return }); err != nil {
+			// Every other error is retried by the next synchronization
+			if !noTCX(err) {
+				return err
+			}
+			d.logError(err)
+		}
+
+		var text sql.NullString
+		if err == nil && xml != nil {
+			var textBytes []byte
+			if textBytes, err = tcx.ToBytes(*xml); err != nil {
+				return err
+			}
+			text = sql.NullString{String: string(textBytes), Valid: true}
+			if err = insertIntraday(types.ActivityTrackpoint{}, columns, trackpoints(d.User.ID, logID, xml)); err != nil {
+				return err
+			}
+		}
+
+		if err = _db.Model(types.ActivityLog{}).Exec(
+			"UPDATE activity_logs SET tcx = ?, tcx_fetched = true WHERE log_id = ?", text, logID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ActivityLog returns the activity of the user identified by logID.
+func (f *fetcher) ActivityLog(logID int64) (*types.ActivityLog, error) {
+	var activity types.ActivityLog
+	if err := _db.Model(types.ActivityLog{}).Where("log_id = ? AND user_id = ?", logID, f.user.ID).Scan(&activity); err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
+
+// ActivityTrackpoints returns the trackpoints of the activity of the user identified by logID,
+// in chronological order.
+func (f *fetcher) ActivityTrackpoints(logID int64) ([]types.ActivityTrackpoint, error) {
+	var rows []types.ActivityTrackpoint
+	if err := _db.Model(types.ActivityTrackpoint{}).Where("activity_log_id = ? AND user_id = ?", logID, f.user.ID).
+		Order(`"time"`).Scan(&rows); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return rows, nil
+}
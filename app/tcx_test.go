@@ -0,0 +1,99 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	fitbit_client "github.com/galeone/fitbit/v2/client"
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+func TestNoTCX(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&fitbit_client.ResponseError{StatusCode: 404, Message: "not found"}, true},
+		{&fitbit_client.ResponseError{StatusCode: 400, Message: "invalid activity"}, true},
+		{&fitbit_client.ResponseError{StatusCode: 429, Message: "too many requests"}, false},
+		{&fitbit_client.ResponseError{StatusCode: 401, Message: "expired token"}, false},
+		{&fitbit_client.ResponseError{StatusCode: 403, Message: "missing location scope"}, false},
+		{&fitbit_client.ResponseError{StatusCode: 500, Message: "internal error"}, false},
+		{fmt.Errorf("dump: %w", &fitbit_client.ResponseError{StatusCode: 404, Message: "not found"}), true},
+		{errors.New("connection reset by peer"), false},
+		{nil, false},
+	} {
+		if got := noTCX(tc.err); got != tc.want {
+			t.Errorf("noTCX(%v) = %t, want %t", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestDumpActivitiesTCX(t *testing.T) {
+	user := testDBUser(t)
+	day := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	logID := -user.ID * 1000
+	for _, startTime := range []time.Time{day.Add(7 * time.Hour), day.Add(18 * time.Hour), day.AddDate(0, 0, -1).Add(7 * time.Hour)} {
+		logID--
+		if err := _db.Exec(`INSERT INTO activity_logs(log_id, user_id, activity_name, last_modified, log_type, original_start_time, start_time)
+			VALUES (?, ?, 'Run', '', 'auto_detected', ?, ?)`, logID, user.ID, startTime, startTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Fitbit has no TCX: the activities are marked as fetched anyway
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousTransport := _fitbitTransport
+	_fitbitTransport = newFitbitTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.URL.Scheme, req.URL.Host = serverURL.Scheme, serverURL.Host
+		return http.DefaultTransport.RoundTrip(req)
+	}), &memoryQuotaStore{quotas: map[int64]*types.RateLimit{}})
+	t.Cleanup(func() { _fitbitTransport = previousTransport })
+
+	authorizer := newFitbitAuthorizer()
+	authorizer.SetToken(&user.AuthorizedUser.AuthorizedUser)
+	fb, err := fitbit_client.NewClient(authorizer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &dumper{fb, authorizer, user}
+	if err = d.dumpActivitiesTCX(&day); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the activities of the day, the most recent first
+	want := []string{fmt.Sprintf("/1/user/-/activities/%d.tcx", -user.ID*1000-2), fmt.Sprintf("/1/user/-/activities/%d.tcx", -user.ID*1000-1)}
+	if len(requested) != len(want) || requested[0] != want[0] || requested[1] != want[1] {
+		t.Errorf("TCX requested %v, want %v", requested, want)
+	}
+	var pending []int64
+	if err = _db.Model(types.ActivityLog{}).Select("log_id").Where("user_id = ? AND NOT tcx_fetched", user.ID).Scan(&pending); err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0] != -user.ID*1000-3 {
+		t.Errorf("activities %v without TCX, want only the activity of the previous day", pending)
+	}
+}
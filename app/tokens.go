@@ -0,0 +1,219 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	fitbit_client "github.com/galeone/fitbit/v2/client"
+	fitbit_types "github.com/galeone/fitbit/v2/types"
+	"github.com/galeone/fitsleepinsights/database/types"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"golang.org/x/oauth2"
+)
+
+// tokenRefreshMargin is how long before the expiration an access token is refreshed
+const tokenRefreshMargin = 5 * time.Minute
+
+// errReconsentRequired is returned when the refresh token of the user has been revoked.
+// The user must login again to give the permission to the app.
+var errReconsentRequired = errors.New("the refresh token has been revoked. Please login again")
+
+// _userTokenLocks are held while the token of the user is being refreshed, so
+// concurrent refreshes (e.g. a dump and a request) don't consume the same refresh token twice.
+var _userTokenLocks = newUserLocks()
+
+// userByAccessToken returns the user that owns the accessToken.
+// The access token can be the current one, or the one replaced by the last refresh,
+// since the cookie of the user may still contain it.
+func userByAccessToken(accessToken string) (*types.User, error) {
+	var user types.User
+	if err := _db.Model(types.User{}).Where("access_token = ? OR previous_access_token = ?", accessToken, accessToken).Scan(&user); err != nil {
+		return nil, err
+	}
+	if user.UserID == "" {
+		return nil, errors.New("invalid token. Please login again")
+	}
+	return &user, nil
+}
+
+// tokenIssued stores the expiration of the token just obtained by the user with the
+// authorization flow, and resets the reconsent flag.
+func tokenIssued(token *fitbit_types.AuthorizedUser) error {
+	return _db.Model(types.User{}).Exec(
+		"UPDATE oauth2_authorized SET token_expires_at = ?, reconsent_required = false WHERE user_id = ?",
+		time.Now().UTC().Add(time.Second*time.Duration(token.ExpiresIn)), token.UserID)
+}
+
+// tokenExpiring returns true if the access token of the user expires within tokenRefreshMargin.
+func tokenExpiring(user *types.User) bool {
+	return user.TokenExpiresAt.Valid && time.Now().UTC().Add(tokenRefreshMargin).After(user.TokenExpiresAt.Time)
+}
+
+// validToken returns the token of the user, refreshing it if it's expiring.
+func validToken(user *types.User) (*fitbit_types.AuthorizedUser, error) {
+	if user.ReconsentRequired {
+		return nil, errReconsentRequired
+	}
+	if tokenExpiring(user) {
+		if err := refreshToken(user, user.AccessToken); err != nil {
+			return nil, err
+		}
+	}
+	return &user.AuthorizedUser.AuthorizedUser, nil
+}
+
+// tokenStore persists the tokens of the users.
+type tokenStore interface {
+	// User returns the stored user with the ID.
+	User(id int64) (*types.User, error)
+	// SaveToken stores the token of the user obtained with a refresh, that replaces
+	// previousAccessToken, and resets the reconsent flag.
+	SaveToken(userID int64, token *fitbit_types.AuthorizedUser, expiresAt time.Time, previousAccessToken string) error
+	// RequireReconsent marks the user as reconsent required.
+	RequireReconsent(userID int64) error
+}
+
+// dbTokenStore is the tokenStore backed by the oauth2_authorized table.
+type dbTokenStore struct{}
+
+// _tokenStore stores the tokens refreshed by refreshToken.
+var _tokenStore tokenStore = dbTokenStore{}
+
+func (dbTokenStore) User(id int64) (*types.User, error) {
+	user := types.User{}
+	user.ID = id
+	if err := _db.Model(types.User{}).Where(&user).Scan(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (dbTokenStore) SaveToken(userID int64, token *fitbit_types.AuthorizedUser, expiresAt time.Time, previousAccessToken string) error {
+	if err := _db.UpsertAuthorizedUser(token); err != nil {
+		return err
+	}
+	return _db.Model(types.User{}).Exec(
+		"UPDATE oauth2_authorized SET token_expires_at = ?, previous_access_token = ?, reconsent_required = false WHERE id = ?",
+		expiresAt, previousAccessToken, userID)
+}
+
+func (dbTokenStore) RequireReconsent(userID int64) error {
+	return _db.Model(types.User{}).Exec("UPDATE oauth2_authorized SET reconsent_required = true WHERE id = ?", userID)
+}
+
+// refreshToken exchanges the refresh token of the user for a new pair of tokens, and stores them.
+// expiredAccessToken is the access token the caller wants to replace: if the stored access token
+// is different, another caller already refreshed it and user is just updated with the stored values.
+// If the refresh token has been revoked, the user is marked as reconsent required.
+func refreshToken(user *types.User, expiredAccessToken string) (err error) {
+	mu := _userTokenLocks.get(user.ID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	var stored *types.User
+	if stored, err = _tokenStore.User(user.ID); err != nil {
+		return err
+	}
+	if stored.ReconsentRequired {
+		*user = *stored
+		return errReconsentRequired
+	}
+	if stored.AccessToken != expiredAccessToken {
+		*user = *stored
+		return nil
+	}
+
+	// The token request goes through the client of the authorizer: it has a timeout
+	authorizer := newFitbitAuthorizer()
+	authorizer.SetToken(&stored.AuthorizedUser.AuthorizedUser)
+	var token *fitbit_types.AuthorizedUser
+	if token, err = authorizer.RefreshToken(); err != nil {
+		if !refreshTokenRevoked(err) {
+			return err
+		}
+		log.Printf("Refresh token of user %d revoked: %s", user.ID, err)
+		if err = _tokenStore.RequireReconsent(user.ID); err != nil {
+			return err
+		}
+		stored.ReconsentRequired = true
+		*user = *stored
+		return errReconsentRequired
+	}
+
+	expiresAt := time.Now().UTC().Add(time.Second * time.Duration(token.ExpiresIn))
+	if err = _tokenStore.SaveToken(user.ID, token, expiresAt, stored.AccessToken); err != nil {
+		return err
+	}
+
+	stored.PreviousAccessToken = stored.AccessToken
+	stored.AuthorizedUser.AuthorizedUser = *token
+	stored.TokenExpiresAt.Time = expiresAt
+	stored.TokenExpiresAt.Valid = true
+	stored.ReconsentRequired = false
+	*user = *stored
+	log.Printf("Access token of user %d refreshed", user.ID)
+	return nil
+}
+
+// refreshTokenRevoked returns true if err, returned by the refresh of the tokens, means that the
+// refresh token has been revoked, or it's invalid: the user must login again.
+func refreshTokenRevoked(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		return false
+	}
+	unexpected := fitbit_types.OAuth2Error{}
+	if json.Unmarshal(retrieveErr.Body, &unexpected) != nil {
+		return false
+	}
+	for _, apiError := range unexpected.Errors {
+		if apiError.ErrorType == "invalid_grant" || apiError.ErrorType == "invalid_token" {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnauthorized returns true if err is the error returned by the Fitbit client
+// when the access token is expired or invalid.
+func isUnauthorized(err error) bool {
+	return fitbitStatusCode(err) == http.StatusUnauthorized
+}
+
+// fitbitStatusCode returns the status code of the error returned by the Fitbit client when
+// the Fitbit API answers with an error, 0 for the other errors.
+func fitbitStatusCode(err error) int {
+	var resErr *fitbit_client.ResponseError
+	if errors.As(err, &resErr) {
+		return resErr.StatusCode
+	}
+	return 0
+}
+
+// setTokenCookie sets the "token" cookie, containing the access token that identifies the user.
+func setTokenCookie(c echo.Context, token *fitbit_types.AuthorizedUser) {
+	c.SetCookie(&http.Cookie{
+		Name:     "token",
+		Value:    token.AccessToken,
+		Domain:   _domain,
+		Expires:  time.Now().Add(time.Second * time.Duration(token.ExpiresIn)),
+		HttpOnly: true,
+	})
+}
+
+// Reconsent renders the page that asks the user to give again the permission to the app.
+func Reconsent() echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		return c.Render(http.StatusOK, "reconsent", echo.Map{
+			"title":      "Login again - FitSleepInsights",
+			"isLoggedIn": false,
+		})
+	}
+}
@@ -0,0 +1,250 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	fitbit_pgdb "github.com/galeone/fitbit-pgdb/v3"
+	fitbit_client "github.com/galeone/fitbit/v2/client"
+	fitbit_types "github.com/galeone/fitbit/v2/types"
+	"github.com/galeone/fitsleepinsights/database/types"
+)
+
+// memoryTokenStore is a tokenStore in memory.
+type memoryTokenStore struct {
+	mu    sync.Mutex
+	users map[int64]types.User
+}
+
+func (s *memoryTokenStore) User(id int64) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, errors.New("no user")
+	}
+	return &user, nil
+}
+
+func (s *memoryTokenStore) SaveToken(userID int64, token *fitbit_types.AuthorizedUser, expiresAt time.Time, previousAccessToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.users[userID]
+	user.AuthorizedUser.AuthorizedUser = *token
+	user.TokenExpiresAt.Time = expiresAt
+	user.TokenExpiresAt.Valid = true
+	user.PreviousAccessToken = previousAccessToken
+	user.ReconsentRequired = false
+	s.users[userID] = user
+	return nil
+}
+
+func (s *memoryTokenStore) RequireReconsent(userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.users[userID]
+	user.ReconsentRequired = true
+	s.users[userID] = user
+	return nil
+}
+
+// stubTokenServer is the Fitbit OAuth2 token endpoint. It exchanges the refresh token "refresh-<N>"
+// for the access token "access-<N+1>" and the refresh token "refresh-<N+1>", and refuses the
+// refresh token "revoked" as Fitbit does.
+type stubTokenServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+}
+
+func newStubTokenServer() *stubTokenServer {
+	server := &stubTokenServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/token" || r.FormValue("grant_type") != "refresh_token" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		refreshToken := r.FormValue("refresh_token")
+		server.mu.Lock()
+		server.requests = append(server.requests, refreshToken)
+		server.mu.Unlock()
+		// The concurrent refreshes of the user are waiting meanwhile
+		time.Sleep(10 * time.Millisecond)
+
+		w.Header().Set("Content-Type", "application/json")
+		var n int
+		if _, err := fmt.Sscanf(refreshToken, "refresh-%d", &n); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors":[{"errorType":"invalid_grant","message":"Refresh token invalid: revoked"}],"success":false}`)
+			return
+		}
+		next := strconv.Itoa(n + 1)
+		fmt.Fprintf(w, `{"access_token":"access-%s","expires_in":28800,"refresh_token":"refresh-%s","scope":"sleep","token_type":"Bearer","user_id":"ABC"}`, next, next)
+	}))
+	return server
+}
+
+// Requests returns the refresh tokens received by the server.
+func (s *stubTokenServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// testTokens sends the requests of the Fitbit clients to the server, and stores the tokens of the
+// user with the refresh token in memory, until the end of the test.
+func testTokens(t *testing.T, server *stubTokenServer, refreshToken string) (*memoryTokenStore, *types.User) {
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousTransport, previousStore := _fitbitTransport, _tokenStore
+	_fitbitTransport = newFitbitTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.URL.Scheme, req.URL.Host = serverURL.Scheme, serverURL.Host
+		return http.DefaultTransport.RoundTrip(req)
+	}), &memoryQuotaStore{quotas: map[int64]*types.RateLimit{}})
+
+	user := types.User{AuthorizedUser: fitbit_pgdb.AuthorizedUser{ID: 1}}
+	user.UserID = "ABC"
+	user.AccessToken = "access-1"
+	user.RefreshToken = refreshToken
+	user.ExpiresIn = 60
+	store := &memoryTokenStore{users: map[int64]types.User{user.ID: user}}
+	_tokenStore = store
+	t.Cleanup(func() { _fitbitTransport, _tokenStore = previousTransport, previousStore })
+	return store, &user
+}
+
+func TestRefreshToken(t *testing.T) {
+	server := newStubTokenServer()
+	defer server.Close()
+	store, user := testTokens(t, server, "refresh-1")
+
+	if err := refreshToken(user, "access-1"); err != nil {
+		t.Fatal(err)
+	}
+	if user.AccessToken != "access-2" || user.RefreshToken != "refresh-2" || user.PreviousAccessToken != "access-1" {
+		t.Errorf("access token %s, refresh token %s, previous access token %s: want access-2, refresh-2, access-1",
+			user.AccessToken, user.RefreshToken, user.PreviousAccessToken)
+	}
+	if expiresIn := time.Until(user.TokenExpiresAt.Time); expiresIn < 7*time.Hour || expiresIn > 8*time.Hour {
+		t.Errorf("the access token expires in %s, want 8 hours", expiresIn)
+	}
+	if stored, _ := store.User(user.ID); stored.AccessToken != user.AccessToken || stored.UserID != "ABC" {
+		t.Errorf("stored access token %s of the user %s, want %s of ABC", stored.AccessToken, stored.UserID, user.AccessToken)
+	}
+	if requests := server.Requests(); len(requests) != 1 || requests[0] != "refresh-1" {
+		t.Errorf("refresh tokens sent %v, want [refresh-1]", requests)
+	}
+}
+
+func TestRefreshTokenConcurrent(t *testing.T) {
+	server := newStubTokenServer()
+	defer server.Close()
+	_, user := testTokens(t, server, "refresh-1")
+
+	// A dump and the requests of the user find the same access token expired
+	var wg sync.WaitGroup
+	users := make([]types.User, 5)
+	errs := make([]error, len(users))
+	for i := range users {
+		users[i] = *user
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = refreshToken(&users[i], "access-1")
+		}(i)
+	}
+	wg.Wait()
+
+	// The refresh token can be used once: the others use the token of the first refresh
+	if requests := server.Requests(); len(requests) != 1 {
+		t.Errorf("refresh tokens sent %v, want only one refresh", requests)
+	}
+	for i := range users {
+		if errs[i] != nil {
+			t.Errorf("refresh %d: %s", i, errs[i])
+		} else if users[i].AccessToken != "access-2" {
+			t.Errorf("refresh %d: access token %s, want access-2", i, users[i].AccessToken)
+		}
+	}
+}
+
+func TestRefreshTokenRevoked(t *testing.T) {
+	server := newStubTokenServer()
+	defer server.Close()
+	store, user := testTokens(t, server, "revoked")
+
+	if err := refreshToken(user, "access-1"); !errors.Is(err, errReconsentRequired) {
+		t.Fatalf("refreshToken() = %v, want errReconsentRequired", err)
+	}
+	if stored, _ := store.User(user.ID); !stored.ReconsentRequired || !user.ReconsentRequired {
+		t.Error("the user is not marked as reconsent required")
+	}
+	// Until the user logs in again, the refresh token is not sent anymore
+	sent := len(server.Requests())
+	if _, err := validToken(user); !errors.Is(err, errReconsentRequired) {
+		t.Errorf("validToken() = %v, want errReconsentRequired", err)
+	}
+	if err := refreshToken(user, "access-1"); !errors.Is(err, errReconsentRequired) {
+		t.Errorf("refreshToken() = %v, want errReconsentRequired", err)
+	}
+	if len(server.Requests()) != sent {
+		t.Errorf("the revoked refresh token has been sent again")
+	}
+}
+
+func TestDumperFetch(t *testing.T) {
+	server := newStubTokenServer()
+	defer server.Close()
+	_, user := testTokens(t, server, "refresh-1")
+
+	authorizer := newFitbitAuthorizer()
+	authorizer.SetToken(&user.AuthorizedUser.AuthorizedUser)
+	fb, err := fitbit_client.NewClient(authorizer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &dumper{fb, authorizer, user}
+
+	// The access token expires before its time: the call is sent again with the new token
+	var tokens []string
+	err = d.fetch(func() error {
+		tokens = append(tokens, d.User.AccessToken)
+		if d.User.AccessToken == "access-1" {
+			return fmt.Errorf("fetching the sleep logs: %w", &fitbit_client.ResponseError{StatusCode: http.StatusUnauthorized})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens[1] != "access-2" {
+		t.Errorf("calls with the access tokens %v, want [access-1 access-2]", tokens)
+	}
+
+	// The other errors are returned without refreshing the token
+	sent := len(server.Requests())
+	forbidden := &fitbit_client.ResponseError{StatusCode: http.StatusForbidden}
+	if err = d.fetch(func() error { return forbidden }); err != forbidden {
+		t.Errorf("fetch() = %v, want %v", err, forbidden)
+	}
+	if fitbitStatusCode(err) != http.StatusForbidden || isUnauthorized(err) {
+		t.Errorf("status code %d of %v, want %d", fitbitStatusCode(err), err, http.StatusForbidden)
+	}
+	if len(server.Requests()) != sent {
+		t.Error("the token has been refreshed after a 403")
+	}
+}
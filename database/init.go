@@ -63,11 +63,28 @@ var (
 
 	//go:embed schema/llm.sql
 	llm string
+
+	//go:embed schema/sync.sql
+	sync string
+
+	//go:embed schema/subscriptions.sql
+	subscriptions string
+
+	//go:embed schema/rate_limits.sql
+	rateLimits string
+
+	//go:embed schema/backfill.sql
+	backfill string
+
+	//go:embed schema/dump_jobs.sql
+	dumpJobs string
 )
 
-func init() {
-	// Database instance only local to this init function, used to initialize the database and the application startup.
-	// The global database instance is initialized in app/globals.go.
+// Init creates the schema of the database, and applies the migrations.
+// It must be called once, at the application startup, before app.Init.
+func Init() {
+	// Database instance only local to this function, used to initialize the database at the application startup.
+	// The global database instance is initialized by app.Init.
 	var db *igor.Database
 	var err error
 
@@ -175,6 +192,31 @@ func init() {
 		panic(err.Error())
 	}
 
+	if err = tx.Exec(sync); err != nil {
+		_ = tx.Rollback()
+		panic(err.Error())
+	}
+
+	if err = tx.Exec(subscriptions); err != nil {
+		_ = tx.Rollback()
+		panic(err.Error())
+	}
+
+	if err = tx.Exec(rateLimits); err != nil {
+		_ = tx.Rollback()
+		panic(err.Error())
+	}
+
+	if err = tx.Exec(backfill); err != nil {
+		_ = tx.Rollback()
+		panic(err.Error())
+	}
+
+	if err = tx.Exec(dumpJobs); err != nil {
+		_ = tx.Rollback()
+		panic(err.Error())
+	}
+
 	if err = tx.Commit(); err != nil {
 		panic(err.Error())
 	}
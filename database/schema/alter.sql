@@ -34,4 +34,27 @@ CREATE INDEX IF NOT EXISTS minutes_in_heart_rate_zone_idx ON minutes_in_heart_ra
 -- sleep indexes
 CREATE INDEX IF NOT EXISTS sleep_data_idx ON sleep_data (sleep_log_id);
 CREATE INDEX IF NOT EXISTS sleep_logs_idx ON sleep_logs (date_of_sleep, user_id);
-CREATE INDEX IF NOT EXISTS sleep_stage_details_idx ON sleep_stage_details (sleep_log_id);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS sleep_stage_details_idx ON sleep_stage_details (sleep_log_id);
+-- token management
+-- token_expires_at is the expiration time of the access token (null if unknown)
+-- previous_access_token is the access token replaced by the last refresh: the cookies of the users can still contain it
+-- reconsent_required is true when the refresh token has been revoked and the user must login again
+ALTER TABLE oauth2_authorized ADD COLUMN IF NOT EXISTS token_expires_at timestamp without time zone;
+ALTER TABLE oauth2_authorized ADD COLUMN IF NOT EXISTS previous_access_token TEXT not null default '';
+ALTER TABLE oauth2_authorized ADD COLUMN IF NOT EXISTS reconsent_required BOOLEAN not null default false;
+CREATE INDEX IF NOT EXISTS oauth2_authorized_previous_access_token_idx ON oauth2_authorized (previous_access_token);
+-- intraday
+-- a single row for every user and minute (day, for the breathing rate): the dump skips the rows already present
+ALTER TABLE breathing_rate_intraday ADD COLUMN IF NOT EXISTS "date" date;
+CREATE UNIQUE INDEX IF NOT EXISTS calories_series_intraday_idx ON calories_series_intraday (user_id, date_time);
+CREATE UNIQUE INDEX IF NOT EXISTS distance_series_intraday_idx ON distance_series_intraday (user_id, date_time);
+CREATE UNIQUE INDEX IF NOT EXISTS elevation_series_intraday_idx ON elevation_series_intraday (user_id, date_time);
+CREATE UNIQUE INDEX IF NOT EXISTS floors_series_intraday_idx ON floors_series_intraday (user_id, date_time);
+CREATE UNIQUE INDEX IF NOT EXISTS steps_series_intraday_idx ON steps_series_intraday (user_id, date_time);
+CREATE UNIQUE INDEX IF NOT EXISTS heart_rate_intraday_idx ON heart_rate_intraday (user_id, date_time);
+CREATE UNIQUE INDEX IF NOT EXISTS oxygen_saturation_intraday_idx ON oxygen_saturation_intraday (user_id, date_time);
+CREATE UNIQUE INDEX IF NOT EXISTS heart_rate_variability_intraday_hrv_idx ON heart_rate_variability_intraday_hrv (user_id, date_time);
+CREATE UNIQUE INDEX IF NOT EXISTS breathing_rate_intraday_idx ON breathing_rate_intraday (user_id, "date");
+-- TCX
+ALTER TABLE activity_logs ADD COLUMN IF NOT EXISTS tcx_fetched bool not null default false;
+CREATE INDEX IF NOT EXISTS activity_trackpoints_idx ON activity_trackpoints (activity_log_id, "time");
@@ -0,0 +1,15 @@
+-- backfill_cursors stores, per user and per group of data types, the progress of the
+-- historical backfill, that walks backwards in time from the oldest data dumped.
+-- cursor_date is the oldest date backfilled, empty_days the number of consecutive days
+-- (going backwards) without data. The backfill of the group is completed when Fitbit
+-- has no more data.
+create table if not exists backfill_cursors(
+    id bigserial primary key not null,
+    user_id bigint not null references oauth2_authorized(id),
+    data_type text not null,
+    cursor_date date not null,
+    empty_days bigint not null default 0,
+    completed boolean not null default false,
+    updated_at timestamp without time zone not null default (now() at time zone 'utc'),
+    unique(user_id, data_type)
+);
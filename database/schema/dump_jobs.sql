@@ -0,0 +1,16 @@
+-- dump_jobs stores the progress of the last dump of every data type (table name) of the user.
+-- status is one of: pending, running, completed, failed.
+-- start_date and end_date are the range of dates covered by the dump (null if not applicable),
+-- rows the number of rows of the user in the table in that range (all the rows, if not applicable).
+create table if not exists dump_jobs(
+    id bigserial primary key not null,
+    user_id bigint not null references oauth2_authorized(id),
+    data_type text not null,
+    status text not null default 'pending',
+    start_date date,
+    end_date date,
+    rows bigint not null default 0,
+    error text not null default '',
+    updated_at timestamp without time zone not null default (now() at time zone 'utc'),
+    unique(user_id, data_type)
+);
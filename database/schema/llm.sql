@@ -9,4 +9,83 @@ CREATE TABLE IF NOT EXISTS reports (
     report_type TEXT NOT NULL,
     report TEXT NOT NULL,
     embedding VECTOR
-);
\ No newline at end of file
+);
+
+-- The embeddings of different models are not comparable: every report stores the
+-- model and the dimension of its embedding. The reports embedded before these columns
+-- existed have been embedded with text-embedding-005.
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS embedding_model TEXT NOT NULL DEFAULT '';
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS embedding_dim INTEGER NOT NULL DEFAULT 0;
+UPDATE reports SET embedding_model = 'text-embedding-005', embedding_dim = vector_dims(embedding)
+WHERE embedding_model = '' AND embedding IS NOT NULL;
+CREATE INDEX IF NOT EXISTS reports_embedding_model_idx ON reports (user_id, embedding_model);
+-- The column stores the embeddings of every model, thus it has no fixed dimension:
+-- embedding_dim is the dimension of the embedding of every row.
+DO $$ BEGIN
+    ALTER TABLE reports ADD CONSTRAINT reports_embedding_dim_check
+    CHECK (embedding IS NULL OR vector_dims(embedding) = embedding_dim);
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+-- An HNSW index requires a vector with a fixed dimension: there is an index per dimension,
+-- on the embeddings of that dimension casted to vector(dimension). The similarity search
+-- uses the same expression. The dimensions are the ones of the common embedding models
+-- (e.g. all-minilm, text-embedding-005, nomic-embed-text, mxbai-embed-large, text-embedding-3-small).
+-- The embeddings of the other dimensions are searched without index.
+CREATE INDEX IF NOT EXISTS reports_embedding_384_idx ON reports
+USING hnsw ((embedding::vector(384)) vector_l2_ops) WHERE embedding_dim = 384;
+CREATE INDEX IF NOT EXISTS reports_embedding_768_idx ON reports
+USING hnsw ((embedding::vector(768)) vector_l2_ops) WHERE embedding_dim = 768;
+CREATE INDEX IF NOT EXISTS reports_embedding_1024_idx ON reports
+USING hnsw ((embedding::vector(1024)) vector_l2_ops) WHERE embedding_dim = 1024;
+CREATE INDEX IF NOT EXISTS reports_embedding_1536_idx ON reports
+USING hnsw ((embedding::vector(1536)) vector_l2_ops) WHERE embedding_dim = 1536;
+
+-- The conversations of the chat with the data of a date range, and their messages.
+-- The messages are the questions of the user and the replies of the model: the system
+-- prompt and the reports retrieved for every question are not stored.
+CREATE TABLE IF NOT EXISTS conversations (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES oauth2_authorized(id),
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    title TEXT NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'utc'),
+    updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'utc')
+);
+CREATE INDEX IF NOT EXISTS conversations_idx ON conversations (user_id, start_date, end_date);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id BIGSERIAL PRIMARY KEY,
+    conversation_id BIGINT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    role TEXT NOT NULL, -- user, model
+    content TEXT NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'utc')
+);
+CREATE INDEX IF NOT EXISTS messages_idx ON messages (conversation_id, id);
+
+-- The reports cited by a reply of the model. The label is the number of the report
+-- in the context of the question, used by the reply to cite it (e.g. [1]).
+CREATE TABLE IF NOT EXISTS message_sources (
+    message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    report_id INTEGER NOT NULL REFERENCES reports(id) ON DELETE CASCADE,
+    label INTEGER NOT NULL,
+    PRIMARY KEY(message_id, label)
+);
+
+-- The queue of the reports to generate. A job for every report (user, type, first day):
+-- the reports are generated in background by the workers of the ReportQueue, that claim
+-- the jobs with SKIP LOCKED. The failed jobs are retried with an exponential backoff.
+CREATE TABLE IF NOT EXISTS report_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES oauth2_authorized(id),
+    report_type TEXT NOT NULL, -- daily, weekly, monthly
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, running, done, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    run_after TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'utc'),
+    error TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'utc'),
+    UNIQUE(user_id, report_type, start_date)
+);
+CREATE INDEX IF NOT EXISTS report_jobs_queue_idx ON report_jobs (status, run_after);
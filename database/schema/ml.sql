@@ -4,4 +4,71 @@ create table if not exists predictors(
     target text not null,
     endpoint text not null,
     created_at timestamp not null default now()
-);
\ No newline at end of file
+);
+
+-- The predictors are trained in process (backend local) and stored in the model column,
+-- or trained and deployed on Vertex AI (backend vertex) and served by the endpoint.
+alter table predictors add column if not exists backend text not null default 'vertex';
+alter table predictors add column if not exists model text not null default '';
+-- The local predictors have no endpoint
+alter table predictors alter column endpoint set default '';
+
+-- Registry of the predictors: every training of a target creates a new version of the predictor
+-- of the user. Only the active version serves the predictions: the previous versions are retired,
+-- and can be activated again (rollback). The metrics are computed on the most recent days (hold-out),
+-- excluded from the training of the evaluated model.
+alter table predictors add column if not exists version integer not null default 1;
+alter table predictors add column if not exists status text not null default 'active'; -- active, retired
+alter table predictors add column if not exists features text not null default ''; -- comma separated
+alter table predictors add column if not exists training_start date;
+alter table predictors add column if not exists training_end date;
+alter table predictors add column if not exists training_rows integer not null default 0;
+alter table predictors add column if not exists holdout_rows integer not null default 0;
+alter table predictors add column if not exists mae double precision not null default 0;
+alter table predictors add column if not exists rmse double precision not null default 0;
+
+-- The predictors created before the registry are versioned in order of creation,
+-- and only the most recent active version stays active.
+update predictors set version = numbered.version
+from (
+    select id, row_number() over (partition by user_id, target order by created_at, id) as version from predictors
+) numbered
+where predictors.id = numbered.id and predictors.version <> numbered.version;
+update predictors set status = 'retired'
+where status = 'active' and exists (
+    select 1 from predictors newer
+    where newer.user_id = predictors.user_id and newer.target = predictors.target
+    and newer.status = 'active' and newer.version > predictors.version
+);
+create unique index if not exists predictors_version_idx on predictors(user_id, target, version);
+
+-- Walk-forward backtests of the predictors: for every day of the history (after the first
+-- days, required to train), a model trained only on the previous days predicts the day.
+-- The scores compare the model with naive baselines, computed on the same days.
+create table if not exists backtests(
+    id bigserial primary key not null,
+    user_id bigint not null references oauth2_authorized(id),
+    target text not null,
+    start_date date not null, -- first predicted day
+    end_date date not null, -- last predicted day
+    days integer not null, -- number of predicted days
+    step integer not null, -- days predicted by every trained model
+    created_at timestamp not null default now()
+);
+
+create index if not exists backtests_user_target_idx on backtests(user_id, target, created_at);
+
+create table if not exists backtest_scores(
+    id bigserial primary key not null,
+    backtest_id bigint not null references backtests(id) on delete cascade,
+    method text not null, -- model, previous_night, mean_7_days
+    mae double precision not null default 0,
+    rmse double precision not null default 0,
+    accuracy double precision not null default 0, -- percentage of the days predicted within the tolerance
+    unique(backtest_id, method)
+);
+
+-- igor leaves the zero scores (e.g. a perfect MAE, or no accurate day) out of the INSERT
+alter table backtest_scores alter column mae set default 0;
+alter table backtest_scores alter column rmse set default 0;
+alter table backtest_scores alter column accuracy set default 0;
@@ -0,0 +1,9 @@
+-- fitbit_rate_limits stores the state of the Fitbit API hourly quota of every user,
+-- as reported by the Fitbit-Rate-Limit-* headers of the last response received.
+create table if not exists fitbit_rate_limits(
+    user_id bigint primary key not null references oauth2_authorized(id),
+    quota_limit bigint not null default 0,
+    remaining bigint not null default 0,
+    reset_at timestamp without time zone not null,
+    updated_at timestamp without time zone not null
+);
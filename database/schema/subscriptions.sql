@@ -0,0 +1,10 @@
+-- fitbit_subscriptions stores the Fitbit Subscriptions API subscriptions
+-- registered for every user. One subscription per collection.
+create table if not exists fitbit_subscriptions(
+    id bigserial primary key not null,
+    user_id bigint not null references oauth2_authorized(id),
+    collection_type text not null,
+    subscription_id text not null unique,
+    created_at timestamp without time zone not null default (now() at time zone 'utc'),
+    unique(user_id, collection_type)
+);
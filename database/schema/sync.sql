@@ -0,0 +1,12 @@
+-- sync_status stores, per user and per data type (table name), the outcome
+-- of the last background synchronization with the Fitbit API.
+-- The data type "all" contains the outcome of the whole synchronization.
+create table if not exists sync_status(
+    id bigserial primary key not null,
+    user_id bigint not null references oauth2_authorized(id),
+    data_type text not null,
+    last_success timestamp without time zone,
+    last_failure timestamp without time zone,
+    last_error text not null default '',
+    unique(user_id, data_type)
+);
@@ -86,7 +86,23 @@ create table if not exists activity_logs(
     start_time timestamp without time zone not null,
     steps bigint not null default 0,
     -- the api returns a tcx_link, that we fetch and insert here
-    tcx xml -- nullable (for manual inserted activities)
+    tcx xml, -- nullable (for manual inserted activities)
+    tcx_fetched bool not null default false -- true once the TCX has been requested
+);
+
+-- the trackpoints of the TCX of the activities
+create table if not exists activity_trackpoints(
+    id bigserial primary key not null,
+    user_id bigint not null references oauth2_authorized(id),
+    activity_log_id bigint not null references activity_logs(log_id) on delete cascade,
+    "time" timestamp without time zone not null,
+    latitude double precision, -- nullable (e.g. treadmill: no GPS)
+    longitude double precision, -- nullable
+    altitude double precision, -- nullable
+    distance double precision not null default 0,
+    heart_rate double precision not null default 0,
+    cadence double precision not null default 0,
+    unique(activity_log_id, "time")
 );
 
 /*
@@ -43,6 +43,13 @@ create table if not exists steps_series_intraday(
     value double precision not null default 0
 );
 
+create table if not exists heart_rate_intraday(
+    id bigserial primary key not null,
+    user_id bigint not null references oauth2_authorized(id),
+    date_time timestamp without time zone not null,
+    value double precision not null default 0
+);
+
 create table if not exists oxygen_saturation_intraday(
     id bigserial primary key not null,
     user_id bigint not null references oauth2_authorized(id),
@@ -63,6 +70,7 @@ create table if not exists heart_rate_variability_intraday_hrv(
 create table if not exists breathing_rate_intraday(
     id bigserial primary key not null,
     user_id bigint not null references oauth2_authorized(id),
+    "date" date,
     deep_sleep_summary double precision not null default 0,
     full_sleep_summary double precision not null default 0,
     light_sleep_summary double precision not null default 0,
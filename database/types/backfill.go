@@ -0,0 +1,28 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package types
+
+import (
+	"time"
+
+	pgdb "github.com/galeone/fitbit-pgdb/v3"
+)
+
+// BackfillCursor is the progress of the historical backfill of a group of
+// data types for the user.
+type BackfillCursor struct {
+	ID         int64               `igor:"primary_key"`
+	User       pgdb.AuthorizedUser `sql:"-"`
+	UserID     int64
+	DataType   string
+	CursorDate time.Time
+	EmptyDays  int64
+	Completed  bool `sql:"default:false"`
+	UpdatedAt  time.Time
+}
+
+func (BackfillCursor) TableName() string {
+	return "backfill_cursors"
+}
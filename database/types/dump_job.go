@@ -0,0 +1,30 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package types
+
+import (
+	"database/sql"
+	"time"
+
+	pgdb "github.com/galeone/fitbit-pgdb/v3"
+)
+
+// DumpJob is the progress of the dump of a data type (table name) for the user.
+type DumpJob struct {
+	ID        int64               `igor:"primary_key"`
+	User      pgdb.AuthorizedUser `sql:"-"`
+	UserID    int64
+	DataType  string
+	Status    string
+	StartDate sql.NullTime
+	EndDate   sql.NullTime
+	Rows      int64
+	Error     string
+	UpdatedAt time.Time
+}
+
+func (DumpJob) TableName() string {
+	return "dump_jobs"
+}
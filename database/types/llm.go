@@ -14,8 +14,73 @@ type Report struct {
 	ReportType string
 	Report     string
 	Embedding  pgvector.Vector
+	// EmbeddingModel and EmbeddingDim are the model that generated the embedding, and its dimension
+	EmbeddingModel string
+	EmbeddingDim   int64
 }
 
 func (r *Report) TableName() string {
 	return "reports"
 }
+
+// Conversation is a conversation of the user with the chat, about the data of a date range.
+type Conversation struct {
+	ID        int64 `igor:"primary_key"`
+	UserID    int64
+	StartDate time.Time
+	EndDate   time.Time
+	// Title is the first question of the user, truncated
+	Title     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (Conversation) TableName() string {
+	return "conversations"
+}
+
+// Message is a message of a conversation: a question of the user or a reply of the model.
+type Message struct {
+	ID             int64 `igor:"primary_key"`
+	ConversationID int64
+	// Role is "user" or "model"
+	Role      string
+	Content   string
+	CreatedAt time.Time
+}
+
+func (Message) TableName() string {
+	return "messages"
+}
+
+// MessageSource is a report cited by a reply of the model.
+type MessageSource struct {
+	MessageID int64
+	ReportID  int64
+	// Label is the number used by the reply to cite the report
+	Label int64
+}
+
+func (MessageSource) TableName() string {
+	return "message_sources"
+}
+
+// ReportJob is the generation of a report, queued to be executed in background.
+type ReportJob struct {
+	ID         int64 `igor:"primary_key"`
+	UserID     int64
+	ReportType string
+	StartDate  time.Time
+	EndDate    time.Time
+	// Status is pending, running, done or failed
+	Status   string
+	Attempts int64
+	// RunAfter is the time after which the job can be executed (again)
+	RunAfter  time.Time
+	Error     string
+	UpdatedAt time.Time
+}
+
+func (ReportJob) TableName() string {
+	return "report_jobs"
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"database/sql"
 	"time"
 
 	pgdb "github.com/galeone/fitbit-pgdb/v3"
@@ -9,7 +10,11 @@ import (
 // Predictor is a struct containing the information about the predictors
 // created for the user.
 // The target column is the target variable the model has been trained to predict.
-// Endpoint is the endpoint of the model.
+// Endpoint is the endpoint of the model, deployed on Vertex AI (backend vertex).
+// Model is the model trained in process (backend local), serialized in JSON. For the backend vertex,
+// it's the spec of the features added to the training data, to compute them again in the predictions.
+// Every training creates a new Version: only the active one (Status) serves the predictions.
+// The metrics (MAE, RMSE) are measured on the HoldoutRows most recent days of the training range.
 type Predictor struct {
 	ID        int64               `igor:"primary_key"`
 	User      pgdb.AuthorizedUser `sql:"-"`
@@ -17,8 +22,54 @@ type Predictor struct {
 	CreatedAt time.Time
 	Target    string
 	Endpoint  string
+	Backend   string
+	Model     string
+	Version   int64
+	Status    string
+	// Features are the comma separated columns used by the model
+	Features      string
+	TrainingStart sql.NullTime
+	TrainingEnd   sql.NullTime
+	TrainingRows  int64
+	HoldoutRows   int64
+	MAE           float64
+	RMSE          float64
 }
 
 func (Predictor) TableName() string {
 	return "predictors"
 }
+
+// Backtest is a walk-forward evaluation of the predictor of the target: every day between
+// StartDate and EndDate has been predicted by a model trained on the previous days only.
+// Every model predicts Step days, then a new model is trained.
+type Backtest struct {
+	ID        int64               `igor:"primary_key"`
+	User      pgdb.AuthorizedUser `sql:"-"`
+	UserID    int64
+	Target    string
+	StartDate time.Time
+	EndDate   time.Time
+	Days      int64
+	Step      int64
+	CreatedAt time.Time
+}
+
+func (Backtest) TableName() string {
+	return "backtests"
+}
+
+// BacktestScore is the score of a method (the model, or a naive baseline) in a backtest.
+// Accuracy is the percentage of the days predicted within the tolerance of the backtest.
+type BacktestScore struct {
+	ID         int64 `igor:"primary_key"`
+	BacktestID int64
+	Method     string
+	MAE        float64
+	RMSE       float64
+	Accuracy   float64
+}
+
+func (BacktestScore) TableName() string {
+	return "backtest_scores"
+}
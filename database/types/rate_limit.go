@@ -0,0 +1,22 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package types
+
+import (
+	"time"
+)
+
+// RateLimit is the state of the Fitbit API hourly quota of the user.
+type RateLimit struct {
+	UserID     int64 `igor:"primary_key"`
+	QuotaLimit int64
+	Remaining  int64
+	ResetAt    time.Time
+	UpdatedAt  time.Time
+}
+
+func (RateLimit) TableName() string {
+	return "fitbit_rate_limits"
+}
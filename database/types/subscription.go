@@ -0,0 +1,26 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package types
+
+import (
+	"time"
+
+	pgdb "github.com/galeone/fitbit-pgdb/v3"
+)
+
+// Subscription is a Fitbit Subscriptions API subscription of the user
+// to a collection (activities, body, sleep, ...).
+type Subscription struct {
+	ID             int64               `igor:"primary_key"`
+	User           pgdb.AuthorizedUser `sql:"-"`
+	UserID         int64
+	CollectionType string
+	SubscriptionID string
+	CreatedAt      time.Time
+}
+
+func (Subscription) TableName() string {
+	return "fitbit_subscriptions"
+}
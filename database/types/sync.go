@@ -0,0 +1,27 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package types
+
+import (
+	"database/sql"
+
+	pgdb "github.com/galeone/fitbit-pgdb/v3"
+)
+
+// SyncStatus contains the outcome of the last background synchronizations
+// of a data type (table name) for the user.
+type SyncStatus struct {
+	ID          int64               `igor:"primary_key"`
+	User        pgdb.AuthorizedUser `sql:"-"`
+	UserID      int64
+	DataType    string
+	LastSuccess sql.NullTime
+	LastFailure sql.NullTime
+	LastError   string
+}
+
+func (SyncStatus) TableName() string {
+	return "sync_status"
+}
@@ -1,9 +1,20 @@
 package types
 
-import fitbit_pgdb "github.com/galeone/fitbit-pgdb/v3"
+import (
+	"database/sql"
+
+	fitbit_pgdb "github.com/galeone/fitbit-pgdb/v3"
+)
 
 type User struct {
 	// fitbit_pgdb.AuthorizedUser is already igor-decorated
 	fitbit_pgdb.AuthorizedUser
 	Dumping bool `sql:"default:true"`
+	// TokenExpiresAt is the expiration time of the access token, if known
+	TokenExpiresAt sql.NullTime
+	// PreviousAccessToken is the access token replaced by the last refresh
+	PreviousAccessToken string
+	// ReconsentRequired is true when the refresh token has been revoked
+	// and the user must give again the permission to the app
+	ReconsentRequired bool `sql:"default:false"`
 }
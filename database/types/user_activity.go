@@ -107,6 +107,8 @@ type ActivityLog struct {
 	// The table has a `txc` field of type `xml`
 	TcxLink string `sql:"-"`
 	Tcx     sql.NullString
+	// TcxFetched is true once the TCX has been requested, even if Fitbit had no TCX for the activity
+	TcxFetched bool
 	// Nullable types
 	HeartRateLink sql.NullString // e.g. custom activities don't have hr tracking
 
@@ -116,6 +118,26 @@ func (ActivityLog) TableName() string {
 	return "activity_logs"
 }
 
+// ActivityTrackpoint is a trackpoint of the TCX of an activity.
+// The position is missing for the activities without GPS.
+type ActivityTrackpoint struct {
+	ID            int64               `igor:"primary_key"`
+	User          pgdb.AuthorizedUser `sql:"-"`
+	UserID        int64
+	ActivityLogID int64
+	Time          time.Time
+	Latitude      sql.NullFloat64
+	Longitude     sql.NullFloat64
+	Altitude      sql.NullFloat64
+	Distance      float64
+	HeartRate     float64
+	Cadence       float64
+}
+
+func (ActivityTrackpoint) TableName() string {
+	return "activity_trackpoints"
+}
+
 type Distance struct {
 	types.Distance
 	ID int64 `igor:"primary_key"`
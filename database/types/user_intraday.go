@@ -8,14 +8,19 @@ import (
 	"time"
 
 	pgdb "github.com/galeone/fitbit-pgdb/v3"
-	"github.com/galeone/fitbit/v2/types"
 )
 
+// The intraday tables contain a row for every minute (or for every day, for the breathing rate)
+// instead of the whole Fitbit response. DateTime is in the timezone of the user.
+
 type CaloriesSeriesIntraday struct {
-	types.CaloriesSeriesIntraday
-	ID     int64               `igor:"primary_key"`
-	User   pgdb.AuthorizedUser `sql:"-"`
-	UserID int64
+	ID       int64               `igor:"primary_key"`
+	User     pgdb.AuthorizedUser `sql:"-"`
+	UserID   int64
+	DateTime time.Time
+	Level    int64
+	Mets     int64
+	Value    float64
 }
 
 func (CaloriesSeriesIntraday) TableName() string {
@@ -23,10 +28,13 @@ func (CaloriesSeriesIntraday) TableName() string {
 }
 
 type DistanceSeriesIntraday struct {
-	types.DistanceSeriesIntraday
-	ID     int64               `igor:"primary_key"`
-	User   pgdb.AuthorizedUser `sql:"-"`
-	UserID int64
+	ID       int64               `igor:"primary_key"`
+	User     pgdb.AuthorizedUser `sql:"-"`
+	UserID   int64
+	DateTime time.Time
+	Level    int64
+	Mets     int64
+	Value    float64
 }
 
 func (DistanceSeriesIntraday) TableName() string {
@@ -34,10 +42,13 @@ func (DistanceSeriesIntraday) TableName() string {
 }
 
 type ElevationSeriesIntraday struct {
-	types.ElevationSeriesIntraday
-	ID     int64               `igor:"primary_key"`
-	User   pgdb.AuthorizedUser `sql:"-"`
-	UserID int64
+	ID       int64               `igor:"primary_key"`
+	User     pgdb.AuthorizedUser `sql:"-"`
+	UserID   int64
+	DateTime time.Time
+	Level    int64
+	Mets     int64
+	Value    float64
 }
 
 func (ElevationSeriesIntraday) TableName() string {
@@ -45,10 +56,13 @@ func (ElevationSeriesIntraday) TableName() string {
 }
 
 type FloorsSeriesIntraday struct {
-	types.FloorsSeriesIntraday
-	ID     int64               `igor:"primary_key"`
-	User   pgdb.AuthorizedUser `sql:"-"`
-	UserID int64
+	ID       int64               `igor:"primary_key"`
+	User     pgdb.AuthorizedUser `sql:"-"`
+	UserID   int64
+	DateTime time.Time
+	Level    int64
+	Mets     int64
+	Value    float64
 }
 
 func (FloorsSeriesIntraday) TableName() string {
@@ -56,21 +70,38 @@ func (FloorsSeriesIntraday) TableName() string {
 }
 
 type StepsSeriesIntraday struct {
-	types.StepsSeriesIntraday
-	ID     int64               `igor:"primary_key"`
-	User   pgdb.AuthorizedUser `sql:"-"`
-	UserID int64
+	ID       int64               `igor:"primary_key"`
+	User     pgdb.AuthorizedUser `sql:"-"`
+	UserID   int64
+	DateTime time.Time
+	Level    int64
+	Mets     int64
+	Value    float64
 }
 
 func (StepsSeriesIntraday) TableName() string {
 	return "steps_series_intraday"
 }
 
+// HeartRateIntraday is the average heart rate of a minute.
+type HeartRateIntraday struct {
+	ID       int64               `igor:"primary_key"`
+	User     pgdb.AuthorizedUser `sql:"-"`
+	UserID   int64
+	DateTime time.Time
+	Value    float64
+}
+
+func (HeartRateIntraday) TableName() string {
+	return "heart_rate_intraday"
+}
+
 type OxygenSaturationIntraday struct {
-	types.OxygenSaturationIntraday
-	ID     int64               `igor:"primary_key"`
-	User   pgdb.AuthorizedUser `sql:"-"`
-	UserID int64
+	ID       int64               `igor:"primary_key"`
+	User     pgdb.AuthorizedUser `sql:"-"`
+	UserID   int64
+	DateTime time.Time
+	Value    float64
 }
 
 func (OxygenSaturationIntraday) TableName() string {
@@ -78,22 +109,30 @@ func (OxygenSaturationIntraday) TableName() string {
 }
 
 type HeartRateVariabilityIntradayHRV struct {
-	types.HeartRateVariabilityValueIntraday
 	ID       int64               `igor:"primary_key"`
 	User     pgdb.AuthorizedUser `sql:"-"`
 	UserID   int64
 	DateTime time.Time // required
+	Coverage float64
+	Hf       float64
+	Lf       float64
+	Rmssd    float64
 }
 
 func (HeartRateVariabilityIntradayHRV) TableName() string {
 	return "heart_rate_variability_intraday_hrv"
 }
 
+// BreathingRateIntraday contains the average breathing rate of every sleep stage of the main sleep of the day.
 type BreathingRateIntraday struct {
-	types.BreathingRateIntradaySummary
-	ID     int64               `igor:"primary_key"`
-	User   pgdb.AuthorizedUser `sql:"-"`
-	UserID int64
+	ID                int64               `igor:"primary_key"`
+	User              pgdb.AuthorizedUser `sql:"-"`
+	UserID            int64
+	Date              time.Time
+	DeepSleepSummary  float64
+	FullSleepSummary  float64
+	LightSleepSummary float64
+	RemSleepSummary   float64
 }
 
 func (BreathingRateIntraday) TableName() string {
@@ -92,3 +92,42 @@ func (f *SleepLog) Values() []string {
 func (SleepLog) TableName() string {
 	return "sleep_logs"
 }
+
+// MainSleep returns the main sleep among sleepLogs, or nil if there's none.
+func MainSleep(sleepLogs []*SleepLog) *SleepLog {
+	for _, sleepLog := range sleepLogs {
+		if sleepLog.IsMainSleep {
+			return sleepLog
+		}
+	}
+	return nil
+}
+
+// Naps are the sleep sessions of a day that are not the main sleep.
+type Naps []SleepLog
+
+// Headers returns the headers of the aggregated features of the naps.
+func (Naps) Headers() []string {
+	return []string{
+		"NapsCount",
+		"NapsMinutesAsleep",
+		"NapsMinutesAwake",
+		"NapsTimeInBed",
+	}
+}
+
+// Values returns the aggregated features of the naps. The values are 0 when there are no naps.
+func (n Naps) Values() []string {
+	var minutesAsleep, minutesAwake, timeInBed int64
+	for _, nap := range n {
+		minutesAsleep += nap.MinutesAsleep
+		minutesAwake += nap.MinutesAwake
+		timeInBed += nap.TimeInBed
+	}
+	return []string{
+		strconv.Itoa(len(n)),
+		strconv.FormatInt(minutesAsleep, 10),
+		strconv.FormatInt(minutesAwake, 10),
+		strconv.FormatInt(timeInBed, 10),
+	}
+}
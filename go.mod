@@ -16,6 +16,7 @@ require (
 	github.com/labstack/echo/v4 v4.11.4
 	github.com/labstack/gommon v0.4.2
 	github.com/pgvector/pgvector-go v0.1.1
+	golang.org/x/oauth2 v0.19.0
 )
 
 require (
@@ -58,7 +59,6 @@ require (
 	go.opencensus.io v0.24.0 // indirect
 	golang.org/x/crypto v0.22.0 // indirect
 	golang.org/x/net v0.24.0
-	golang.org/x/oauth2 v0.19.0 // indirect
 	golang.org/x/sys v0.19.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	golang.org/x/time v0.5.0 // indirect
@@ -68,3 +68,6 @@ require (
 	google.golang.org/protobuf v1.33.0
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
+
+// The authorizer of the fork can send the requests through a custom http.Client, see third_party/fitbit
+replace github.com/galeone/fitbit/v2 => ./third_party/fitbit
@@ -5,19 +5,30 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"os"
 
 	"github.com/galeone/fitsleepinsights/app"
-	_ "github.com/galeone/fitsleepinsights/database"
+	"github.com/galeone/fitsleepinsights/database"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/labstack/echo/v4"
 )
 
 func main() {
+	database.Init()
+	app.Init()
+
 	domains := map[string]*echo.Echo{}
+	// Keep the data of every user up to date, even if they don't login
+	go app.NewSyncScheduler().Run(context.Background())
+	// Embed again the reports embedded by a model different from the configured one
+	go app.ReembedReports(context.Background())
+	// Generate the reports queued by the chat and by the synchronization
+	go app.NewReportQueue().Run(context.Background())
+
 	app, err := app.NewRouter()
 	if err != nil {
 		panic(err.Error())
@@ -1,4 +1,40 @@
-function appendMessage(message, isUser, marker) {
+// renderSources links the citations of the reply (e.g. [1]) to the dashboard of the days
+// of the cited reports, and lists the reports below the reply.
+function renderSources(messageElement, sources) {
+    if (!sources || sources.length == 0) {
+        return;
+    }
+    var urls = {};
+    sources.forEach(function(source) {
+        urls[source.label] = source;
+    });
+    messageElement.innerHTML = messageElement.innerHTML.replace(/\[(\d+)\]/g, function(citation, label) {
+        var source = urls[label];
+        if (!source) {
+            return citation;
+        }
+        return '<a class="chat-citation" href="' + source.url + '">' + citation + '</a>';
+    });
+
+    var list = document.createElement('ol');
+    list.classList.add('chat-sources');
+    sources.forEach(function(source) {
+        var item = document.createElement('li');
+        item.value = source.label;
+        var link = document.createElement('a');
+        link.href = source.url;
+        if (source.start_date == source.end_date) {
+            link.textContent = source.report_type + " report of " + source.start_date;
+        } else {
+            link.textContent = source.report_type + " report from " + source.start_date + " to " + source.end_date;
+        }
+        item.appendChild(link);
+        list.appendChild(item);
+    });
+    messageElement.appendChild(list);
+}
+
+function appendMessage(message, isUser, marker, sources) {
     var chatMessages = document.querySelector('.chat-messages');
     let messageElement;
     if (marker == "full" || marker == "begin") {
@@ -10,6 +46,7 @@ function appendMessage(message, isUser, marker) {
         messageElement.innerHTML += message;
         if (marker == "end") {
             messageElement.innerHTML = marked.parse(messageElement.innerHTML);
+            renderSources(messageElement, sources);
         }
     }
     if (isUser) {
@@ -40,7 +77,121 @@ function appendMessage(message, isUser, marker) {
     chatMessages.scrollTop += 100;
 }
 
-document.addEventListener("DOMContentLoaded", function() {
+// The conversation currently displayed, 0 if not yet stored
+var conversationID = 0;
+var ws;
+
+function dateRanges() {
+    // startDate/endDate, in the YYYY-MM-DD format
+    return document.getElementById("ranges").getAttribute("data-ranges").split("/");
+}
+
+function appendHistoryMessage(message, isUser, sources) {
+    var messageElement = document.createElement('div');
+    messageElement.innerHTML = marked.parse(message);
+    renderSources(messageElement, sources);
+    messageElement.classList.add(isUser ? 'chat-message-user' : 'chat-message-bot');
+    var chatMessages = document.querySelector('.chat-messages');
+    chatMessages.appendChild(messageElement);
+    chatMessages.scrollTop = chatMessages.scrollHeight;
+}
+
+function loadConversations() {
+    const [start, end] = dateRanges();
+    fetch("/conversations?start=" + start + "&end=" + end).then(function(response) {
+        return response.json();
+    }).then(function(conversations) {
+        var list = document.getElementById("conversation-list");
+        list.innerHTML = '';
+        if (conversations.length == 0) {
+            var item = document.createElement('li');
+            item.textContent = "No conversations about these dates";
+            list.appendChild(item);
+            return;
+        }
+        conversations.forEach(function(conversation) {
+            var item = document.createElement('li');
+            if (conversation.id == conversationID) {
+                item.classList.add("active");
+            }
+
+            var title = document.createElement('a');
+            title.href = "#";
+            title.classList.add("conversation-title");
+            title.textContent = conversation.title;
+            title.title = new Date(conversation.updated_at).toLocaleString();
+            title.addEventListener('click', (event) => {
+                event.preventDefault();
+                connect(conversation.id);
+            });
+
+            var exportLink = document.createElement('a');
+            exportLink.href = "/conversations/" + conversation.id + "/export";
+            exportLink.title = "Export";
+            exportLink.classList.add("fa-solid", "fa-download");
+
+            var deleteLink = document.createElement('a');
+            deleteLink.href = "#";
+            deleteLink.title = "Delete";
+            deleteLink.classList.add("fa-regular", "fa-trash-can");
+            deleteLink.addEventListener('click', (event) => {
+                event.preventDefault();
+                if (!confirm("Delete the conversation \"" + conversation.title + "\"?")) {
+                    return;
+                }
+                fetch("/conversations/" + conversation.id, { method: "DELETE" }).then(function() {
+                    if (conversation.id == conversationID) {
+                        connect(0);
+                    } else {
+                        loadConversations();
+                    }
+                });
+            });
+
+            item.appendChild(title);
+            item.appendChild(exportLink);
+            item.appendChild(deleteLink);
+            list.appendChild(item);
+        });
+    });
+}
+
+// Whether loadReportStatus is polling the status of the reports
+var reportStatusPolling = false;
+
+// loadReportStatus shows the progress of the generation of the reports of the dates,
+// used by the assistant to answer. It polls until all the reports are generated.
+function loadReportStatus() {
+    reportStatusPolling = true;
+    const [start, end] = dateRanges();
+    fetch("/reports/status?start=" + start + "&end=" + end).then(function(response) {
+        return response.json();
+    }).then(function(status) {
+        var element = document.getElementById("report-status");
+        var waiting = status.pending + status.running;
+        var total = waiting + status.done + status.failed;
+        if (waiting > 0) {
+            element.textContent = "Generating the reports of your data: " + status.done + "/" + total + " ready.";
+        } else if (status.failed > 0) {
+            element.textContent = status.failed + " reports can't be generated: " + status.error;
+        }
+        element.hidden = waiting == 0 && status.failed == 0;
+        if (waiting > 0) {
+            setTimeout(loadReportStatus, 5000);
+        } else {
+            reportStatusPolling = false;
+        }
+    });
+}
+
+// connect opens the chat. If id is not 0 the conversation is resumed, otherwise a new one starts.
+function connect(id) {
+    if (ws) {
+        ws.onclose = null;
+        ws.close();
+    }
+    conversationID = id;
+
     var loc = window.location;
     var uri = 'ws:';
 
@@ -48,7 +199,10 @@ document.addEventListener("DOMContentLoaded", function() {
         uri = 'wss:';
     }
     uri += '//' + loc.host;
-    uri += "/chat/" + document.getElementById("ranges").getAttribute("data-ranges").replaceAll("-", "/");
+    uri += "/chat/" + dateRanges().join("/").replaceAll("-", "/");
+    if (conversationID) {
+        uri += "?conversation=" + conversationID;
+    }
 
     ws = new WebSocket(uri)
 
@@ -60,12 +214,34 @@ document.addEventListener("DOMContentLoaded", function() {
         appendMessage("Hi, I'm your AI assistant 🤖<br>I analyzed the data visualized in the dashboard and I'm ready to answer your questions.", false, "full")
         chatInput.removeAttribute("disabled");
         chatButton.removeAttribute("disabled");
+        loadConversations();
+        // The reports are queued when the chat is opened
+        if (!reportStatusPolling) {
+            loadReportStatus();
+        }
     }
 
     ws.onmessage = function(evt) {
         data = JSON.parse(evt.data);
-        appendMessage(data.message, false, data.marker);     
+        if (data.role) {
+            // History of the resumed conversation
+            appendHistoryMessage(data.message, data.role == "user", data.sources);
+            return;
+        }
+        appendMessage(data.message, false, data.marker, data.sources);
+        if (data.marker == "end" && data.conversation_id && data.conversation_id != conversationID) {
+            // The first reply of a new conversation: it has been stored
+            conversationID = data.conversation_id;
+            loadConversations();
+        }
     }
+}
+
+document.addEventListener("DOMContentLoaded", function() {
+    connect(0);
+
+    var chatInput = document.querySelector('.chat-input input[type="text"]');
+    var chatButton = document.querySelector('.chat-input button');
 
     // Send new message
     chatInput.addEventListener('keyup', (event) => {
@@ -77,7 +253,6 @@ document.addEventListener("DOMContentLoaded", function() {
             ws.send(message);
             appendMessage(message, true, "full");
             event.target.value = '';
-            chatInput.va
         }
     });
     chatButton.addEventListener('click', (event) => {
@@ -85,5 +260,7 @@ document.addEventListener("DOMContentLoaded", function() {
             'key': 'Enter'
         }));
     });
-
-});
\ No newline at end of file
+    document.getElementById("new-conversation").addEventListener('click', (event) => {
+        connect(0);
+    });
+});
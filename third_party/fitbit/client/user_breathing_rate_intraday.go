@@ -0,0 +1,43 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/galeone/fitbit/v2/types"
+)
+
+// UserBreathingRateIntraday retrieves intraday breathing rate data for a date range.
+// The endDate parameter is optional. When present it returns the summary, day-by-day, from startDate to endDate.
+func (c *Client) UserBreathingRateIntraday(startDate, endDate *time.Time) (ret *types.BreathingRateIntraday, err error) {
+	var res *http.Response
+	var sb strings.Builder
+
+	// /1/user/[user-id]/br/date/[date]/all.json
+	sb.WriteString(fmt.Sprintf("/br/date/%s", startDate.Format(types.DateLayout)))
+	if endDate != nil && !endDate.IsZero() {
+		// /1/user/[user-id]/br/date/[start-date]/[end-date]/all.json
+		sb.WriteString(fmt.Sprintf("/%s", endDate.Format(types.DateLayout)))
+	}
+	sb.WriteString("/all.json")
+	path := sb.String()
+	if res, err = c.req.Get(UserV1(path)); err != nil {
+		return
+	}
+
+	var body []byte
+	if body, err = c.resRead(res); err != nil {
+		return
+	}
+
+	ret = &types.BreathingRateIntraday{}
+	err = json.Unmarshal(body, ret)
+	return
+}
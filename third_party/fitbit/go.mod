@@ -0,0 +1,16 @@
+module github.com/galeone/fitbit/v2
+
+go 1.21
+
+require (
+	github.com/galeone/tcx v1.0.0
+	github.com/google/uuid v1.6.0
+	golang.org/x/oauth2 v0.16.0
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/philhofer/vec v0.0.0-20140421144027-536fc796d369 // indirect
+	google.golang.org/appengine v1.6.8 // indirect
+	google.golang.org/protobuf v1.32.0 // indirect
+)